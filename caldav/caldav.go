@@ -0,0 +1,230 @@
+// Package caldav implements gcal.CalendarService for CalDAV servers such as
+// Nextcloud, Fastmail or Radicale.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/ical"
+	"github.com/perbu/calvin/interval"
+)
+
+// PasswordEnv names the environment variable that overrides the configured password.
+const PasswordEnv = "CALVIN_CALDAV_PASSWORD"
+
+// ErrUnsupported is returned for operations calvin does not implement over CalDAV.
+var ErrUnsupported = errors.New("not supported by the CalDAV backend")
+
+// Client reads events from a CalDAV server.
+type Client struct {
+	URL        string // calendar collection, with {user} and {email} placeholders
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// New creates a client from the CalDAV settings of the config. Requests are
+// retried on transient failures, see gcal.RetryTransport.
+func New(cfg config.CalDAV) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("caldav.New: no \"url\" under \"caldav\" in the config")
+	}
+	password := cfg.Password
+	if env := os.Getenv(PasswordEnv); env != "" {
+		password = env
+	}
+	return &Client{
+		URL:        cfg.URL,
+		Username:   cfg.Username,
+		Password:   password,
+		HTTPClient: &http.Client{Transport: gcal.NewRetryTransport(http.DefaultTransport)},
+	}, nil
+}
+
+// calendarURL returns the collection holding calendarID's events. A calendar
+// ID that is itself a URL is used as is.
+func (c *Client) calendarURL(calendarID string) string {
+	if strings.HasPrefix(calendarID, "https://") || strings.HasPrefix(calendarID, "http://") {
+		return calendarID
+	}
+	user, _, _ := strings.Cut(calendarID, "@")
+	return strings.NewReplacer("{user}", user, "{email}", calendarID).Replace(c.URL)
+}
+
+// ListEvents retrieves the events of the day theDate falls on, in the local time zone.
+func (c *Client) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	from, to := gcal.LocalDay(theDate)
+	return c.ListEventsRange(ctx, calendarID, from, to)
+}
+
+// ListEventsRange retrieves the events overlapping [from, to), with recurring
+// events expanded into their instances by the server.
+func (c *Client) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	events, err := c.query(ctx, calendarID, from, to, true)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving events: %w", err)
+	}
+	return events, nil
+}
+
+// SearchEvents retrieves the events in [from, to) whose summary, location or
+// description contain query. CalDAV text matching is patchy across servers, so
+// the matching is done here.
+func (c *Client) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	events, err := c.query(ctx, calendarID, from, to, true)
+	if err != nil {
+		return nil, fmt.Errorf("searching events: %w", err)
+	}
+	return gcal.Filter{Grep: query}.Apply(events), nil
+}
+
+// ListSeries retrieves the recurring events with instances in [from, to) as
+// their series. Single events are left out.
+func (c *Client) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	events, err := c.query(ctx, calendarID, from, to, false)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", err)
+	}
+	items := events.Items[:0]
+	for _, item := range events.Items {
+		if len(item.Recurrence) > 0 && item.RecurringEventID == "" {
+			items = append(items, item)
+		}
+	}
+	events.Items = items
+	return events, nil
+}
+
+// ListCalendars is not supported; calendars are addressed through the configured URL.
+func (c *Client) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	return nil, fmt.Errorf("listing calendars: %w", ErrUnsupported)
+}
+
+// InsertEvent is not supported.
+func (c *Client) InsertEvent(ctx context.Context, calendarID string, event *gcal.Event) (*gcal.Event, error) {
+	return nil, fmt.Errorf("creating events: %w", ErrUnsupported)
+}
+
+// FreeBusy returns the busy times of each calendar in [from, to), computed from
+// their events, see gcal.BusyFromEvents.
+func (c *Client) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return gcal.BusyFromEvents(ctx, c.ListEventsRange, calendarIDs, from, to)
+}
+
+// query runs a calendar-query REPORT for the events overlapping [from, to).
+func (c *Client) query(ctx context.Context, calendarID string, from, to time.Time, expand bool) (*gcal.Events, error) {
+	body, err := c.report(ctx, calendarID, calendarQuery(from, to, expand))
+	if err != nil {
+		return nil, err
+	}
+	var ms multistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	events := &gcal.Events{}
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.Propstat {
+			if ps.Prop.CalendarData == "" || !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			cal, err := ical.Parse(strings.NewReader(ps.Prop.CalendarData))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", resp.Href, err)
+			}
+			listed, err := ical.Events(cal, gcal.Owner(calendarID), time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", resp.Href, err)
+			}
+			if events.TimeZone == "" {
+				events.TimeZone = listed.TimeZone
+			}
+			events.Items = append(events.Items, listed.Items...)
+		}
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool { return events.Items[i].Start.Before(events.Items[j].Start) })
+	return events, nil
+}
+
+// report sends a REPORT request to calendarID's collection and returns the response body.
+func (c *Client) report(ctx context.Context, calendarID string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "REPORT", c.calendarURL(calendarID), bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, statusError(calendarID, resp)
+	}
+	return body, nil
+}
+
+// statusError turns a failed response into an error, classified like the
+// errors of the Google backend where possible.
+func statusError(calendarID string, resp *http.Response) error {
+	err := fmt.Errorf("caldav: %s", resp.Status)
+	if kind := gcal.StatusKind(resp.StatusCode); kind != nil {
+		return &gcal.APIError{Kind: kind, CalendarID: calendarID, Err: err}
+	}
+	return err
+}
+
+// calendarQuery builds the body of a calendar-query REPORT for VEVENTs in
+// [from, to). With expand, the server returns recurring events as instances.
+func calendarQuery(from, to time.Time, expand bool) []byte {
+	const layout = "20060102T150405Z"
+	start, end := from.UTC().Format(layout), to.UTC().Format(layout)
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+	b.WriteString(`<D:prop><C:calendar-data>`)
+	if expand {
+		fmt.Fprintf(&b, `<C:expand start="%s" end="%s"/>`, start, end)
+	}
+	b.WriteString(`</C:calendar-data></D:prop>`)
+	b.WriteString(`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">`)
+	fmt.Fprintf(&b, `<C:time-range start="%s" end="%s"/>`, start, end)
+	b.WriteString(`</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`)
+	return b.Bytes()
+}
+
+// multistatus is the WebDAV response to a REPORT.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
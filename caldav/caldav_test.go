@@ -0,0 +1,146 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/gcal"
+)
+
+// The stand-in server's calendar: a weekly 1:1 and a single review.
+const (
+	oneOnOneSeries = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1on1\r\nSUMMARY:1:1 with Bob\r\n" +
+		"DTSTART:20250127T100000Z\r\nDTEND:20250127T103000Z\r\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE\r\n" +
+		"ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com\r\nATTENDEE:mailto:bob@example.com\r\n" +
+		"END:VEVENT\r\nEND:VCALENDAR\r\n"
+	oneOnOneInstances = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:1on1\r\nRECURRENCE-ID:20250127T100000Z\r\nSUMMARY:1:1 with Bob\r\n" +
+		"DTSTART:20250127T100000Z\r\nDTEND:20250127T103000Z\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:1on1\r\nRECURRENCE-ID:20250129T100000Z\r\nSUMMARY:1:1 with Bob\r\n" +
+		"DTSTART:20250129T100000Z\r\nDTEND:20250129T103000Z\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	review = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:review\r\nSUMMARY:Quarterly review\r\n" +
+		"DTSTART:20250127T101500Z\r\nDTEND:20250127T110000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+)
+
+// newServer starts a CalDAV stand-in holding alice's calendar, readable with
+// the password "secret".
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "REPORT" || r.Header.Get("Depth") != "1" {
+			http.Error(w, "want a REPORT with Depth 1", http.StatusBadRequest)
+			return
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/dav/calendars/alice/personal/" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `<C:time-range start="20250127T000000Z" end="20250203T000000Z"/>`) {
+			http.Error(w, "unexpected time range", http.StatusBadRequest)
+			return
+		}
+		oneOnOne := oneOnOneSeries
+		if strings.Contains(string(body), "<C:expand") {
+			oneOnOne = oneOnOneInstances
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">`)
+		for _, href := range []string{"1on1.ics", "review.ics"} {
+			data := review
+			if href == "1on1.ics" {
+				data = oneOnOne
+			}
+			fmt.Fprintf(w, `<d:response><d:href>/dav/calendars/alice/personal/%s</d:href><d:propstat><d:prop><cal:calendar-data>%s</cal:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, href, data)
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := newServer(t)
+	t.Setenv(PasswordEnv, "secret")
+	c, err := New(config.CalDAV{URL: srv.URL + "/dav/calendars/{user}/personal/", Username: "alice", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx := context.Background()
+	from := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+
+	events, err := c.ListEventsRange(ctx, "alice@example.com", from, to)
+	if err != nil {
+		t.Fatalf("ListEventsRange returned error: %v", err)
+	}
+	var got []string
+	for _, item := range events.Items {
+		got = append(got, fmt.Sprintf("%s %s %s", item.Start.Format("Mon 15:04"), item.Summary, item.RecurringEventID))
+	}
+	if want := "Mon 10:00 1:1 with Bob 1on1,Mon 10:15 Quarterly review ,Wed 10:00 1:1 with Bob 1on1"; strings.Join(got, ",") != want {
+		t.Errorf("ListEventsRange = %q, want %q", strings.Join(got, ","), want)
+	}
+
+	found, err := c.SearchEvents(ctx, "alice@example.com", "REVIEW", from, to)
+	if err != nil || len(found.Items) != 1 || found.Items[0].Summary != "Quarterly review" {
+		t.Errorf("SearchEvents = %v, %v, want the review", found, err)
+	}
+
+	series, err := c.ListSeries(ctx, "alice@example.com", from, to)
+	if err != nil || len(series.Items) != 1 {
+		t.Fatalf("ListSeries = %v, %v, want the 1:1 series", series, err)
+	}
+	if s := series.Items[0]; gcal.DescribeRecurrence(s.Recurrence) != "every week on Mon, Wed" || s.Attendees[0].Response != gcal.ResponseAccepted || !s.Attendees[0].Self {
+		t.Errorf("series = %+v, want the weekly 1:1 accepted by alice", s)
+	}
+
+	busy, err := c.FreeBusy(ctx, []string{"alice@example.com", "nobody@example.com"}, from, to)
+	if err != nil {
+		t.Fatalf("FreeBusy returned error: %v", err)
+	}
+	if _, ok := busy["nobody@example.com"]; ok || len(busy["alice@example.com"]) != 2 {
+		t.Errorf("FreeBusy = %v, want two busy periods for alice and nothing for an unknown calendar", busy)
+	}
+	if p := busy["alice@example.com"][0]; p.Duration() != time.Hour {
+		t.Errorf("first busy period lasts %v, want the overlapping 1:1 and review merged into 1h", p.Duration())
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	from := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+
+	c := &Client{URL: srv.URL + "/dav/calendars/{user}/personal/", Username: "alice", Password: "secret"}
+	if _, err := c.ListEventsRange(ctx, "nobody@example.com", from, to); !errors.Is(err, gcal.ErrNotFound) {
+		t.Errorf("ListEventsRange(nobody) error = %v, want %v", err, gcal.ErrNotFound)
+	}
+	if _, err := c.ListCalendars(ctx); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ListCalendars error = %v, want %v", err, ErrUnsupported)
+	}
+	c.Password = "wrong"
+	_, err := c.ListEventsRange(ctx, srv.URL+"/dav/calendars/alice/personal/", from, to)
+	var apiErr *gcal.APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != gcal.ErrAuthExpired {
+		t.Errorf("ListEventsRange with a wrong password error = %v, want %v", err, gcal.ErrAuthExpired)
+	}
+	if _, err := New(config.CalDAV{}); err == nil {
+		t.Error("New accepted a config without a URL")
+	}
+}
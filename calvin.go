@@ -1,102 +1,566 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/perbu/calvin/caldav"
 	"github.com/perbu/calvin/config"
-	"github.com/perbu/calvin/dateparse"
 	"github.com/perbu/calvin/gcal"
-	"log"
+	"github.com/perbu/calvin/graph"
+	"github.com/perbu/calvin/icsfeed"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 //go:embed .version
 var embeddedVersion string
 
-func run(args []string) error {
-	// Initialize configuration loader
+// sourceUser stands in for the user when an .ics source is read without a
+// default user in the config.
+const sourceUser = "me"
 
-	var useLocalTimezone bool
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
 
-	flag.BoolVar(&useLocalTimezone, "local", false, "Use local timezone")
-	flag.Parse()
+	exitInterrupted = 130 // 128 + SIGINT, as shells report it
+)
+
+// options holds the values of all flags. Each command registers the flags it uses.
+type options struct {
+	local      bool
+	color      string
+	timeout    time.Duration
+	source     string
+	profile    string
+	format     string
+	watch      watchOptions
+	filter     gcal.Filter
+	from, to   string
+	jsonOutput bool
+	free       freeOptions
+	add        addOptions
+	rooms      roomsOptions
+	serve      serveOptions
+	exporter   exporterOptions
+	access     gcal.Access
+}
+
+// addGlobalFlags registers the flags every command accepts. They may also be
+// given before the command, so the current values are kept as defaults.
+func addGlobalFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.local, "local", o.local, "Use local timezone")
+	fs.StringVar(&o.color, "color", o.color, "Colorize output: auto, always or never")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "Give up after this long, e.g. 30s (default no limit)")
+	fs.StringVar(&o.source, "source", o.source, "Read events from an .ics file or feed, e.g. file:///path/team.ics, instead of the configured backend")
+	fs.StringVar(&o.profile, "profile", o.profile, "Use the settings of this profile from the config")
+}
+
+// addFilterFlags registers the flags that hide events from listings.
+func addFilterFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.filter.Grep, "grep", "", "Only show events whose summary, location or description contains this text")
+	fs.StringVar(&o.filter.Exclude, "exclude", "", "Hide events whose summary contains this text")
+	fs.StringVar(&o.filter.OnlyWith, "only-with", "", "Only show events with an attendee matching this text")
+	fs.DurationVar(&o.filter.MinDuration, "min-duration", 0, "Hide events shorter than this")
+	fs.BoolVar(&o.filter.HideAllDay, "hide-all-day", false, "Hide all-day events")
+	fs.BoolVar(&o.filter.OnlyAccepted, "only-accepted", false, "Only show events the calendar owner has accepted")
+}
+
+// env is what every command runs with.
+type env struct {
+	ctx    context.Context // cancelled on Ctrl-C or when --timeout expires
+	loader config.Loader
+	config *config.Config
+	opts   options
+	stdout io.Writer
+	stderr io.Writer
+	people *gcal.PeopleRecorder
+}
+
+// command is a subcommand of calvin. Arguments after the command name are passed to run.
+type command struct {
+	name     string
+	args     string // synopsis of the arguments, for help
+	summary  string
+	flags    func(fs *flag.FlagSet, o *options) // command specific flags, may be nil
+	run      func(e *env, args []string) error
+	complete func(e *env, args []string) []string // candidates for the next argument, given the previous ones
+	hidden   bool
+	offline  bool // runs without a config file
+}
+
+// flagSet returns the flags of the command, including the global ones.
+func (c *command) flagSet(o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("calvin "+c.name, flag.ContinueOnError)
+	addGlobalFlags(fs, o)
+	if c.flags != nil {
+		c.flags(fs, o)
+	}
+	return fs
+}
+
+// printUsage prints the help text of the command.
+func (c *command) printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: calvin %s [flags] %s\n\n%s.\n\nFlags:\n", c.name, c.args, c.summary)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
 
+// usageError is returned for invalid command lines. run prints the usage of
+// the command and exits with exitUsage.
+type usageError struct{ msg string }
+
+func (u usageError) Error() string { return u.msg }
+
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// commands is filled in by init to avoid an initialization cycle through help.
+var commands []*command
+
+// viewCommand runs when the first argument is not a command name.
+var viewCommand *command
+
+func init() {
+	commands = []*command{
+		{name: "view", args: "[username] [date]", summary: "List the events of a day or a week", flags: addFilterFlags, run: runView, complete: completeView},
+		{name: "free", args: "[username[,username...]] [date]", summary: "Find times within working hours when everyone is free", flags: addFreeFlags, run: runFree, complete: completeView},
+		{name: "add", args: "<title>", summary: "Create an event", flags: addAddFlags, run: runAdd},
+		{name: "rooms", args: "[building] [date] [HH:MM-HH:MM]", summary: "Find free meeting rooms", flags: addRoomsFlags, run: runRooms, complete: completeRooms},
+		{name: "next", args: "[username]", summary: "Print the next event as a status line", flags: addStatusFlags, run: statusCommand(gcal.StatusNext), complete: completeUser},
+		{name: "now", args: "[username]", summary: "Print the current event as a status line", flags: addStatusFlags, run: statusCommand(gcal.StatusNow), complete: completeUser},
+		{name: "watch", args: "[username]", summary: "Notify before events start", flags: addWatchFlags, run: runWatch, complete: completeUser},
+		{name: "search", args: "<query> [username]", summary: "Search events by text", flags: addSearchFlags, run: runSearch, complete: completeSearch},
+		{name: "stats", args: "[username] [last|this|next] [week|month]", summary: "Report meeting load", flags: addStatsFlags, run: runStats, complete: completeRange},
+		{name: "conflicts", args: "[username] [last|this|next] [week|month]", summary: "List double-bookings and back-to-back meetings", flags: addFilterFlags, run: runConflicts, complete: completeRange},
+		{name: "recurring", args: "[username]", summary: "List recurring events and their weekly time", flags: addFilterFlags, run: runRecurring, complete: completeUser},
+		{name: "whereis", args: "[username] [last|this|next] [week|month]", summary: "Show where someone is working", run: runWhereis, complete: completeRange},
+		{name: "serve", summary: "Serve calendar data as JSON over HTTP", flags: addServeFlags, run: runServe},
+		{name: "exporter", args: "[username[,username...]]", summary: "Export availability as Prometheus metrics", flags: addExporterFlags, run: runExporter, complete: completeUser},
+		{name: "calendars", summary: "List your calendars", run: runCalendars},
+		{name: "alias", args: "list | add <name> <user> [user...] | remove <name>", summary: "Manage user and group aliases", run: runAlias, complete: completeAlias},
+		{name: "auth", args: "login | status | logout", summary: "Manage access to Google Calendar or Microsoft 365", flags: addAuthFlags, run: runAuth, complete: completeAuth, offline: true},
+		{name: "config", args: "path | show", summary: "Show the configuration", run: runConfig, complete: completeConfig, offline: true},
+		{name: "completion", args: "bash|zsh|fish", summary: "Print a shell completion script", run: runCompletion, complete: completeShell, offline: true},
+		{name: "version", summary: "Print the version", run: runVersion, offline: true},
+		{name: "help", args: "[command]", summary: "Show help for calvin or a command", run: runHelp, complete: completeHelp, offline: true},
+		{name: "__complete", run: runComplete, hidden: true, offline: true},
+	}
+	viewCommand = commands[0]
+}
+
+// lookupCommand returns the command called name, or nil.
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// run runs calvin with the command line args, without the program name, and
+// returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	global := flag.NewFlagSet("calvin", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	addGlobalFlags(global, &opts)
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(stdout)
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "calvin: %v\nRun 'calvin help' for usage.\n", err)
+		return exitUsage
+	}
+	args = global.Args()
+
+	cmd := viewCommand
+	if len(args) > 0 {
+		if c := lookupCommand(args[0]); c != nil {
+			cmd, args = c, args[1:]
+		}
+	}
+	fs := cmd.flagSet(&opts)
+	if cmd.name != "__complete" { // the words being completed are not ours to parse
+		var err error
+		fs.SetOutput(io.Discard)
+		if args, err = parseInterspersed(fs, args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				cmd.printUsage(stdout, fs)
+				return exitOK
+			}
+			return exitCode(usageError{msg: err.Error()}, cmd, stderr)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	e := &env{ctx: ctx, opts: opts, stdout: stdout, stderr: stderr}
+	err := e.load(cmd)
+	if err == nil {
+		err = cmd.run(e, args)
+	}
+	if err != nil && e.config != nil {
+		err = explain(err, e.config.DefaultDomain, e.backendName())
+	}
+	if e.people != nil {
+		if err := e.people.Save(); err != nil {
+			fmt.Fprintf(stderr, "Warning: could not cache attendees: %v\n", err)
+		}
+	}
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		fmt.Fprintln(stderr, "calvin: interrupted")
+		return exitInterrupted
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", opts.timeout, err)
+	}
+	return exitCode(err, cmd, stderr)
+}
+
+// load loads the configuration and applies the color setting. Offline commands,
+// and commands reading an .ics source, work without a config file.
+func (e *env) load(cmd *command) error {
 	loader, err := config.NewFileLoader()
 	if err != nil {
 		return fmt.Errorf("config.NewFileLoader: %w", err)
 	}
-
-	// Load configuration
+	e.loader = loader
+	e.config = &config.Config{}
 	configData, err := loader.LoadConfig()
-	if err != nil {
+	switch {
+	case err == nil:
+		e.config = configData
+	case !cmd.offline && e.opts.source == "":
 		return fmt.Errorf("loader.LoadConfig: %w", err)
 	}
+	if e.opts.profile != "" {
+		profile, err := e.config.WithProfile(e.opts.profile)
+		if err != nil {
+			return err
+		}
+		e.config = profile
+	}
+	// the flag takes precedence over the config file
+	if e.opts.color == "" {
+		e.opts.color = e.config.Color
+	}
+	return gcal.CheckColorMode(e.opts.color)
+}
 
-	// check that we have at least one argument and that it is help:
-	if flag.NArg() == 1 && flag.Arg(0) == "help" {
-		fmt.Println("Calvin - Google Calendar CLI, version", embeddedVersion)
-		fmt.Println("Usage: calvin <username> <date>")
-		fmt.Println("Example: calvin --local john.doe next wednesday")
-		fmt.Println("         calvin john.doe [next] week")
-		return nil
+// exitCode reports err on stderr and maps it to an exit code.
+func exitCode(err error, cmd *command, stderr io.Writer) int {
+	var u usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &u):
+		fmt.Fprintf(stderr, "calvin %s: %v\nUsage: calvin %s [flags] %s\nRun 'calvin help %s' for details.\n",
+			cmd.name, err, cmd.name, cmd.args, cmd.name)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "calvin: %v\n", err)
+		return exitError
 	}
-	// if the there is one or more arguments, the first one is the username, if not, we fall back to the default username:
-	var username string
-	if flag.NArg() < 1 {
-		if configData.DefaultUser == "" {
-			return fmt.Errorf("no username specified and no default user in config")
-		}
-		username = configData.DefaultUser
-	} else {
-		username = flag.Arg(0)
+}
+
+// explainedError replaces the message of an API error with an explanation.
+type explainedError struct {
+	msg string
+	err error
+}
+
+func (e explainedError) Error() string { return e.msg }
+func (e explainedError) Unwrap() error { return e.err }
+
+// serverName names the calendar server of a backend in messages.
+func serverName(backend string) string {
+	switch backend {
+	case "google":
+		return "Google Calendar"
+	case "graph":
+		return "Microsoft Graph"
+	case "ics":
+		return "The calendar source"
 	}
-	// Parse username and date arguments
-	parser := dateparse.New()
-	parseResult, err := parser.Parse(flag.Args())
-	if err != nil {
+	return "The calendar server"
+}
+
+// hintedError is an error whose message already says what to do about it,
+// which explain leaves alone.
+type hintedError struct{ error }
+
+func (e hintedError) Unwrap() error { return e.error }
+
+// hintf formats an error like fmt.Errorf, marked as already explained.
+func hintf(format string, args ...any) error {
+	return hintedError{fmt.Errorf(format, args...)}
+}
+
+// explain turns API failures into messages that say what went wrong and what
+// to do about it, instead of the chain of wrapped errors, in the terms of the
+// backend named as by backendName. Other errors, and those returned by hintf,
+// are returned unchanged.
+func explain(err error, defaultDomain, backend string) error {
+	var apiErr *gcal.APIError
+	var hinted hintedError
+	if !errors.As(err, &apiErr) || errors.As(err, &hinted) {
+		return err
+	}
+	who := strings.TrimSuffix(apiErr.CalendarID, "@"+defaultDomain)
+	var msg string
+	switch {
+	case apiErr.Kind == gcal.ErrAuthExpired && backend == "caldav":
+		msg = "The CalDAV server rejected your login, check the username and password in the config"
+	case apiErr.Kind == gcal.ErrAuthExpired && backend == "ics":
+		msg = "The calendar source asks for a login, which calvin cannot give, check the URL"
+	case apiErr.Kind == gcal.ErrAuthExpired:
+		msg = "Your login expired, run calvin auth login"
+	case apiErr.Kind == gcal.ErrRateLimited:
+		msg = fmt.Sprintf("%s is rate limiting requests, try again in a minute", serverName(backend))
+	case apiErr.Kind == gcal.ErrNotFound && apiErr.CalendarID != "":
+		msg = fmt.Sprintf("No calendar found for %s — check the username or your default_domain", apiErr.CalendarID)
+	case apiErr.Kind == gcal.ErrForbidden && apiErr.CalendarID != "":
+		msg = fmt.Sprintf("You don't have access to %s's calendar", who)
+	case apiErr.Kind == gcal.ErrForbidden:
+		msg = "Access denied, your login may lack the permission this needs (see 'calvin help auth')"
+	default:
 		return err
 	}
+	return explainedError{msg: msg, err: err}
+}
+
+// parseInterspersed parses flags that may appear anywhere among the arguments
+// and returns the remaining arguments. Everything after "--" is an argument.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		before := len(args)
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		consumed := before - len(fs.Args())
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(rest, fs.Args()...), nil
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// printUsage prints the command list.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Calvin - Google Calendar CLI, version", strings.TrimSpace(embeddedVersion))
+	fmt.Fprintln(w, "Usage: calvin [flags] [username] [date]")
+	fmt.Fprintln(w, "       calvin <command> [flags] [arguments]")
+	fmt.Fprintln(w, "Example: calvin --local john.doe next wednesday")
+	fmt.Fprintln(w, "         calvin john.doe [next] week")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		if !c.hidden {
+			fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags for all commands:")
+	fmt.Fprintln(w, "  -local         Use local timezone")
+	fmt.Fprintln(w, "  -color string  Colorize output: auto, always or never")
+	fmt.Fprintln(w, "  -timeout duration")
+	fmt.Fprintln(w, "                 Give up after this long, e.g. 30s (default no limit)")
+	fmt.Fprintln(w, "  -source string Read events from an .ics file or feed instead of the")
+	fmt.Fprintln(w, "                 configured backend, e.g. file:///path/team.ics")
+	fmt.Fprintln(w, "  -profile string")
+	fmt.Fprintln(w, "                 Use the settings of this profile from the config")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'calvin help <command>' for the arguments and flags of a command.")
+}
+
+// runHelp prints the usage of calvin or of a command.
+func runHelp(e *env, args []string) error {
+	if len(args) == 0 {
+		printUsage(e.stdout)
+		return nil
+	}
+	c := lookupCommand(args[0])
+	if c == nil || c.hidden {
+		return usagef("unknown command %q", args[0])
+	}
+	var opts options
+	c.printUsage(e.stdout, c.flagSet(&opts))
+	return nil
+}
 
-	// Build the full calendar ID
-	fullCalendarID := buildCalendarID(username, configData)
+// runVersion prints the version.
+func runVersion(e *env, args []string) error {
+	fmt.Fprintln(e.stdout, "calvin", strings.TrimSpace(embeddedVersion))
+	return nil
+}
+
+// userArg returns args[i], falling back to the default user from the config.
+// An .ics source is a single calendar, so it needs no user.
+func (e *env) userArg(args []string, i int) (string, error) {
+	if len(args) > i {
+		return args[i], nil
+	}
+	if e.config.DefaultUser == "" && e.opts.source != "" {
+		return sourceUser, nil
+	}
+	if e.config.DefaultUser == "" {
+		return "", usagef("no username specified and no default user in config")
+	}
+	return e.config.DefaultUser, nil
+}
 
-	// Initialize Google Calendar service
-	gcalService, err := gcal.NewGCalService(loader)
+// location returns the time zone events are shown in; nil means the calendar's own.
+func (e *env) location() *time.Location {
+	if e.opts.local {
+		return time.Local
+	}
+	return nil
+}
+
+// formatter returns the configured formatter, printing to stdout.
+func (e *env) formatter() (*gcal.Formatter, error) {
+	f, err := gcal.NewFormatter(e.config.Templates, e.config.Theme)
 	if err != nil {
-		return fmt.Errorf("gcal.NewGCalService: %w", err)
+		return nil, fmt.Errorf("gcal.NewFormatter: %w", err)
+	}
+	f.SetOutput(e.stdout)
+	if err := f.SetColorMode(e.opts.color); err != nil {
+		return nil, err
 	}
+	return f, nil
+}
 
-	// find time.location:
-	var loc *time.Location
+// service connects to Google Calendar, applies the listing filters and records
+// the attendees it sees for completion.
+func (e *env) service() (gcal.CalendarService, error) {
+	backend, err := e.backend()
+	if err != nil {
+		return nil, err
+	}
+	e.people = gcal.NewPeopleRecorder(backend, e.loader, e.opts.profile)
+	return gcal.Filtered(e.people, e.opts.filter), nil
+}
 
-	if useLocalTimezone {
-		loc = time.Local
-		fmt.Println("Using local timezone:", loc)
+// backendName returns which backend backend uses: "ics" with --source, else
+// the backend of the config, "google" by default.
+func (e *env) backendName() string {
+	if e.opts.source != "" {
+		return "ics"
 	}
+	if e.config.Backend == "" {
+		return "google"
+	}
+	return e.config.Backend
+}
 
-	// List and print events
-	if parseResult.IsWeek {
-		// If it's a week request, list events for the entire week
-		if err := gcal.ListAndPrintEventsForWeek(gcalService, fullCalendarID, parseResult.WeekDays, configData.DefaultDomain, loc); err != nil {
-			return fmt.Errorf("gcal.ListAndPrintEventsForWeek: %w", err)
+// backend connects to the calendar server selected by "backend" in the config,
+// or reads the .ics source given with --source.
+func (e *env) backend() (gcal.CalendarService, error) {
+	if e.opts.source != "" {
+		source, err := icsfeed.New(e.opts.source)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+	switch e.config.Backend {
+	case "", "google":
+		gcalService, err := gcal.NewGCalService(e.ctx, e.loader)
+		if err != nil {
+			return nil, fmt.Errorf("gcal.NewGCalService: %w", err)
 		}
-	} else {
-		// Otherwise, list events for a single day
-		if err := gcal.ListAndPrintEvents(gcalService, fullCalendarID, parseResult.Date, configData.DefaultDomain, loc); err != nil {
-			return fmt.Errorf("gcal.ListAndPrintEvents: %w", err)
+		return gcalService, nil
+	case "caldav":
+		client, err := caldav.New(e.config.CalDAV)
+		if err != nil {
+			return nil, err
 		}
+		return client, nil
+	case "graph":
+		client, err := graph.New(e.ctx, e.config.Graph, e.loader, e.graphTokenName())
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
 	}
+	return nil, fmt.Errorf("unknown backend %q in the config, want google, caldav or graph", e.config.Backend)
+}
 
-	return nil
+// graphTokenName names the file holding the Microsoft token. Each profile
+// signs in separately, as they may use different accounts.
+func (e *env) graphTokenName() string {
+	if e.opts.profile != "" {
+		return "graph-token-" + e.opts.profile + ".json"
+	}
+	return "graph-token.json"
 }
 
-// buildCalendarID constructs the calendar ID based on the username and default domain from config.
-func buildCalendarID(username string, configData *config.Config) string {
+// resolveCalendarIDs expands aliases and returns the calendar IDs name refers to.
+// A group alias gives one ID per member.
+func (e *env) resolveCalendarIDs(name string) ([]string, error) {
+	names, err := e.config.ResolveAlias(name)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(names))
+	for _, n := range names {
+		ids = append(ids, buildCalendarID(n, e.config, e.loader, e.opts.profile))
+	}
+	return ids, nil
+}
+
+// resolveSingleCalendarID is like resolveCalendarIDs, for commands that need exactly one calendar.
+func (e *env) resolveSingleCalendarID(name string) (string, error) {
+	ids, err := e.resolveCalendarIDs(name)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) != 1 {
+		return "", fmt.Errorf("%q is a group of %d calendars, pick a single user", name, len(ids))
+	}
+	return ids[0], nil
+}
+
+// buildCalendarID constructs the calendar ID from a full address, a friendly name from the config
+// or the cached calendar list, or a username in the default domain, if any, in that order.
+func buildCalendarID(username string, configData *config.Config, loader config.Loader, profile string) string {
 	if containsAt(username) {
 		return username
 	}
+	if id, ok := configData.Calendars[username]; ok {
+		return id
+	}
+	if id, ok := gcal.MatchCalendar(username, gcal.LoadCalendarCache(loader, profile)); ok {
+		return id
+	}
+	if configData.DefaultDomain == "" {
+		return username
+	}
 	return fmt.Sprintf("%s@%s", username, configData.DefaultDomain)
 }
 
@@ -111,7 +575,5 @@ func containsAt(s string) bool {
 }
 
 func main() {
-	if err := run(os.Args[1:]); err != nil {
-		log.Fatal(err)
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
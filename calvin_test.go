@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/gcal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configDir := filepath.Join(home, ".calvin")
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	configContent := `{"default_domain": "example.com", "default_username": "alice", "aliases": {"team": ["alice", "bob"]}}`
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(configContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{[]string{"version"}, exitOK, "calvin v", ""},
+		{[]string{"help"}, exitOK, "Commands:", ""},
+		{[]string{"help", "free"}, exitOK, "Usage: calvin free", ""},
+		{[]string{"stats", "-h"}, exitOK, "-json", ""},
+		{[]string{"help", "bogus"}, exitUsage, "", `unknown command "bogus"`},
+		{[]string{"stats", "--bogus"}, exitUsage, "", "flag provided but not defined"},
+		{[]string{"--bogus"}, exitUsage, "", "flag provided but not defined"},
+		{[]string{"version", "--timeout", "soon"}, exitUsage, "", "invalid value"},
+		{[]string{"search"}, exitUsage, "", "missing query"},
+		{[]string{"completion", "tcsh"}, exitUsage, "", "unsupported shell"},
+		{[]string{"completion", "zsh"}, exitOK, "#compdef calvin", ""},
+		{[]string{"config", "show"}, exitOK, `"default_username": "alice"`, ""},
+		{[]string{"alias", "list"}, exitOK, "team: alice, bob", ""},
+		{[]string{"__complete", "te"}, exitOK, "team", ""},
+		{[]string{"__complete", "alice", "tom"}, exitOK, "tomorrow", ""},
+		{[]string{"__complete", "--color", ""}, exitOK, "always", ""},
+		{[]string{"__complete", "free", "--m"}, exitOK, "--min", ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, &stdout, &stderr)
+		if code != tt.wantCode {
+			t.Errorf("run(%q) = %d, want %d, stderr: %s", tt.args, code, tt.wantCode, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.wantStdout) {
+			t.Errorf("run(%q) stdout = %q, want it to contain %q", tt.args, stdout.String(), tt.wantStdout)
+		}
+		if !strings.Contains(stderr.String(), tt.wantStderr) {
+			t.Errorf("run(%q) stderr = %q, want it to contain %q", tt.args, stderr.String(), tt.wantStderr)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home) // no config file
+	path := filepath.Join(home, "team.ics")
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\n" +
+		"DTSTART:20250101T090000Z\r\nDURATION:PT15M\r\nRRULE:FREQ=DAILY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if err := os.WriteFile(path, []byte(ics), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--source", "file://" + path, "--color", "never", "week"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run = %d, stderr: %s", code, stderr.String())
+	}
+	if n := strings.Count(stdout.String(), "Standup"); n != 7 {
+		t.Errorf("week listing shows the daily standup %d times, want 7:\n%s", n, stdout.String())
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"--source", filepath.Join(home, "missing.ics"), "today"}, &stdout, &stderr); code != exitError || !strings.Contains(stderr.String(), "no such file") {
+		t.Errorf("run with a missing source = %d, stderr: %s", code, stderr.String())
+	}
+}
+
+func TestProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configDir := filepath.Join(home, ".calvin")
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	configContent := `{"default_domain": "example.com", "default_username": "alice", "profiles": {
+		"client": {"backend": "graph", "default_domain": "client.example"},
+		"nextcloud": {"backend": "caldav", "caldav": {"url": "https://cloud.example.com/{user}/", "password": "secret"}}}}`
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(configContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{[]string{"--profile", "client", "config", "show"}, exitOK, `"default_domain": "client.example"`, ""},
+		{[]string{"config", "show"}, exitOK, `"password": "********"`, ""},
+		{[]string{"--profile", "client", "today"}, exitError, "", `no "client_id" under "graph"`},
+		{[]string{"--profile", "client", "auth", "status"}, exitOK, "Not logged in.", ""},
+		{[]string{"--profile", "bogus", "today"}, exitError, "", `no profile "bogus"`},
+		{[]string{"__complete", "--profile", ""}, exitOK, "client\nnextcloud", ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, &stdout, &stderr)
+		if code != tt.wantCode {
+			t.Errorf("run(%q) = %d, want %d, stderr: %s", tt.args, code, tt.wantCode, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.wantStdout) {
+			t.Errorf("run(%q) stdout = %q, want it to contain %q", tt.args, stdout.String(), tt.wantStdout)
+		}
+		if !strings.Contains(stderr.String(), tt.wantStderr) {
+			t.Errorf("run(%q) stderr = %q, want it to contain %q", tt.args, stderr.String(), tt.wantStderr)
+		}
+		if strings.Contains(stdout.String(), "secret") {
+			t.Errorf("run(%q) printed the CalDAV password", tt.args)
+		}
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantArgs string
+		wantGrep string
+	}{
+		{[]string{"alice", "--grep", "sync", "tomorrow"}, "alice tomorrow", "sync"},
+		{[]string{"--grep=sync", "alice"}, "alice", "sync"},
+		{[]string{"alice", "--", "--grep", "x"}, "alice --grep x", ""},
+	}
+	for _, tt := range tests {
+		var opts options
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addFilterFlags(fs, &opts)
+		args, err := parseInterspersed(fs, tt.args)
+		if err != nil {
+			t.Fatalf("parseInterspersed(%q) returned error: %v", tt.args, err)
+		}
+		if got := strings.Join(args, " "); got != tt.wantArgs || opts.filter.Grep != tt.wantGrep {
+			t.Errorf("parseInterspersed(%q) = %q with grep %q, want %q with grep %q", tt.args, got, opts.filter.Grep, tt.wantArgs, tt.wantGrep)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	apiErr := func(kind error, calendarID string) error {
+		return fmt.Errorf("gcal.ListAndPrintEvents: %w", &gcal.APIError{Kind: kind, CalendarID: calendarID, Err: errors.New("googleapi: Error")})
+	}
+	tests := []struct {
+		err     error
+		backend string
+		want    string
+	}{
+		{apiErr(gcal.ErrNotFound, "bob@example.com"), "google", "No calendar found for bob@example.com — check the username or your default_domain"},
+		{apiErr(gcal.ErrForbidden, "alice@example.com"), "google", "You don't have access to alice's calendar"},
+		{apiErr(gcal.ErrAuthExpired, ""), "google", "Your login expired, run calvin auth login"},
+		{apiErr(gcal.ErrAuthExpired, ""), "graph", "Your login expired, run calvin auth login"},
+		{apiErr(gcal.ErrAuthExpired, "alice@example.com"), "caldav", "The CalDAV server rejected your login, check the username and password in the config"},
+		{apiErr(gcal.ErrRateLimited, "alice@example.com"), "google", "Google Calendar is rate limiting requests, try again in a minute"},
+		{apiErr(gcal.ErrRateLimited, "alice@example.com"), "caldav", "The calendar server is rate limiting requests, try again in a minute"},
+		{apiErr(gcal.ErrRateLimited, ""), "ics", "The calendar source is rate limiting requests, try again in a minute"},
+		{hintf("reading rooms needs directory access: %w", apiErr(gcal.ErrForbidden, "")), "google", "reading rooms needs directory access: gcal.ListAndPrintEvents: googleapi: Error"},
+		{errors.New("disk full"), "google", "disk full"},
+	}
+	for _, tt := range tests {
+		got := explain(tt.err, "example.com", tt.backend)
+		if got.Error() != tt.want {
+			t.Errorf("explain(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+		if !errors.Is(got, tt.err) {
+			t.Errorf("explain(%v) does not wrap the original error", tt.err)
+		}
+	}
+}
+
+type fakeDirectory struct {
+	rooms []config.Room
+	calls int
+}
+
+func (f *fakeDirectory) ListRooms(ctx context.Context) ([]config.Room, error) {
+	f.calls++
+	return f.rooms, nil
+}
+
+func TestRooms(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	loader, err := config.NewFileLoader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := &fakeDirectory{rooms: []config.Room{{Email: "fjord@resource.example.com", Name: "Fjord", Building: "Oslo"}}}
+	newDirectory := func(config.Loader) (gcal.RoomDirectory, error) { return dir, nil }
+
+	e := &env{ctx: context.Background(), loader: loader, config: &config.Config{}, stderr: io.Discard}
+	for i := 0; i < 2; i++ {
+		rooms, err := e.rooms(newDirectory)
+		if err != nil || len(rooms) != 1 || rooms[0].Name != "Fjord" {
+			t.Fatalf("rooms() = %v, %v, want Fjord", rooms, err)
+		}
+	}
+	if dir.calls != 1 {
+		t.Errorf("directory was read %d times, want once and then the cache", dir.calls)
+	}
+	e.opts.profile = "other"
+	if _, err := e.rooms(newDirectory); err != nil || dir.calls != 2 {
+		t.Errorf("rooms() for another profile read the directory %d times, want it to have its own cache", dir.calls)
+	}
+	e.opts.profile = ""
+	e.opts.rooms.refresh = true
+	if _, err := e.rooms(newDirectory); err != nil || dir.calls != 3 {
+		t.Errorf("rooms() with refresh read the directory %d times, err %v", dir.calls, err)
+	}
+	e.config.Rooms = []config.Room{{Name: "Configured"}}
+	if rooms, _ := e.rooms(newDirectory); rooms[0].Name != "Configured" || dir.calls != 3 {
+		t.Errorf("rooms() did not prefer the config: %v", rooms)
+	}
+}
+
+func TestParseRoomArgs(t *testing.T) {
+	now := time.Date(2025, 1, 29, 10, 17, 30, 0, time.Local) // a Wednesday
+	tests := []struct {
+		args         []string
+		wantBuilding string
+		wantWindow   string
+	}{
+		{nil, "", "2025-01-29 10:17-11:17"},
+		{[]string{"14:00-15:30"}, "", "2025-01-29 14:00-15:30"},
+		{[]string{"oslo", "tomorrow", "14:00-15:00"}, "oslo", "2025-01-30 14:00-15:00"},
+		{[]string{"next", "friday", "9:00-10:00"}, "", "2025-01-31 09:00-10:00"},
+		{[]string{"bergen", "2025-02-03"}, "bergen", "2025-02-03 10:17-11:17"},
+	}
+	for _, tt := range tests {
+		building, window, err := parseRoomArgs(tt.args, now)
+		if err != nil {
+			t.Errorf("parseRoomArgs(%q) returned error: %v", tt.args, err)
+			continue
+		}
+		got := window.Start.Format("2006-01-02 15:04") + "-" + window.End.Format("15:04")
+		if building != tt.wantBuilding || got != tt.wantWindow {
+			t.Errorf("parseRoomArgs(%q) = %q, %s, want %q, %s", tt.args, building, got, tt.wantBuilding, tt.wantWindow)
+		}
+	}
+	if _, _, err := parseRoomArgs([]string{"15:00-14:00"}, now); err == nil {
+		t.Errorf("parseRoomArgs accepted a backwards time range")
+	}
+}
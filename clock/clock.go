@@ -0,0 +1,20 @@
+// Package clock abstracts time so that long-running loops, such as the
+// reminder watcher and the metrics exporter, can be driven by a fake clock in
+// tests. See package clocktest for the fake.
+package clock
+
+import "time"
+
+// Clock tells the time and waits.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
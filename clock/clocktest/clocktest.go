@@ -0,0 +1,58 @@
+// Package clocktest provides a fake clock.Clock for tests.
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake only moves when Advance is called. Every call to After is reported on
+// Waits, so tests can tell when the code under test is idle.
+type Fake struct {
+	Waits chan time.Duration
+
+	mu     sync.Mutex
+	now    time.Time
+	timers []timer
+}
+
+type timer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// New returns a fake clock set to now.
+func New(now time.Time) *Fake {
+	return &Fake{now: now, Waits: make(chan time.Duration, 100)}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, timer{at: c.now.Add(d), ch: ch})
+	c.Waits <- d
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the timers that are due.
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.at.After(c.now) {
+			t.ch <- c.now
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	c.timers = kept
+}
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/dateparse"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/graph"
+	"github.com/perbu/calvin/interval"
+	"github.com/perbu/calvin/stats"
+	"github.com/perbu/calvin/watch"
+	"golang.org/x/oauth2"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runView prints the events of a user for a day or a week. It also runs when
+// the first argument is not a command.
+func runView(e *env, args []string) error {
+	// a date as the first argument applies to the default user, as in "calvin week"
+	if len(args) > 0 && dateparse.IsDateWord(args[0]) {
+		username, err := e.userArg(nil, 0)
+		if err != nil {
+			return err
+		}
+		args = append([]string{username}, args...)
+	}
+	// if the there is one or more arguments, the first one is the username, if not, we fall back to the default username:
+	username, err := e.userArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{username}
+	}
+	// Parse username and date arguments
+	parseResult, err := dateparse.New().Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Build the full calendar IDs, a group alias gives several
+	calendarIDs, err := e.resolveCalendarIDs(username)
+	if err != nil {
+		return err
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+
+	loc := e.location()
+	if loc != nil {
+		fmt.Fprintln(e.stdout, "Using local timezone:", loc)
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+
+	// List and print events
+	for i, fullCalendarID := range calendarIDs {
+		if i > 0 {
+			fmt.Fprintln(e.stdout)
+		}
+		if parseResult.IsWeek {
+			// If it's a week request, list events for the entire week
+			if err := gcal.ListAndPrintEventsForWeek(e.ctx, gcalService, fullCalendarID, parseResult.WeekDays, e.config.DefaultDomain, loc, formatter); err != nil {
+				return fmt.Errorf("gcal.ListAndPrintEventsForWeek: %w", err)
+			}
+		} else {
+			// Otherwise, list events for a single day
+			if err := gcal.ListAndPrintEvents(e.ctx, gcalService, fullCalendarID, parseResult.Date, e.config.DefaultDomain, loc, formatter); err != nil {
+				return fmt.Errorf("gcal.ListAndPrintEvents: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// statusCommand returns a command that prints the current or next event as a
+// single line with a countdown.
+func statusCommand(mode gcal.StatusMode) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		username, err := e.userArg(args, 0)
+		if err != nil {
+			return err
+		}
+		gcalService, err := e.service()
+		if err != nil {
+			return err
+		}
+		calendarID, err := e.resolveSingleCalendarID(username)
+		if err != nil {
+			return err
+		}
+		line, err := gcal.FormatStatus(e.ctx, gcalService, calendarID, mode, time.Now(), e.opts.format)
+		if err != nil {
+			return fmt.Errorf("gcal.FormatStatus: %w", err)
+		}
+		fmt.Fprintln(e.stdout, line)
+		return nil
+	}
+}
+
+func addStatusFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.format, "format", "", "Go template for the status line")
+	addFilterFlags(fs, o)
+}
+
+type watchOptions struct {
+	lead   time.Duration
+	poll   time.Duration
+	notify string
+	hook   string
+}
+
+func addWatchFlags(fs *flag.FlagSet, o *options) {
+	fs.DurationVar(&o.watch.lead, "lead", watch.DefaultLead, "How long before an event to notify")
+	fs.DurationVar(&o.watch.poll, "poll", watch.DefaultPollInterval, "How often to poll the calendar")
+	fs.StringVar(&o.watch.notify, "notify", "desktop", "Comma separated notifiers: desktop, bell")
+	fs.StringVar(&o.watch.hook, "hook", "", "Shell command to run for each reminder")
+	addFilterFlags(fs, o)
+}
+
+// runWatch runs the reminder daemon until interrupted.
+func runWatch(e *env, args []string) error {
+	username, err := e.userArg(args, 0)
+	if err != nil {
+		return err
+	}
+	opts := e.opts.watch
+
+	var notifiers watch.Multi
+	for _, name := range strings.Split(opts.notify, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "desktop":
+			notifiers = append(notifiers, watch.NotifySend{})
+		case "bell":
+			notifiers = append(notifiers, watch.Bell{W: e.stdout})
+		default:
+			return usagef("unknown notifier %q", name)
+		}
+	}
+	if opts.hook != "" {
+		notifiers = append(notifiers, watch.Hook{Command: opts.hook, Stdout: e.stdout, Stderr: e.stderr})
+	}
+	if len(notifiers) == 0 {
+		return fmt.Errorf("no notifiers configured")
+	}
+
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarID, err := e.resolveSingleCalendarID(username)
+	if err != nil {
+		return err
+	}
+	w := watch.New(gcalService, calendarID, notifiers)
+	w.Lead = opts.lead
+	w.PollInterval = opts.poll
+
+	fmt.Fprintf(e.stdout, "Watching %s, notifying %s before events. Press Ctrl-C to stop.\n", calendarID, opts.lead)
+	return w.Run(e.ctx)
+}
+
+func addSearchFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.from, "from", "", "First date (YYYY-MM-DD) to search, default 90 days ago")
+	fs.StringVar(&o.to, "to", "", "Last date (YYYY-MM-DD) to search, default 90 days ahead")
+	addFilterFlags(fs, o)
+}
+
+// runSearch searches a calendar for a free text query and prints matches grouped by date.
+func runSearch(e *env, args []string) error {
+	if len(args) < 1 {
+		return usagef("missing query")
+	}
+	query := args[0]
+	username, err := e.userArg(args, 1)
+	if err != nil {
+		return err
+	}
+
+	today := gcal.StartOfDay(time.Now(), time.Local)
+	from, to := today.AddDate(0, 0, -90), today.AddDate(0, 0, 90)
+	if e.opts.from != "" {
+		if from, err = time.ParseInLocation("2006-01-02", e.opts.from, time.Local); err != nil {
+			return usagef("invalid --from date: %v", err)
+		}
+	}
+	if e.opts.to != "" {
+		if to, err = time.ParseInLocation("2006-01-02", e.opts.to, time.Local); err != nil {
+			return usagef("invalid --to date: %v", err)
+		}
+		to = to.AddDate(0, 0, 1) // include the last day
+	}
+
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := e.resolveCalendarIDs(username)
+	if err != nil {
+		return err
+	}
+	for _, calendarID := range calendarIDs {
+		if err := gcal.SearchAndPrintEvents(e.ctx, gcalService, calendarID, query, from, to, e.config.DefaultDomain, e.location(), formatter); err != nil {
+			return fmt.Errorf("gcal.SearchAndPrintEvents: %w", err)
+		}
+	}
+	return nil
+}
+
+// runCalendars lists the calendars available to the user and caches the list for
+// resolving friendly names.
+func runCalendars(e *env, args []string) error {
+	backend, err := e.backend()
+	if err != nil {
+		return err
+	}
+	entries, err := backend.ListCalendars(e.ctx)
+	if err != nil {
+		return fmt.Errorf("ListCalendars: %w", err)
+	}
+	if e.opts.source == "" {
+		if err := gcal.SaveCalendarCache(e.loader, e.opts.profile, entries); err != nil {
+			fmt.Fprintf(e.stderr, "Warning: could not cache calendar list: %v\n", err)
+		}
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	return gcal.PrintCalendars(entries, formatter)
+}
+
+// rangeArgs parses "[username] [range]" arguments, falling back to the default user.
+func (e *env) rangeArgs(args []string) ([]string, dateparse.Range, error) {
+	if len(args) == 0 {
+		username, err := e.userArg(args, 0)
+		if err != nil {
+			return nil, dateparse.Range{}, err
+		}
+		args = []string{username}
+	}
+	r, err := dateparse.New().ParseRange(args)
+	return args, r, err
+}
+
+func addStatsFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.jsonOutput, "json", false, "Print the report as JSON")
+	addFilterFlags(fs, o)
+}
+
+// runStats prints a meeting load report for a range of days.
+func runStats(e *env, args []string) error {
+	args, r, err := e.rangeArgs(args)
+	if err != nil {
+		return err
+	}
+	workStart, workEnd, err := e.config.WorkHours.Offsets()
+	if err != nil {
+		return err
+	}
+
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := e.resolveCalendarIDs(args[0])
+	if err != nil {
+		return err
+	}
+	var reports []stats.Report
+	for _, calendarID := range calendarIDs {
+		events, err := gcalService.ListEventsRange(e.ctx, calendarID, r.From, r.To)
+		if err != nil {
+			return fmt.Errorf("ListEventsRange: %w", err)
+		}
+
+		loc := time.Local
+		if !e.opts.local {
+			if calLoc, err := time.LoadLocation(events.TimeZone); err == nil {
+				loc = calLoc
+			}
+		}
+		reports = append(reports, stats.Compute(events, stats.Options{
+			CalendarID: calendarID,
+			From:       r.From,
+			To:         r.To,
+			Location:   loc,
+			WorkStart:  workStart,
+			WorkEnd:    workEnd,
+		}))
+	}
+
+	if e.opts.jsonOutput {
+		if len(reports) == 1 {
+			return reports[0].WriteJSON(e.stdout)
+		}
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Fprintln(e.stdout)
+		}
+		if err := report.WriteText(e.stdout, e.config.DefaultDomain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runConflicts prints double-bookings and back-to-back meetings for a range of days.
+func runConflicts(e *env, args []string) error {
+	args, r, err := e.rangeArgs(args)
+	if err != nil {
+		return err
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := e.resolveCalendarIDs(args[0])
+	if err != nil {
+		return err
+	}
+	for _, calendarID := range calendarIDs {
+		if err := gcal.ListAndPrintConflicts(e.ctx, gcalService, calendarID, r.From, r.To, e.location(), formatter); err != nil {
+			return fmt.Errorf("gcal.ListAndPrintConflicts: %w", err)
+		}
+	}
+	return nil
+}
+
+// recurringWindow is how far ahead runRecurring looks for active series.
+const recurringWindow = 28 * 24 * time.Hour
+
+// runRecurring lists the recurring series with instances in the next four weeks.
+func runRecurring(e *env, args []string) error {
+	username, err := e.userArg(args, 0)
+	if err != nil {
+		return err
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := e.resolveCalendarIDs(username)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, calendarID := range calendarIDs {
+		if err := gcal.ListAndPrintRecurring(e.ctx, gcalService, calendarID, now, now.Add(recurringWindow), e.location(), formatter); err != nil {
+			return fmt.Errorf("gcal.ListAndPrintRecurring: %w", err)
+		}
+	}
+	return nil
+}
+
+// runWhereis prints the working location of each calendar for a range of days.
+func runWhereis(e *env, args []string) error {
+	args, r, err := e.rangeArgs(args)
+	if err != nil {
+		return err
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := e.resolveCalendarIDs(args[0])
+	if err != nil {
+		return err
+	}
+	for _, calendarID := range calendarIDs {
+		if err := gcal.ListAndPrintWhereabouts(e.ctx, gcalService, calendarID, r.From, r.To, e.location(), formatter); err != nil {
+			return fmt.Errorf("gcal.ListAndPrintWhereabouts: %w", err)
+		}
+	}
+	return nil
+}
+
+// runAlias lists, adds or removes aliases in the config file.
+func runAlias(e *env, args []string) error {
+	if len(args) < 1 {
+		return usagef("missing subcommand")
+	}
+	aliases := e.config.Aliases
+	if aliases == nil {
+		aliases = make(map[string]config.Alias)
+		e.config.Aliases = aliases
+	}
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(e.stdout, "%s: %s\n", name, strings.Join(aliases[name], ", "))
+		}
+		return nil
+	case "add":
+		if len(args) < 3 {
+			return usagef("wrong number of arguments")
+		}
+		aliases[args[1]] = config.Alias(args[2:])
+		if _, err := e.config.ResolveAlias(args[1]); err != nil {
+			return err
+		}
+	case "remove":
+		if len(args) != 2 {
+			return usagef("wrong number of arguments")
+		}
+		if _, ok := aliases[args[1]]; !ok {
+			return fmt.Errorf("no alias named %q", args[1])
+		}
+		delete(aliases, args[1])
+	default:
+		return usagef("unknown subcommand %q", args[0])
+	}
+	if err := e.loader.SaveAliases(aliases); err != nil {
+		return fmt.Errorf("loader.SaveAliases: %w", err)
+	}
+	return nil
+}
+
+type freeOptions struct {
+	minLength time.Duration
+}
+
+func addFreeFlags(fs *flag.FlagSet, o *options) {
+	fs.DurationVar(&o.free.minLength, "min", 30*time.Minute, "Shortest free slot to show")
+}
+
+// runFree prints the times within working hours of a day when all the given
+// users are free. Users are separated by commas and may be aliases.
+func runFree(e *env, args []string) error {
+	users, err := e.userArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{users}
+	}
+	parseResult, err := dateparse.New().Parse(args)
+	if err != nil {
+		return err
+	}
+	if parseResult.IsWeek {
+		return usagef("free looks at a single day, not a week")
+	}
+	workStart, workEnd, err := e.config.WorkHours.Offsets()
+	if err != nil {
+		return err
+	}
+
+	var calendarIDs []string
+	for _, user := range strings.Split(users, ",") {
+		ids, err := e.resolveCalendarIDs(strings.TrimSpace(user))
+		if err != nil {
+			return err
+		}
+		calendarIDs = append(calendarIDs, ids...)
+	}
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+
+	d := parseResult.Date
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local)
+	window := interval.Interval{Start: gcal.AtClock(day, workStart), End: gcal.AtClock(day, workEnd)}
+	if err := gcal.ListAndPrintFreeSlots(e.ctx, gcalService, calendarIDs, window, e.opts.free.minLength, formatter); err != nil {
+		return fmt.Errorf("gcal.ListAndPrintFreeSlots: %w", err)
+	}
+	return nil
+}
+
+type addOptions struct {
+	calendar    string
+	date        string
+	at          string
+	duration    time.Duration
+	allDay      bool
+	with        string
+	location    string
+	description string
+}
+
+func addAddFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.add.calendar, "calendar", "", "User or calendar to add the event to, default the default user")
+	fs.StringVar(&o.add.date, "date", "today", "Day of the event, e.g. tomorrow, friday or 2025-12-24")
+	fs.StringVar(&o.add.at, "at", "", "Start time as HH:MM, required unless --all-day is set")
+	fs.DurationVar(&o.add.duration, "duration", 30*time.Minute, "Length of the event")
+	fs.BoolVar(&o.add.allDay, "all-day", false, "Create an all-day event")
+	fs.StringVar(&o.add.with, "with", "", "Comma separated attendees, usernames or aliases")
+	fs.StringVar(&o.add.location, "location", "", "Location of the event")
+	fs.StringVar(&o.add.description, "description", "", "Description of the event")
+}
+
+// runAdd creates an event. It needs a token with write access, see "calvin auth login --write".
+func runAdd(e *env, args []string) error {
+	if len(args) == 0 {
+		return usagef("missing title")
+	}
+	opts := e.opts.add
+	user := opts.calendar
+	if user == "" {
+		var err error
+		if user, err = e.userArg(nil, 0); err != nil {
+			return err
+		}
+	}
+	calendarID, err := e.resolveSingleCalendarID(user)
+	if err != nil {
+		return err
+	}
+	parseResult, err := dateparse.New().Parse(append([]string{user}, strings.Fields(opts.date)...))
+	if err != nil {
+		return usagef("invalid --date: %v", err)
+	}
+	if parseResult.IsWeek {
+		return usagef("--date must be a single day")
+	}
+
+	event := &gcal.Event{
+		Summary:     strings.Join(args, " "),
+		Location:    opts.location,
+		Description: opts.description,
+	}
+	d := parseResult.Date
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local)
+	if opts.allDay {
+		event.Start, event.End, event.AllDay = day, day.AddDate(0, 0, 1), true
+	} else {
+		at, err := time.Parse("15:04", opts.at)
+		if err != nil {
+			return usagef("--at must be a time like 14:30")
+		}
+		start := day.Add(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+		event.Start, event.End = start, start.Add(opts.duration)
+	}
+	if opts.with != "" {
+		for _, name := range strings.Split(opts.with, ",") {
+			ids, err := e.resolveCalendarIDs(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				event.Attendees = append(event.Attendees, gcal.Attendee{Email: id})
+			}
+		}
+	}
+
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	created, err := gcalService.InsertEvent(e.ctx, calendarID, event)
+	if errors.Is(err, gcal.ErrForbidden) {
+		return hintf("creating events in %s needs write access, run 'calvin auth login --write': %w", calendarID, err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Created %q in %s: %s\n", created.Summary, calendarID, created.HTMLLink)
+	return nil
+}
+
+func addAuthFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.access.Write, "write", false, "With login, also allow calvin to create events")
+	fs.BoolVar(&o.access.Directory, "rooms", false, "With login, also allow calvin to read meeting rooms from the directory")
+}
+
+// runAuth logs in to Google Calendar, or to Microsoft 365 with the graph
+// backend, shows the stored token or removes it.
+func runAuth(e *env, args []string) error {
+	if len(args) != 1 {
+		return usagef("expected one of login, status or logout")
+	}
+	graphBackend := e.config.Backend == "graph"
+	switch args[0] {
+	case "login":
+		if graphBackend {
+			if err := graph.Login(e.ctx, e.config.Graph, e.loader, e.graphTokenName(), e.opts.access.Write, e.stdout); err != nil {
+				return err
+			}
+		} else if err := gcal.Login(e.ctx, e.loader, e.opts.access, e.stdout); err != nil {
+			return fmt.Errorf("gcal.Login: %w", err)
+		}
+		fmt.Fprintln(e.stdout, "Logged in.")
+	case "status":
+		load := e.loader.LoadToken
+		if graphBackend {
+			load = func() ([]byte, error) { return e.loader.LoadTokenFile(e.graphTokenName()) }
+		}
+		b, err := load()
+		if err != nil {
+			fmt.Fprintln(e.stdout, "Not logged in.")
+			return nil
+		}
+		var tok oauth2.Token
+		if err := json.Unmarshal(b, &tok); err != nil {
+			return fmt.Errorf("unmarshalling token: %w", err)
+		}
+		fmt.Fprintln(e.stdout, "Logged in.")
+		if !tok.Expiry.IsZero() {
+			fmt.Fprintln(e.stdout, "Access token expires:", tok.Expiry.Local().Format("2006-01-02 15:04"))
+		}
+		if tok.RefreshToken != "" {
+			fmt.Fprintln(e.stdout, "Refresh token: present, calvin renews access automatically")
+		}
+	case "logout":
+		remove := e.loader.RemoveToken
+		if graphBackend {
+			remove = func() error { return e.loader.RemoveTokenFile(e.graphTokenName()) }
+		}
+		if err := remove(); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, "Logged out.")
+	default:
+		return usagef("unknown subcommand %q", args[0])
+	}
+	return nil
+}
+
+// maskPassword hides a configured password from config show.
+func maskPassword(password string) string {
+	if password == "" {
+		return ""
+	}
+	return "********"
+}
+
+// runConfig prints where the configuration lives or the configuration itself.
+func runConfig(e *env, args []string) error {
+	if len(args) != 1 {
+		return usagef("expected path or show")
+	}
+	switch args[0] {
+	case "path":
+		dir, ok := e.loader.(interface{ Dir() string })
+		if !ok {
+			return fmt.Errorf("config is not stored in a directory")
+		}
+		fmt.Fprintln(e.stdout, filepath.Join(dir.Dir(), "config.json"))
+	case "show":
+		shown := *e.config
+		shown.CalDAV.Password = maskPassword(shown.CalDAV.Password)
+		shown.Profiles = make(map[string]config.Profile, len(e.config.Profiles))
+		for name, p := range e.config.Profiles {
+			if p.CalDAV != nil {
+				caldav := *p.CalDAV
+				caldav.Password = maskPassword(caldav.Password)
+				p.CalDAV = &caldav
+			}
+			shown.Profiles[name] = p
+		}
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(shown)
+	default:
+		return usagef("unknown subcommand %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/perbu/calvin/dateparse"
+	"github.com/perbu/calvin/gcal"
+	"sort"
+	"strings"
+)
+
+// The completion scripts hand the words typed so far to "calvin __complete",
+// which prints one candidate per line.
+const bashCompletion = `# bash completion for calvin
+_calvin() {
+    local IFS=$'\n'
+    COMPREPLY=($(calvin __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _calvin calvin
+`
+
+const zshCompletion = `#compdef calvin
+_calvin() {
+    local -a candidates
+    candidates=("${(@f)$(calvin __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    compadd -a candidates
+}
+compdef _calvin calvin
+`
+
+const fishCompletion = `# fish completion for calvin
+function __calvin_complete
+    set -l tokens (commandline -opc)
+    calvin __complete $tokens[2..-1] (commandline -ct | string collect --allow-empty) 2>/dev/null
+end
+complete -c calvin -f -a '(__calvin_complete)'
+`
+
+// runCompletion prints the completion script for a shell.
+func runCompletion(e *env, args []string) error {
+	if len(args) != 1 {
+		return usagef("expected bash, zsh or fish")
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Fprint(e.stdout, bashCompletion)
+	case "zsh":
+		fmt.Fprint(e.stdout, zshCompletion)
+	case "fish":
+		fmt.Fprint(e.stdout, fishCompletion)
+	default:
+		return usagef("unsupported shell %q, use bash, zsh or fish", args[0])
+	}
+	return nil
+}
+
+// runComplete prints the completion candidates for the last word in args,
+// which is the word being completed and may be empty.
+func runComplete(e *env, args []string) error {
+	for _, c := range complete(e, args) {
+		fmt.Fprintln(e.stdout, c)
+	}
+	return nil
+}
+
+// complete returns the candidates for the last word in words, filtered by what
+// has been typed of it.
+func complete(e *env, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+
+	// Find the command and its positional arguments, skipping flags and their values.
+	var opts options
+	var cmd *command
+	fs := flag.NewFlagSet("calvin", flag.ContinueOnError)
+	addGlobalFlags(fs, &opts)
+	var positional []string
+	for i := 0; i < len(words)-1; i++ {
+		w := words[i]
+		if strings.HasPrefix(w, "-") {
+			if takesValue(fs, w) {
+				i++
+			}
+			continue
+		}
+		if cmd == nil {
+			cmd = lookupCommand(w)
+			if cmd == nil {
+				cmd = viewCommand
+				positional = append(positional, w)
+			}
+			fs = cmd.flagSet(&opts)
+			continue
+		}
+		positional = append(positional, w)
+	}
+
+	var candidates []string
+	switch {
+	case len(words) > 1 && takesValue(fs, words[len(words)-2]):
+		candidates = flagValues(e, strings.TrimLeft(words[len(words)-2], "-"))
+	case strings.HasPrefix(current, "-"):
+		fs.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "--"+f.Name)
+		})
+	case cmd == nil:
+		for _, c := range commands {
+			if !c.hidden {
+				candidates = append(candidates, c.name)
+			}
+		}
+		candidates = append(candidates, usernames(e)...)
+	case cmd.complete != nil:
+		candidates = cmd.complete(e, positional)
+	}
+	return filterPrefix(candidates, current)
+}
+
+// takesValue reports whether w is a flag that consumes the next word.
+func takesValue(fs *flag.FlagSet, w string) bool {
+	name := strings.TrimLeft(w, "-")
+	if !strings.HasPrefix(w, "-") || strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// flagValues returns the known values of a flag.
+func flagValues(e *env, name string) []string {
+	switch name {
+	case "profile":
+		var names []string
+		for name := range e.config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	case "color":
+		return []string{"auto", "always", "never"}
+	case "notify":
+		return []string{"desktop", "bell", "desktop,bell"}
+	}
+	return nil
+}
+
+// usernames returns the names calvin can resolve: aliases, friendly calendar
+// names, the default user and people seen as attendees. Addresses in the default
+// domain are shortened to the username.
+func usernames(e *env) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		name = strings.TrimSuffix(name, "@"+e.config.DefaultDomain)
+		if name == "" || strings.ContainsAny(name, " \t") || seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	add(e.config.DefaultUser)
+	for name := range e.config.Aliases {
+		add(name)
+	}
+	for name := range e.config.Calendars {
+		add(name)
+	}
+	for _, entry := range gcal.LoadCalendarCache(e.loader, e.opts.profile) {
+		add(entry.Nickname)
+		add(entry.Name)
+	}
+	for _, email := range gcal.LoadPeople(e.loader, e.opts.profile) {
+		add(email)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func completeView(e *env, args []string) []string {
+	if len(args) == 0 {
+		return usernames(e)
+	}
+	return dateparse.Keywords()
+}
+
+func completeUser(e *env, args []string) []string {
+	if len(args) == 0 {
+		return usernames(e)
+	}
+	return nil
+}
+
+func completeSearch(e *env, args []string) []string {
+	if len(args) == 1 {
+		return usernames(e)
+	}
+	return nil
+}
+
+func completeRange(e *env, args []string) []string {
+	if len(args) == 0 {
+		return usernames(e)
+	}
+	return []string{"this", "last", "next", "week", "month", "today"}
+}
+
+func completeAlias(e *env, args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"list", "add", "remove"}
+	case args[0] == "add" && len(args) >= 2:
+		return usernames(e)
+	case args[0] == "remove" && len(args) == 1:
+		var names []string
+		for name := range e.config.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return nil
+}
+
+func completeAuth(e *env, args []string) []string {
+	if len(args) == 0 {
+		return []string{"login", "status", "logout"}
+	}
+	return nil
+}
+
+func completeConfig(e *env, args []string) []string {
+	if len(args) == 0 {
+		return []string{"path", "show"}
+	}
+	return nil
+}
+
+func completeHelp(e *env, args []string) []string {
+	var names []string
+	if len(args) == 0 {
+		for _, c := range commands {
+			if !c.hidden {
+				names = append(names, c.name)
+			}
+		}
+	}
+	return names
+}
+
+func completeShell(e *env, args []string) []string {
+	if len(args) == 0 {
+		return []string{"bash", "zsh", "fish"}
+	}
+	return nil
+}
+
+// filterPrefix returns the candidates that start with prefix.
+func filterPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
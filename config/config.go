@@ -5,14 +5,218 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Config holds the application configuration.
 type Config struct {
-	DefaultDomain string `json:"default_domain"`
-	DefaultUser   string `json:"default_username"`
-	Credentials   []byte
-	Token         []byte
+	// Backend selects the calendar server: "google", the default, "caldav"
+	// or "graph".
+	Backend       string    `json:"backend"`
+	CalDAV        CalDAV    `json:"caldav"`
+	Graph         Graph     `json:"graph"`
+	DefaultDomain string    `json:"default_domain"`
+	DefaultUser   string    `json:"default_username"`
+	Templates     Templates `json:"templates"`
+	Color         string    `json:"color"` // auto, always or never
+	Theme         Theme     `json:"theme"`
+	WorkHours     WorkHours `json:"work_hours"`
+	// Calendars maps friendly names to calendar IDs, e.g. "holidays" to a
+	// long @group.v.calendar.google.com address.
+	Calendars map[string]string `json:"calendars"`
+	// Aliases maps short names to a user or address, or to a group of them.
+	Aliases map[string]Alias `json:"aliases"`
+	// Rooms lists the bookable meeting rooms. If empty, calvin reads them from
+	// the Workspace directory.
+	Rooms []Room `json:"rooms"`
+	// Profiles are alternative settings selected with --profile, e.g. a
+	// partner's Exchange calendars next to your own Google Calendar.
+	Profiles    map[string]Profile `json:"profiles,omitempty"`
+	Credentials []byte             `json:"-"`
+	Token       []byte             `json:"-"`
+}
+
+// CalDAV configures the CalDAV backend, for servers such as Nextcloud or Fastmail.
+type CalDAV struct {
+	// URL is the calendar collection to read. {user} is replaced by the user
+	// name and {email} by the full address, e.g.
+	// "https://cloud.example.com/remote.php/dav/calendars/{user}/personal/".
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"` // CALVIN_CALDAV_PASSWORD overrides it
+}
+
+// Graph configures the Microsoft Graph backend, for Microsoft 365 and Outlook
+// calendars.
+type Graph struct {
+	// ClientID is the application ID of an Entra ID app registration that
+	// allows public client flows and has delegated calendar permissions.
+	ClientID string `json:"client_id"`
+	Tenant   string `json:"tenant"`    // directory ID or domain, default "common"
+	URL      string `json:"url"`       // API root, default https://graph.microsoft.com/v1.0
+	LoginURL string `json:"login_url"` // sign-in host, default https://login.microsoftonline.com
+}
+
+// Profile holds settings that replace those at the top level of the config
+// when the profile is selected. Empty fields keep the top-level value.
+type Profile struct {
+	Backend       string  `json:"backend"`
+	CalDAV        *CalDAV `json:"caldav,omitempty"`
+	Graph         *Graph  `json:"graph,omitempty"`
+	DefaultDomain string  `json:"default_domain"`
+	DefaultUser   string  `json:"default_username"`
+}
+
+// WithProfile returns a copy of the config with the settings of the named
+// profile applied.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no profile %q in the config", name)
+	}
+	applied := *c
+	if p.Backend != "" {
+		applied.Backend = p.Backend
+	}
+	if p.CalDAV != nil {
+		applied.CalDAV = *p.CalDAV
+	}
+	if p.Graph != nil {
+		applied.Graph = *p.Graph
+	}
+	if p.DefaultDomain != "" {
+		applied.DefaultDomain = p.DefaultDomain
+	}
+	if p.DefaultUser != "" {
+		applied.DefaultUser = p.DefaultUser
+	}
+	return &applied, nil
+}
+
+// Templates holds optional Go text/template strings overriding calvin's output.
+// Empty fields keep the built-in format.
+type Templates struct {
+	Day    string `json:"day"`    // header of the day view
+	Week   string `json:"week"`   // header of the week view
+	Header string `json:"header"` // per-day header inside the week view
+	Event  string `json:"event"`  // one line per event
+}
+
+// Theme holds color specs for output elements, such as "yellow+bold" or "hiblack".
+// Empty fields keep the built-in colors.
+type Theme struct {
+	Header    string `json:"header"`
+	Summary   string `json:"summary"`
+	Time      string `json:"time"`
+	Attendees string `json:"attendees"`
+	Warning   string `json:"warning"`
+	Declined  string `json:"declined"` // summary of events the calendar owner declined
+	AllDay    string `json:"all_day"`
+	Focus     string `json:"focus"` // summary of focus time blocks
+}
+
+// Room is a bookable resource calendar, such as a meeting room.
+type Room struct {
+	Email    string   `json:"email"` // the resource calendar ID
+	Name     string   `json:"name"`
+	Building string   `json:"building"`
+	Floor    string   `json:"floor"`
+	Capacity int      `json:"capacity"`
+	Features []string `json:"features"` // e.g. "Video conferencing", "Whiteboard"
+}
+
+// WorkHours is the working day used by reports, as "15:04" clock times.
+// Monday through Friday are working days.
+type WorkHours struct {
+	Start string `json:"start"` // default 09:00
+	End   string `json:"end"`   // default 17:00
+}
+
+// Offsets returns the start and end of the working day as offsets from midnight.
+func (w WorkHours) Offsets() (start, end time.Duration, err error) {
+	parse := func(s, fallback string) (time.Duration, error) {
+		if s == "" {
+			s = fallback
+		}
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid work hours %q: %w", s, err)
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+	if start, err = parse(w.Start, "09:00"); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parse(w.End, "17:00"); err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("work hours end %s is not after start %s", w.End, w.Start)
+	}
+	return start, end, nil
+}
+
+// Alias is what an alias expands to: a single user or address, or a group of
+// users, addresses and other aliases. In JSON a single target is a string and a
+// group is a list of strings.
+type Alias []string
+
+// UnmarshalJSON accepts either a string or a list of strings.
+func (a *Alias) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Alias{single}
+		return nil
+	}
+	var group []string
+	if err := json.Unmarshal(b, &group); err != nil {
+		return fmt.Errorf("alias must be a string or a list of strings: %w", err)
+	}
+	*a = group
+	return nil
+}
+
+// MarshalJSON writes a single target as a string and a group as a list.
+func (a Alias) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// maxAliasDepth bounds how deeply groups may refer to other aliases.
+const maxAliasDepth = 10
+
+// ResolveAlias expands name into the users or addresses it refers to, following
+// group members that are aliases themselves. A name that is not an alias
+// resolves to itself. Duplicates are removed, keeping the first occurrence.
+func (c *Config) ResolveAlias(name string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	var expand func(name string, depth int) error
+	expand = func(name string, depth int) error {
+		if depth > maxAliasDepth {
+			return fmt.Errorf("alias %q is nested too deeply or refers to itself", name)
+		}
+		targets, ok := c.Aliases[name]
+		if !ok || (len(targets) == 1 && targets[0] == name) {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+			return nil
+		}
+		for _, t := range targets {
+			if err := expand(t, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := expand(name, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 // Loader defines methods to load configuration, credentials, and token.
@@ -21,6 +225,15 @@ type Loader interface {
 	LoadCredentials() ([]byte, error)
 	LoadToken() ([]byte, error)
 	SaveToken(token []byte) error
+	RemoveToken() error
+	// LoadTokenFile, SaveTokenFile and RemoveTokenFile store the tokens of
+	// other backends, such as "graph-token.json", next to the Google token.
+	LoadTokenFile(name string) ([]byte, error)
+	SaveTokenFile(name string, token []byte) error
+	RemoveTokenFile(name string) error
+	LoadCache(name string) ([]byte, error)
+	SaveCache(name string, data []byte) error
+	SaveAliases(aliases map[string]Alias) error
 }
 
 // FileLoader implements Loader by reading from the filesystem.
@@ -65,22 +278,95 @@ func (f *FileLoader) LoadCredentials() ([]byte, error) {
 
 // LoadToken reads the token.json file.
 func (f *FileLoader) LoadToken() ([]byte, error) {
-	tokenPath := filepath.Join(f.configDir, "token.json")
-	bytes, err := os.ReadFile(tokenPath)
-	if err != nil {
-		return nil, err
-	}
-	return bytes, nil
+	return f.LoadTokenFile("token.json")
 }
 
 // SaveToken writes the token.json file.
 func (f *FileLoader) SaveToken(token []byte) error {
-	tokenPath := filepath.Join(f.configDir, "token.json")
+	return f.SaveTokenFile("token.json", token)
+}
+
+// RemoveToken deletes the token.json file. A missing token is not an error.
+func (f *FileLoader) RemoveToken() error {
+	return f.RemoveTokenFile("token.json")
+}
+
+// LoadTokenFile reads a token file in the config directory.
+func (f *FileLoader) LoadTokenFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(f.configDir, name))
+}
+
+// SaveTokenFile writes a token file in the config directory, readable only by the user.
+func (f *FileLoader) SaveTokenFile(name string, token []byte) error {
 	if err := os.MkdirAll(f.configDir, 0o700); err != nil {
 		return fmt.Errorf("unable to create config directory: %w", err)
 	}
-	if err := os.WriteFile(tokenPath, token, 0o600); err != nil {
+	if err := os.WriteFile(filepath.Join(f.configDir, name), token, 0o600); err != nil {
 		return fmt.Errorf("unable to save token: %w", err)
 	}
 	return nil
 }
+
+// RemoveTokenFile deletes a token file. A missing token is not an error.
+func (f *FileLoader) RemoveTokenFile(name string) error {
+	err := os.Remove(filepath.Join(f.configDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove token: %w", err)
+	}
+	return nil
+}
+
+// Dir returns the directory holding the config, credentials and token.
+func (f *FileLoader) Dir() string {
+	return f.configDir
+}
+
+// LoadCache reads a file previously stored with SaveCache.
+func (f *FileLoader) LoadCache(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(f.configDir, "cache", name))
+}
+
+// SaveCache stores data that can be recreated, such as API responses, in the
+// cache directory.
+func (f *FileLoader) SaveCache(name string, data []byte) error {
+	cacheDir := filepath.Join(f.configDir, "cache")
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return fmt.Errorf("unable to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, name), data, 0o600); err != nil {
+		return fmt.Errorf("unable to save cache: %w", err)
+	}
+	return nil
+}
+
+// SaveAliases replaces the aliases in config.json, leaving all other settings as they are.
+func (f *FileLoader) SaveAliases(aliases map[string]Alias) error {
+	configPath := filepath.Join(f.configDir, "config.json")
+	raw := make(map[string]json.RawMessage)
+	b, err := os.ReadFile(configPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("json.Unmarshal: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("os.ReadFile(%s): %w", configPath, err)
+	}
+
+	encoded, err := json.Marshal(aliases)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	raw["aliases"] = encoded
+	b, err = json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+	if err := os.MkdirAll(f.configDir, 0o700); err != nil {
+		return fmt.Errorf("unable to create config directory: %w", err)
+	}
+	if err := os.WriteFile(configPath, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("unable to save config: %w", err)
+	}
+	return nil
+}
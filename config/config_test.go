@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -25,3 +26,139 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("Expected DefaultDomain to be 'example.com', got '%s'", config.DefaultDomain)
 	}
 }
+
+func TestCache(t *testing.T) {
+	loader := &FileLoader{configDir: t.TempDir()}
+	if _, err := loader.LoadCache("calendars.json"); !os.IsNotExist(err) {
+		t.Errorf("LoadCache of a missing file: got %v, want a not exist error", err)
+	}
+	if err := loader.SaveCache("calendars.json", []byte(`[]`)); err != nil {
+		t.Fatalf("SaveCache failed: %v", err)
+	}
+	b, err := loader.LoadCache("calendars.json")
+	if err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	if string(b) != "[]" {
+		t.Errorf("LoadCache = %q, want %q", b, "[]")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	tempDir := t.TempDir()
+	configContent := `{
+  "default_domain": "example.com",
+  "aliases": {
+    "bob": "robert.smith@partner.com",
+    "team": ["alice", "bob", "carol"],
+    "everyone": ["team", "dave", "alice"],
+    "loop": ["loop2"],
+    "loop2": ["loop"]
+  }
+}`
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(configContent), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	loader := &FileLoader{configDir: tempDir}
+	config, err := loader.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		want      []string
+		expectErr bool
+	}{
+		{name: "alice", want: []string{"alice"}},
+		{name: "bob", want: []string{"robert.smith@partner.com"}},
+		{name: "team", want: []string{"alice", "robert.smith@partner.com", "carol"}},
+		{name: "everyone", want: []string{"alice", "robert.smith@partner.com", "carol", "dave"}},
+		{name: "loop", expectErr: true},
+	}
+	for _, tt := range tests {
+		got, err := config.ResolveAlias(tt.name)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("ResolveAlias(%q) error = %v, expectErr %v", tt.name, err, tt.expectErr)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ResolveAlias(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	config.Aliases["dave"] = Alias{"david.jones@example.net"}
+	delete(config.Aliases, "loop")
+	delete(config.Aliases, "loop2")
+	if err := loader.SaveAliases(config.Aliases); err != nil {
+		t.Fatalf("SaveAliases failed: %v", err)
+	}
+	saved, err := loader.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig after SaveAliases failed: %v", err)
+	}
+	if saved.DefaultDomain != "example.com" {
+		t.Errorf("SaveAliases lost default_domain, got %q", saved.DefaultDomain)
+	}
+	if len(saved.Aliases) != 4 || saved.Aliases["dave"][0] != "david.jones@example.net" || len(saved.Aliases["team"]) != 3 {
+		t.Errorf("SaveAliases wrote %v", saved.Aliases)
+	}
+}
+
+func TestRemoveToken(t *testing.T) {
+	loader := &FileLoader{configDir: t.TempDir()}
+	if err := loader.RemoveToken(); err != nil {
+		t.Errorf("RemoveToken without a token: %v", err)
+	}
+	if err := loader.SaveToken([]byte(`{}`)); err != nil {
+		t.Fatalf("SaveToken failed: %v", err)
+	}
+	if err := loader.RemoveToken(); err != nil {
+		t.Fatalf("RemoveToken failed: %v", err)
+	}
+	if _, err := loader.LoadToken(); err == nil {
+		t.Errorf("LoadToken after RemoveToken succeeded, want an error")
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	loader := &FileLoader{configDir: t.TempDir()}
+	if err := loader.SaveTokenFile("graph-token.json", []byte(`{"access_token":"x"}`)); err != nil {
+		t.Fatalf("SaveTokenFile failed: %v", err)
+	}
+	if _, err := loader.LoadToken(); err == nil {
+		t.Error("LoadToken found the Google token after saving another backend's")
+	}
+	if b, err := loader.LoadTokenFile("graph-token.json"); err != nil || string(b) != `{"access_token":"x"}` {
+		t.Errorf("LoadTokenFile = %q, %v", b, err)
+	}
+	if err := loader.RemoveTokenFile("graph-token.json"); err != nil {
+		t.Fatalf("RemoveTokenFile failed: %v", err)
+	}
+	if _, err := loader.LoadTokenFile("graph-token.json"); err == nil {
+		t.Error("LoadTokenFile after RemoveTokenFile succeeded, want an error")
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	c := &Config{
+		DefaultDomain: "example.com",
+		DefaultUser:   "alice",
+		Profiles: map[string]Profile{
+			"partner": {Backend: "graph", Graph: &Graph{ClientID: "abc"}, DefaultDomain: "partner.com"},
+		},
+	}
+	p, err := c.WithProfile("partner")
+	if err != nil {
+		t.Fatalf("WithProfile returned error: %v", err)
+	}
+	if p.Backend != "graph" || p.Graph.ClientID != "abc" || p.DefaultDomain != "partner.com" || p.DefaultUser != "alice" {
+		t.Errorf("WithProfile = %+v, want the partner backend and domain with alice as user", p)
+	}
+	if c.Backend != "" || c.DefaultDomain != "example.com" {
+		t.Errorf("WithProfile modified the original config: %+v", c)
+	}
+	if _, err := c.WithProfile("bogus"); err == nil {
+		t.Error("WithProfile accepted an unknown profile")
+	}
+}
@@ -71,15 +71,17 @@ func (p *DefaultParser) Parse(args []string) (ParseResult, error) {
 		}
 
 		// Handle "next monday", "next tuesday", etc.
-		weekday := strings.ToLower(args[2])
-		for i := 0; i < 7; i++ {
-			if strings.ToLower(result.Date.Weekday().String()) == weekday {
-				return result, nil
-			}
-			result.Date = result.Date.Add(24 * time.Hour)
+		date, ok := nextWeekday(result.Date, args[2])
+		if !ok {
+			return ParseResult{}, fmt.Errorf("invalid day of week: %s", args[2])
 		}
-		return ParseResult{}, fmt.Errorf("invalid day of week: %s", args[2])
+		result.Date = date
 	default:
+		if date, ok := nextWeekday(result.Date, args[1]); ok {
+			// a plain weekday means the same as "next <weekday>"
+			result.Date = date
+			break
+		}
 		parsed, err := time.Parse("2006-01-02", args[1])
 		if err == nil {
 			result.Date = parsed
@@ -90,6 +92,30 @@ func (p *DefaultParser) Parse(args []string) (ParseResult, error) {
 	return result, nil
 }
 
+// nextWeekday returns the first day from date on that falls on the named weekday.
+func nextWeekday(date time.Time, name string) (time.Time, bool) {
+	weekday := strings.ToLower(name)
+	for i := 0; i < 7; i++ {
+		if strings.ToLower(date.Weekday().String()) == weekday {
+			return date, true
+		}
+		date = date.Add(24 * time.Hour)
+	}
+	return time.Time{}, false
+}
+
+// IsDateWord reports whether word can begin the date arguments Parse or
+// ParseRange accept after the username: one of the Keywords or a YYYY-MM-DD date.
+func IsDateWord(word string) bool {
+	for _, k := range Keywords() {
+		if k == word {
+			return true
+		}
+	}
+	_, err := time.Parse("2006-01-02", word)
+	return err == nil
+}
+
 // getWeekDays returns an array of time.Time objects representing days in a week
 // offset is the number of days to add to the start date before calculating the week
 func getWeekDays(startDate time.Time, offset int) []time.Time {
@@ -112,3 +138,68 @@ func getWeekDays(startDate time.Time, offset int) []time.Time {
 
 	return weekDays
 }
+
+// Range is a half-open interval of whole days, [From, To).
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// ParseRange parses command-line arguments into a range of days. As with Parse, the
+// first argument is the username. Accepted forms are "today", "week", "this week",
+// "last week", "next week", "month", "this month", "last month", "next month",
+// a single YYYY-MM-DD date and two YYYY-MM-DD dates (inclusive). Without a
+// range argument the current week is used.
+func (p *DefaultParser) ParseRange(args []string) (Range, error) {
+	now := p.NowDate()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	monday := getWeekDays(today, 0)[0]
+	firstOfMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	words := strings.ToLower(strings.Join(args[min(1, len(args)):], " "))
+	switch words {
+	case "", "week", "this week":
+		return Range{From: monday, To: monday.AddDate(0, 0, 7)}, nil
+	case "today":
+		return Range{From: today, To: today.AddDate(0, 0, 1)}, nil
+	case "last week":
+		return Range{From: monday.AddDate(0, 0, -7), To: monday}, nil
+	case "next week":
+		return Range{From: monday.AddDate(0, 0, 7), To: monday.AddDate(0, 0, 14)}, nil
+	case "month", "this month":
+		return Range{From: firstOfMonth, To: firstOfMonth.AddDate(0, 1, 0)}, nil
+	case "last month":
+		return Range{From: firstOfMonth.AddDate(0, -1, 0), To: firstOfMonth}, nil
+	case "next month":
+		return Range{From: firstOfMonth.AddDate(0, 1, 0), To: firstOfMonth.AddDate(0, 2, 0)}, nil
+	}
+
+	dates := strings.Fields(words)
+	if len(dates) > 2 {
+		return Range{}, fmt.Errorf("invalid range: %q", words)
+	}
+	var r Range
+	for i, d := range dates {
+		parsed, err := time.ParseInLocation("2006-01-02", d, time.Local)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range: %q", words)
+		}
+		if i == 0 {
+			r.From = parsed
+		}
+		r.To = parsed.AddDate(0, 0, 1)
+	}
+	if !r.To.After(r.From) {
+		return Range{}, fmt.Errorf("invalid range: %s ends before it starts", words)
+	}
+	return r, nil
+}
+
+// Keywords returns the words Parse and ParseRange understand, for shell completion.
+func Keywords() []string {
+	words := []string{"today", "tomorrow", "yesterday", "week", "next", "this", "last", "month"}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		words = append(words, strings.ToLower(d.String()))
+	}
+	return words
+}
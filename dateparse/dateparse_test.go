@@ -61,6 +61,16 @@ func TestParse(t *testing.T) {
 			wantIsWeek: false,
 			expectErr:  false,
 		},
+		{
+			name: "Username and day of week",
+			args: []string{"eve", "thursday"},
+			nowFunc: func() time.Time {
+				return time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local) // Friday
+			},
+			wantDate:   time.Date(2025, 2, 6, 0, 0, 0, 0, time.Local),
+			wantIsWeek: false,
+			expectErr:  false,
+		},
 		{
 			name: "Username and week",
 			args: []string{"frank", "week"},
@@ -135,3 +145,64 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRange(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+	parser := New()
+	parser.NowDate = func() time.Time { return day(2025, 1, 31) } // Friday
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantFrom  time.Time
+		wantTo    time.Time
+		expectErr bool
+	}{
+		{name: "default", args: []string{"alice"}, wantFrom: day(2025, 1, 27), wantTo: day(2025, 2, 3)},
+		{name: "today", args: []string{"alice", "today"}, wantFrom: day(2025, 1, 31), wantTo: day(2025, 2, 1)},
+		{name: "last week", args: []string{"alice", "last", "week"}, wantFrom: day(2025, 1, 20), wantTo: day(2025, 1, 27)},
+		{name: "next week", args: []string{"alice", "next", "week"}, wantFrom: day(2025, 2, 3), wantTo: day(2025, 2, 10)},
+		{name: "this month", args: []string{"alice", "this", "month"}, wantFrom: day(2025, 1, 1), wantTo: day(2025, 2, 1)},
+		{name: "last month", args: []string{"alice", "last", "month"}, wantFrom: day(2024, 12, 1), wantTo: day(2025, 1, 1)},
+		{name: "single date", args: []string{"alice", "2025-03-04"}, wantFrom: day(2025, 3, 4), wantTo: day(2025, 3, 5)},
+		{name: "two dates", args: []string{"alice", "2025-03-01", "2025-03-31"}, wantFrom: day(2025, 3, 1), wantTo: day(2025, 4, 1)},
+		{name: "reversed dates", args: []string{"alice", "2025-03-31", "2025-03-01"}, expectErr: true},
+		{name: "garbage", args: []string{"alice", "fortnight"}, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parser.ParseRange(tt.args)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseRange() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+			if !r.From.Equal(tt.wantFrom) || !r.To.Equal(tt.wantTo) {
+				t.Errorf("ParseRange() = [%v, %v), want [%v, %v)", r.From, r.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestIsDateWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"week", true},
+		{"tomorrow", true},
+		{"next", true},
+		{"friday", true},
+		{"this", true},
+		{"last", true},
+		{"2025-03-04", true},
+		{"alice", false},
+		{"2025-13-01", false},
+	}
+	for _, tt := range tests {
+		if got := IsDateWord(tt.word); got != tt.want {
+			t.Errorf("IsDateWord(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
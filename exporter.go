@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/exporter"
+)
+
+type exporterOptions struct {
+	interval time.Duration
+}
+
+func addExporterFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.serve.listen, "listen", "127.0.0.1:9464", "Address to listen on")
+	fs.DurationVar(&o.serve.cache, "cache", 5*time.Minute, "How long to reuse calendar responses")
+	fs.DurationVar(&o.exporter.interval, "interval", exporter.DefaultInterval, "How often to update the metrics")
+}
+
+// runExporter serves Prometheus metrics on the availability of the given
+// users at /metrics until interrupted.
+func runExporter(e *env, args []string) error {
+	users, err := e.userArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return usagef("unexpected argument %q", args[1])
+	}
+	var calendarIDs []string
+	for _, user := range strings.Split(users, ",") {
+		ids, err := e.resolveCalendarIDs(strings.TrimSpace(user))
+		if err != nil {
+			return err
+		}
+		calendarIDs = append(calendarIDs, ids...)
+	}
+	backend, err := e.backend()
+	if err != nil {
+		return err
+	}
+	exp := exporter.New(backend, calendarIDs, e.opts.serve.cache)
+	exp.Interval = e.opts.exporter.interval
+
+	go exp.Run(e.ctx)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", exp)
+	fmt.Fprintf(e.stdout, "Exporting metrics for %s at /metrics.\n", strings.Join(calendarIDs, ", "))
+	return e.listenAndServe(mux)
+}
@@ -0,0 +1,190 @@
+// Package exporter publishes the availability of a team as Prometheus metrics,
+// for wallboards and alerts.
+package exporter
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perbu/calvin/clock"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+const (
+	DefaultInterval = time.Minute
+	// lookaheadDays is how many days ahead the next meeting is looked for.
+	lookaheadDays = 7
+)
+
+// Exporter reads the calendars every Interval and serves what it found as
+// metrics. Scrapes are answered from the last refresh and never reach the
+// calendar backend.
+type Exporter struct {
+	Service     gcal.CalendarService
+	CalendarIDs []string
+	Interval    time.Duration
+	Clock       clock.Clock
+
+	api    *apiMetrics
+	mu     sync.Mutex
+	people map[string]person // by calendar ID
+}
+
+// person holds the metrics of a calendar as of the last refresh.
+type person struct {
+	up           bool
+	refreshed    time.Time
+	inMeeting    bool
+	meetingHours float64
+	nextMeeting  time.Duration // until the next meeting starts, if hasNext
+	hasNext      bool
+}
+
+// New returns an exporter for the calendars. Requests to s are counted and
+// timed for the API metrics, and their results cached for ttl, so a short
+// interval does not mean more requests.
+func New(s gcal.CalendarService, calendarIDs []string, ttl time.Duration) *Exporter {
+	e := &Exporter{
+		CalendarIDs: calendarIDs,
+		Interval:    DefaultInterval,
+		Clock:       clock.Real,
+		api:         newAPIMetrics(),
+	}
+	now := func() time.Time { return e.Clock.Now() }
+	cached := gcal.Cached(&instrumented{CalendarService: s, metrics: e.api, now: now}, ttl)
+	cached.Now = now
+	e.Service = cached
+	return e
+}
+
+// Run refreshes the metrics every Interval until ctx is cancelled. Run returns
+// nil on cancellation.
+func (e *Exporter) Run(ctx context.Context) error {
+	for {
+		e.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-e.Clock.After(e.Interval):
+		}
+	}
+}
+
+// Refresh reads the calendars and recomputes their metrics. A calendar that
+// cannot be read is reported as down until a later refresh succeeds.
+func (e *Exporter) Refresh(ctx context.Context) {
+	now := e.Clock.Now()
+	today := gcal.StartOfDay(now, now.Location())
+	for _, calendarID := range e.CalendarIDs {
+		// day-aligned, so that refreshes within the cache TTL hit the cache
+		events, err := e.Service.ListEventsRange(ctx, calendarID, today, today.AddDate(0, 0, lookaheadDays))
+		p := person{}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("exporter: %s: %v", calendarID, err)
+			}
+		} else {
+			p = measure(events.Items, now)
+		}
+		e.mu.Lock()
+		if e.people == nil {
+			e.people = make(map[string]person)
+		}
+		e.people[calendarID] = p
+		e.mu.Unlock()
+	}
+}
+
+// measure computes the metrics of a calendar at now. Meetings are timed
+// events that block time and that the owner has not declined, as in calvin
+// stats.
+func measure(items []*gcal.Event, now time.Time) person {
+	p := person{up: true, refreshed: now}
+	var meetings []interval.Interval
+	for _, item := range items {
+		start, end, ok := gcal.EventTimes(item)
+		if !ok || gcal.IsDeclined(item) || item.Transparent || !gcal.IsMeeting(item) {
+			continue
+		}
+		meetings = append(meetings, interval.Interval{Start: start, End: end})
+		if !start.After(now) && end.After(now) {
+			p.inMeeting = true
+		}
+		if until := start.Sub(now); until > 0 && (!p.hasNext || until < p.nextMeeting) {
+			p.nextMeeting, p.hasNext = until, true
+		}
+	}
+	day := gcal.StartOfDay(now, now.Location())
+	today := interval.Interval{Start: day, End: day.AddDate(0, 0, 1)}
+	p.meetingHours = interval.Covered(interval.Merge(meetings), today).Hours()
+	return p
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.WriteMetrics(w); err != nil {
+		log.Printf("exporter: writing metrics: %v", err)
+	}
+}
+
+// WriteMetrics writes the metrics of the last refresh and of the API requests
+// so far in the Prometheus text format.
+func (e *Exporter) WriteMetrics(w io.Writer) error {
+	e.mu.Lock()
+	ids := make([]string, 0, len(e.people))
+	for id := range e.people {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	people := make([]person, len(ids))
+	for i, id := range ids {
+		people[i] = e.people[id]
+	}
+	e.mu.Unlock()
+
+	m := &metricWriter{w: w}
+	m.family("calvin_calendar_up", "gauge", "Whether the calendar could be read at the last refresh.")
+	for i, p := range people {
+		m.sample("calvin_calendar_up", boolValue(p.up), "calendar", ids[i])
+	}
+	m.family("calvin_last_refresh_timestamp_seconds", "gauge", "When the metrics of the calendar were last updated, as a Unix time.")
+	for i, p := range people {
+		if p.up {
+			m.sample("calvin_last_refresh_timestamp_seconds", float64(p.refreshed.Unix()), "calendar", ids[i])
+		}
+	}
+	m.family("calvin_in_meeting", "gauge", "Whether the calendar owner is in a meeting.")
+	for i, p := range people {
+		if p.up {
+			m.sample("calvin_in_meeting", boolValue(p.inMeeting), "calendar", ids[i])
+		}
+	}
+	m.family("calvin_meeting_hours_today", "gauge", "Hours of meetings today, counting overlapping meetings once.")
+	for i, p := range people {
+		if p.up {
+			m.sample("calvin_meeting_hours_today", p.meetingHours, "calendar", ids[i])
+		}
+	}
+	m.family("calvin_next_meeting_seconds", "gauge", "Seconds until the next meeting starts. Absent if there is none in the coming week.")
+	for i, p := range people {
+		if p.up && p.hasNext {
+			m.sample("calvin_next_meeting_seconds", p.nextMeeting.Seconds(), "calendar", ids[i])
+		}
+	}
+	e.api.write(m)
+	return m.err
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
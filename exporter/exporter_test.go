@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/clock/clocktest"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// fakeService serves fixed listings, taking latency of clock time per request.
+type fakeService struct {
+	gcal.CalendarService
+	clock    *clocktest.Fake
+	latency  time.Duration
+	listings map[string][]*gcal.Event
+}
+
+func (s *fakeService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	s.clock.Advance(s.latency)
+	items, ok := s.listings[calendarID]
+	if !ok {
+		return nil, &gcal.APIError{Kind: gcal.ErrNotFound, CalendarID: calendarID, Err: fmt.Errorf("googleapi: Error 404: Not Found")}
+	}
+	return &gcal.Events{Items: items}, nil
+}
+
+func (s *fakeService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return nil, nil
+}
+
+// at returns a time on Monday 2025-01-27 in UTC.
+func at(clock string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", "2025-01-27 "+clock)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var aliceEvents = []*gcal.Event{
+	{ID: "standup", Start: at("09:00"), End: at("09:15")},
+	{ID: "sync", Start: at("09:30"), End: at("10:30")},
+	{ID: "review", Start: at("10:00"), End: at("11:00")},
+	{ID: "skipped", Start: at("12:00"), End: at("13:00"),
+		Attendees: []gcal.Attendee{{Email: "alice@example.com", Response: gcal.ResponseDeclined, Self: true}}},
+	{ID: "reminder", Start: at("13:00"), End: at("13:30"), Transparent: true},
+	{ID: "focus", Start: at("14:00"), End: at("16:00"), EventType: gcal.EventTypeFocusTime},
+	{ID: "away", Start: at("00:00").AddDate(0, 0, 3), End: at("00:00").AddDate(0, 0, 4), AllDay: true, EventType: gcal.EventTypeOutOfOffice},
+	{ID: "late", Start: at("23:30"), End: at("23:59").Add(time.Hour)},
+	{ID: "tomorrow", Start: at("09:00").AddDate(0, 0, 1), End: at("10:00").AddDate(0, 0, 1)},
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		now           string
+		wantInMeeting bool
+		wantNext      time.Duration // zero for none
+	}{
+		{"08:00", false, time.Hour},
+		{"09:00", true, 30 * time.Minute},
+		{"09:45", true, 15 * time.Minute},
+		{"12:30", false, 11 * time.Hour},
+		{"14:30", false, 9 * time.Hour},
+		{"23:45", true, 9*time.Hour + 15*time.Minute},
+	}
+	for _, tt := range tests {
+		p := measure(aliceEvents, at(tt.now))
+		if !p.up || p.inMeeting != tt.wantInMeeting {
+			t.Errorf("at %s: up %v, in meeting %v, want %v", tt.now, p.up, p.inMeeting, tt.wantInMeeting)
+		}
+		if p.hasNext != (tt.wantNext != 0) || p.nextMeeting != tt.wantNext {
+			t.Errorf("at %s: next meeting in %v (%v), want %v", tt.now, p.nextMeeting, p.hasNext, tt.wantNext)
+		}
+		// 09:00-09:15, 09:30-11:00 and 23:30-24:00
+		if p.meetingHours != 2.25 {
+			t.Errorf("at %s: %v meeting hours today, want 2.25", tt.now, p.meetingHours)
+		}
+	}
+	if p := measure(nil, at("12:00")); p.hasNext || p.inMeeting || p.meetingHours != 0 {
+		t.Errorf("empty calendar: %+v", p)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	clock := clocktest.New(at("09:40"))
+	service := &fakeService{clock: clock, latency: 300 * time.Millisecond, listings: map[string][]*gcal.Event{
+		"alice@example.com": aliceEvents,
+		"bob@example.com":   {{ID: "lunch", Start: at("12:00"), End: at("13:00")}},
+	}}
+	e := New(service, []string{"alice@example.com", "bob@example.com", "nobody@example.com"}, 5*time.Minute)
+	e.Clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+	<-clock.Waits
+
+	want := []string{
+		`calvin_calendar_up{calendar="alice@example.com"} 1`,
+		`calvin_calendar_up{calendar="nobody@example.com"} 0`,
+		`calvin_in_meeting{calendar="alice@example.com"} 1`,
+		`calvin_in_meeting{calendar="bob@example.com"} 0`,
+		`calvin_meeting_hours_today{calendar="alice@example.com"} 2.25`,
+		`calvin_meeting_hours_today{calendar="bob@example.com"} 1`,
+		`calvin_next_meeting_seconds{calendar="alice@example.com"} 1200`,
+		`calvin_next_meeting_seconds{calendar="bob@example.com"} 8400`,
+		`calvin_api_requests_total{method="range"} 3`,
+		`calvin_api_errors_total{method="range",kind="not_found"} 1`,
+		`calvin_api_request_duration_seconds_bucket{method="range",le="0.25"} 0`,
+		`calvin_api_request_duration_seconds_bucket{method="range",le="0.5"} 3`,
+		`calvin_api_request_duration_seconds_bucket{method="range",le="+Inf"} 3`,
+		`calvin_api_request_duration_seconds_count{method="range"} 3`,
+		"# TYPE calvin_api_request_duration_seconds histogram",
+	}
+	checkMetrics(t, e, want, []string{`calvin_in_meeting{calendar="nobody@example.com"}`})
+
+	// alice's and bob's listings are cached, only the failed one is read again
+	clock.Advance(time.Minute)
+	<-clock.Waits
+	checkMetrics(t, e, []string{
+		`calvin_next_meeting_seconds{calendar="alice@example.com"} 1139.1`,
+		`calvin_api_requests_total{method="range"} 4`,
+	}, nil)
+
+	// alice's sync has ended and review is on, all calendars are read again
+	clock.Advance(50 * time.Minute)
+	<-clock.Waits
+	checkMetrics(t, e, []string{
+		`calvin_in_meeting{calendar="alice@example.com"} 1`,
+		`calvin_next_meeting_seconds{calendar="alice@example.com"} 46738.8`,
+		`calvin_api_requests_total{method="range"} 7`,
+		`calvin_api_errors_total{method="range",kind="not_found"} 3`,
+	}, nil)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v", err)
+	}
+}
+
+func checkMetrics(t *testing.T, e *Exporter, want, notWant []string) {
+	t.Helper()
+	var b strings.Builder
+	if err := e.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(b.String(), "\n") {
+		lines[line] = true
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Errorf("metrics lack %s:\n%s", line, b.String())
+		}
+	}
+	for _, prefix := range notWant {
+		if strings.Contains(b.String(), prefix) {
+			t.Errorf("metrics have %s:\n%s", prefix, b.String())
+		}
+	}
+}
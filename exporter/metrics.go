@@ -0,0 +1,213 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request duration histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// apiMetrics counts and times the requests to the calendar backend, by method.
+type apiMetrics struct {
+	mu        sync.Mutex
+	requests  map[string]float64
+	errors    map[[2]string]float64 // by method and error kind
+	durations map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		requests:  make(map[string]float64),
+		errors:    make(map[[2]string]float64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+func (m *apiMetrics) observe(method string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[method]++
+	if err != nil {
+		m.errors[[2]string{method, errorKind(err)}]++
+	}
+	h := m.durations[method]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		m.durations[method] = h
+	}
+	seconds := d.Seconds()
+	h.counts[sort.SearchFloat64s(latencyBuckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+// errorKind names the kind of a failed request for the errors counter.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, gcal.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, gcal.ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, gcal.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, gcal.ErrAuthExpired):
+		return "auth_expired"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "other"
+}
+
+func (m *apiMetrics) write(w *metricWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods := make([]string, 0, len(m.requests))
+	for method := range m.requests {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	w.family("calvin_api_requests_total", "counter", "Requests to the calendar backend.")
+	for _, method := range methods {
+		w.sample("calvin_api_requests_total", m.requests[method], "method", method)
+	}
+	w.family("calvin_api_errors_total", "counter", "Failed requests to the calendar backend, by kind of failure.")
+	keys := make([][2]string, 0, len(m.errors))
+	for key := range m.errors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		w.sample("calvin_api_errors_total", m.errors[key], "method", key[0], "kind", key[1])
+	}
+	w.family("calvin_api_request_duration_seconds", "histogram", "How long requests to the calendar backend took.")
+	for _, method := range methods {
+		h := m.durations[method]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			w.sample("calvin_api_request_duration_seconds_bucket", float64(cumulative), "method", method, "le", formatValue(le))
+		}
+		w.sample("calvin_api_request_duration_seconds_bucket", float64(h.count), "method", method, "le", "+Inf")
+		w.sample("calvin_api_request_duration_seconds_sum", h.sum, "method", method)
+		w.sample("calvin_api_request_duration_seconds_count", float64(h.count), "method", method)
+	}
+}
+
+// instrumented records the requests to a CalendarService in metrics.
+type instrumented struct {
+	gcal.CalendarService
+	metrics *apiMetrics
+	now     func() time.Time
+}
+
+func (s *instrumented) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	start := s.now()
+	events, err := s.CalendarService.ListEvents(ctx, calendarID, theDate)
+	s.metrics.observe("events", s.now().Sub(start), err)
+	return events, err
+}
+
+func (s *instrumented) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	start := s.now()
+	events, err := s.CalendarService.ListEventsRange(ctx, calendarID, from, to)
+	s.metrics.observe("range", s.now().Sub(start), err)
+	return events, err
+}
+
+func (s *instrumented) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	start := s.now()
+	events, err := s.CalendarService.SearchEvents(ctx, calendarID, query, from, to)
+	s.metrics.observe("search", s.now().Sub(start), err)
+	return events, err
+}
+
+func (s *instrumented) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	start := s.now()
+	events, err := s.CalendarService.ListSeries(ctx, calendarID, from, to)
+	s.metrics.observe("series", s.now().Sub(start), err)
+	return events, err
+}
+
+func (s *instrumented) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	start := s.now()
+	calendars, err := s.CalendarService.ListCalendars(ctx)
+	s.metrics.observe("calendars", s.now().Sub(start), err)
+	return calendars, err
+}
+
+func (s *instrumented) InsertEvent(ctx context.Context, calendarID string, event *gcal.Event) (*gcal.Event, error) {
+	start := s.now()
+	created, err := s.CalendarService.InsertEvent(ctx, calendarID, event)
+	s.metrics.observe("insert", s.now().Sub(start), err)
+	return created, err
+}
+
+func (s *instrumented) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	start := s.now()
+	busy, err := s.CalendarService.FreeBusy(ctx, calendarIDs, from, to)
+	s.metrics.observe("freebusy", s.now().Sub(start), err)
+	return busy, err
+}
+
+// metricWriter writes the Prometheus text format, keeping the first error.
+type metricWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (m *metricWriter) family(name, typ, help string) {
+	m.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample with labels given as name and value pairs.
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	if len(labels) > 0 {
+		b.WriteByte('}')
+	}
+	m.printf("%s %s\n", b.String(), formatValue(value))
+}
+
+func (m *metricWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
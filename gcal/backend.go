@@ -0,0 +1,45 @@
+package gcal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/interval"
+)
+
+// Owner returns the calendar ID if it is an address, for finding the owner's
+// attendance. Other IDs, such as URLs, have no known owner.
+func Owner(calendarID string) string {
+	if strings.Contains(calendarID, "@") {
+		return calendarID
+	}
+	return ""
+}
+
+// BusyFromEvents returns the busy times of each calendar in [from, to),
+// computed from the events list returns, for backends without a free/busy
+// query. Calendars that do not exist or cannot be read are left out.
+func BusyFromEvents(ctx context.Context, list func(ctx context.Context, calendarID string, from, to time.Time) (*Events, error), calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	busy := make(map[string][]interval.Interval)
+	window := interval.Interval{Start: from, End: to}
+	for _, id := range calendarIDs {
+		events, err := list(ctx, id, from, to)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrForbidden) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("querying free/busy: %w", err)
+		}
+		periods := []interval.Interval{}
+		for _, p := range Busy(events) {
+			if p, ok := p.Intersect(window); ok {
+				periods = append(periods, p)
+			}
+		}
+		busy[id] = periods
+	}
+	return busy, nil
+}
@@ -0,0 +1,113 @@
+package gcal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perbu/calvin/interval"
+)
+
+// CachedService wraps a CalendarService so that the results of reads are reused
+// until they are TTL old, for long-running modes that answer the same queries
+// repeatedly. Failed reads are not cached and creating events is passed
+// through. Cached listings are shared between callers, who must not modify
+// them. It is safe for concurrent use.
+type CachedService struct {
+	CalendarService
+	TTL time.Duration
+	Now func() time.Time // replaced in tests
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// Cached returns s with its reads cached for ttl.
+func Cached(s CalendarService, ttl time.Duration) *CachedService {
+	return &CachedService{CalendarService: s, TTL: ttl, Now: time.Now}
+}
+
+func (c *CachedService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error) {
+	return cached(c, cacheKey("events", calendarID, theDate), func() (*Events, error) {
+		return c.CalendarService.ListEvents(ctx, calendarID, theDate)
+	})
+}
+
+func (c *CachedService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	return cached(c, cacheKey("range", calendarID, from, to), func() (*Events, error) {
+		return c.CalendarService.ListEventsRange(ctx, calendarID, from, to)
+	})
+}
+
+func (c *CachedService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error) {
+	return cached(c, cacheKey("search", calendarID, query, from, to), func() (*Events, error) {
+		return c.CalendarService.SearchEvents(ctx, calendarID, query, from, to)
+	})
+}
+
+func (c *CachedService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	return cached(c, cacheKey("series", calendarID, from, to), func() (*Events, error) {
+		return c.CalendarService.ListSeries(ctx, calendarID, from, to)
+	})
+}
+
+func (c *CachedService) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	return cached(c, "calendars", func() ([]*Calendar, error) {
+		return c.CalendarService.ListCalendars(ctx)
+	})
+}
+
+func (c *CachedService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return cached(c, cacheKey("freebusy", strings.Join(calendarIDs, ","), from, to), func() (map[string][]interval.Interval, error) {
+		return c.CalendarService.FreeBusy(ctx, calendarIDs, from, to)
+	})
+}
+
+// cached returns the entry stored under key, or stores the result of read.
+// Expired entries are dropped whenever one is stored.
+func cached[T any](c *CachedService, key string, read func() (T, error)) (T, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	now := c.Now()
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value.(T), nil
+	}
+	value, err := read()
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.TTL)}
+	return value, nil
+}
+
+// cacheKey joins the arguments of a read. Times are compared as instants, but
+// their zone is kept as it decides how results are presented.
+func cacheKey(method string, args ...any) string {
+	var b strings.Builder
+	b.WriteString(method)
+	for _, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = t.Format(time.RFC3339Nano) + " " + t.Location().String()
+		}
+		fmt.Fprintf(&b, "\x00%v", arg)
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package gcal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perbu/calvin/config"
+)
+
+// calendarCacheName is the cache file holding the last fetched calendar list.
+const calendarCacheName = "calendars.json"
+
+// profileCacheName returns the name of a cache file for the config profile.
+// Each profile has its own, as they may use different accounts.
+func profileCacheName(name, profile string) string {
+	if profile == "" {
+		return name
+	}
+	base, ext, _ := strings.Cut(name, ".")
+	return base + "-" + profile + "." + ext
+}
+
+// SaveCalendarCache stores the calendar list of the profile so that
+// MatchCalendar can resolve friendly names without an API call.
+func SaveCalendarCache(loader config.Loader, profile string, entries []*Calendar) error {
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return loader.SaveCache(profileCacheName(calendarCacheName, profile), b)
+}
+
+// LoadCalendarCache returns the cached calendar list of the profile, or nil if
+// there is none.
+func LoadCalendarCache(loader config.Loader, profile string) []*Calendar {
+	b, err := loader.LoadCache(profileCacheName(calendarCacheName, profile))
+	if err != nil {
+		return nil
+	}
+	var entries []*Calendar
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+// MatchCalendar finds the calendar whose name or nickname equals name, ignoring case.
+func MatchCalendar(name string, entries []*Calendar) (string, bool) {
+	for _, e := range entries {
+		if strings.EqualFold(e.Nickname, name) || strings.EqualFold(e.Name, name) {
+			return e.ID, true
+		}
+	}
+	return "", false
+}
+
+// PrintCalendars prints the calendar list as a table. The primary calendar is marked with "*".
+func PrintCalendars(entries []*Calendar, f *Formatter) error {
+	if f == nil {
+		f = defaultFormatter()
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No calendars found."))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(f.writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tNAME\tID\tACCESS\tTIME ZONE\tCOLOR")
+	for _, e := range entries {
+		primary := ""
+		if e.Primary {
+			primary = "*"
+		}
+		name := e.Nickname
+		if name == "" {
+			name = e.Name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", primary, name, e.ID, e.AccessRole, e.TimeZone, e.Color)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,111 @@
+package gcal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/perbu/calvin/interval"
+)
+
+// Conflict is a pair of events that overlap, or follow each other without a gap.
+type Conflict struct {
+	A, B       *Event // A starts no later than B
+	Overlap    interval.Interval
+	BackToBack bool // B starts exactly when A ends
+}
+
+// FindConflicts returns the double-bookings and back-to-back meetings among
+// items. Only timed events that block the calendar owner's time are considered,
+// so declined events and events marked as free are ignored.
+func FindConflicts(items []*Event) []Conflict {
+	ivs, index := busyIntervals(items)
+	var conflicts []Conflict
+	for _, p := range interval.OverlappingPairs(ivs) {
+		conflicts = append(conflicts, Conflict{A: items[index[p.A]], B: items[index[p.B]], Overlap: p.Overlap})
+	}
+	for _, p := range interval.TouchingPairs(ivs) {
+		conflicts = append(conflicts, Conflict{A: items[index[p.A]], B: items[index[p.B]], BackToBack: true})
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		a, _, _ := EventTimes(conflicts[i].A)
+		b, _, _ := EventTimes(conflicts[j].A)
+		return a.Before(b)
+	})
+	return conflicts
+}
+
+// busyIntervals returns the intervals of the events that block time, along with
+// the index into items each interval came from.
+func busyIntervals(items []*Event) ([]interval.Interval, []int) {
+	var ivs []interval.Interval
+	var index []int
+	for i, item := range items {
+		start, end, ok := EventTimes(item)
+		if !ok || IsDeclined(item) || item.Transparent || item.EventType == EventTypeWorkingLocation {
+			continue
+		}
+		ivs = append(ivs, interval.Interval{Start: start, End: end})
+		index = append(index, i)
+	}
+	return ivs, index
+}
+
+// conflictMarks reports, per item, whether it overlaps or directly follows another event.
+func conflictMarks(items []*Event) (overlapping, backToBack map[*Event]bool) {
+	overlapping = make(map[*Event]bool)
+	backToBack = make(map[*Event]bool)
+	for _, c := range FindConflicts(items) {
+		if c.BackToBack {
+			backToBack[c.A], backToBack[c.B] = true, true
+		} else {
+			overlapping[c.A], overlapping[c.B] = true, true
+		}
+	}
+	return overlapping, backToBack
+}
+
+// ListAndPrintConflicts lists the events in [from, to) and prints every
+// double-booking and back-to-back pair, grouped by the day they happen.
+func ListAndPrintConflicts(ctx context.Context, s CalendarService, calendarID string, from, to time.Time, loc *time.Location, f *Formatter) error {
+	events, err := s.ListEventsRange(ctx, calendarID, from, to)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = defaultFormatter()
+	}
+
+	fmt.Fprintf(f.writer(), "Conflicts for %s from %s to %s\n",
+		f.styles["header"].Sprint(calendarID),
+		f.styles["header"].Sprint(from.Format("2006-01-02")),
+		f.styles["header"].Sprint(to.AddDate(0, 0, -1).Format("2006-01-02")),
+	)
+	conflicts := FindConflicts(events.Items)
+	if len(conflicts) == 0 {
+		fmt.Fprintln(f.writer(), "No conflicts found.")
+		return nil
+	}
+
+	var day string
+	for _, c := range conflicts {
+		date := eventDate(c.A, loc)
+		if d := date.Format("2006-01-02"); d != day {
+			day = d
+			header, err := f.Header(HeaderData{Date: date, CalendarID: calendarID, TimeZone: events.TimeZone})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(f.writer(), header)
+		}
+		a := f.styles["summary"].Sprint(EventSummary(c.A)) + formatTimeInfo(c.A, loc, f.styles["time"], f.styles["allday"])
+		b := f.styles["summary"].Sprint(EventSummary(c.B)) + formatTimeInfo(c.B, loc, f.styles["time"], f.styles["allday"])
+		if c.BackToBack {
+			fmt.Fprintf(f.writer(), " ~ %s is back-to-back with %s\n", a, b)
+		} else {
+			fmt.Fprintf(f.writer(), " %s %s overlaps %s by %s\n", f.styles["warning"].Sprint("!"), a, b, formatCountdown(c.Overlap.Duration()))
+		}
+	}
+	return nil
+}
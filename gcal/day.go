@@ -0,0 +1,25 @@
+package gcal
+
+import "time"
+
+// StartOfDay returns midnight of the day t falls on in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// LocalDay returns the bounds of the day t falls on in the local time zone,
+// for backends whose ListEvents is a ListEventsRange over that day.
+func LocalDay(t time.Time) (from, to time.Time) {
+	from = StartOfDay(t, time.Local)
+	return from, from.AddDate(0, 0, 1)
+}
+
+// AtClock returns the time of day clock, given as the time since midnight such
+// as a configured start of the working day, on the day t falls on in its
+// location. Unlike adding clock to midnight, this keeps the wall clock time on
+// days when the clocks change.
+func AtClock(t time.Time, clock time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, t.Location())
+}
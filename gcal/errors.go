@@ -0,0 +1,74 @@
+package gcal
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Kinds of API failures. Errors returned by GCalService match them with
+// errors.Is, and errors.As gives the *APIError with the details.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrForbidden   = errors.New("access denied")
+	ErrRateLimited = errors.New("rate limited")
+	ErrAuthExpired = errors.New("authorization expired")
+)
+
+// APIError is a failed API request of a known kind.
+type APIError struct {
+	Kind       error  // ErrNotFound, ErrForbidden, ErrRateLimited or ErrAuthExpired
+	CalendarID string // the calendar the request was about, empty if several or none
+	Err        error  // the error returned by the API client
+}
+
+func (e *APIError) Error() string   { return e.Err.Error() }
+func (e *APIError) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// classify turns err into an *APIError if it is an API error of a known kind.
+// Other errors are returned unchanged.
+func classify(calendarID string, err error) error {
+	if kind := errorKind(err); kind != nil {
+		return &APIError{Kind: kind, CalendarID: calendarID, Err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return ErrAuthExpired // the refresh token was revoked or has expired
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if strings.HasSuffix(item.Reason, "RateLimitExceeded") || item.Reason == "rateLimitExceeded" || item.Reason == "quotaExceeded" {
+				return ErrRateLimited
+			}
+		}
+	}
+	return StatusKind(apiErr.Code)
+}
+
+// StatusKind returns the kind of failure an HTTP status code means, the same
+// for every backend, or nil if it is none of the known kinds. A 401 means the
+// credentials were rejected, whether a token expired or a password is wrong.
+func StatusKind(code int) error {
+	switch code {
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotFound
+	case http.StatusUnauthorized:
+		return ErrAuthExpired
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
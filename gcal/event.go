@@ -0,0 +1,62 @@
+package gcal
+
+import "time"
+
+// Responses of attendees, as in Attendee.Response.
+const (
+	ResponseAccepted    = "accepted"
+	ResponseDeclined    = "declined"
+	ResponseTentative   = "tentative"
+	ResponseNeedsAction = "needsAction"
+)
+
+// Events is a listing of events from one calendar.
+type Events struct {
+	TimeZone   string // IANA name of the calendar's time zone, if known
+	AccessRole string // the caller's access to the calendar, e.g. AccessFreeBusy
+	Items      []*Event
+}
+
+// Event is a calendar event, independent of the backend it was read from.
+type Event struct {
+	ID            string
+	Summary       string
+	Description   string
+	Location      string
+	ConferenceURL string    // video call link, such as a Google Meet URL
+	HTMLLink      string    // the event in the backend's web interface
+	Start         time.Time // for all-day events midnight in the calendar's time zone
+	End           time.Time // exclusive
+	AllDay        bool
+	EventType     string // EventTypeOutOfOffice, EventTypeFocusTime, EventTypeWorkingLocation, or "" for ordinary events
+	// WorkingLocation is where the calendar owner works, for working location
+	// events, e.g. "Home" or "Oslo HQ, floor 3".
+	WorkingLocation  string
+	Transparent      bool   // marked as free, does not block time
+	Visibility       string // "private" or "confidential" if the details are hidden
+	Attendees        []Attendee
+	RecurringEventID string   // the series, for instances of recurring events
+	Recurrence       []string // RRULE, EXDATE and RDATE lines, for recurring series
+}
+
+// Attendee is a guest of an event.
+type Attendee struct {
+	Email     string
+	Name      string
+	Response  string // ResponseAccepted, ResponseDeclined, ResponseTentative or ResponseNeedsAction
+	Self      bool   // the owner of the calendar the event was listed from
+	Resource  bool   // a meeting room or other resource
+	Organizer bool
+}
+
+// Calendar is an entry in the user's list of calendars. The JSON names follow
+// the Google Calendar API, which earlier versions cached as is.
+type Calendar struct {
+	ID         string `json:"id"`
+	Name       string `json:"summary"`
+	Nickname   string `json:"summaryOverride,omitempty"` // the user's own name for it, if set
+	Primary    bool   `json:"primary,omitempty"`
+	AccessRole string `json:"accessRole"`
+	TimeZone   string `json:"timeZone"`
+	Color      string `json:"backgroundColor,omitempty"`
+}
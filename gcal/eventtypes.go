@@ -0,0 +1,151 @@
+package gcal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event types other than ordinary events, as reported in Event.EventType.
+const (
+	EventTypeOutOfOffice     = "outOfOffice"
+	EventTypeFocusTime       = "focusTime"
+	EventTypeWorkingLocation = "workingLocation"
+)
+
+// IsMeeting reports whether the event is an ordinary event, as opposed to an
+// out-of-office, focus time or working location entry.
+func IsMeeting(item *Event) bool {
+	switch item.EventType {
+	case EventTypeOutOfOffice, EventTypeFocusTime, EventTypeWorkingLocation:
+		return false
+	}
+	return true
+}
+
+// eventSpan returns the time an event covers, for all-day events from midnight
+// to midnight. Timed events are converted to loc if it is set; all-day events
+// keep their dates and are placed in loc, or UTC.
+func eventSpan(item *Event, loc *time.Location) (start, end time.Time, ok bool) {
+	if start, end, ok := EventTimes(item); ok {
+		if loc != nil {
+			start, end = start.In(loc), end.In(loc)
+		}
+		return start, end, true
+	}
+	if !item.AllDay || item.Start.IsZero() || item.End.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return sameDate(item.Start, loc), sameDate(item.End, loc), true
+}
+
+// sameDate returns midnight in loc on the date of t.
+func sameDate(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// coversDay reports whether the event covers any of the given date.
+func coversDay(item *Event, day time.Time, loc *time.Location) bool {
+	start, end, ok := eventSpan(item, loc)
+	if !ok {
+		return false
+	}
+	date := day.Format("2006-01-02")
+	last := end.Add(-time.Nanosecond)
+	return start.Format("2006-01-02") <= date && date <= last.Format("2006-01-02")
+}
+
+// workingLocationOn returns the working locations set for day, joined with " / "
+// if the day is split between several.
+func workingLocationOn(items []*Event, day time.Time, loc *time.Location) string {
+	var places []string
+	for _, item := range items {
+		if place := item.WorkingLocation; item.EventType == EventTypeWorkingLocation && place != "" && coversDay(item, day, loc) && !contains(places, place) {
+			places = append(places, place)
+		}
+	}
+	return strings.Join(places, " / ")
+}
+
+// outOfOfficeBanner describes an out-of-office event seen from day, e.g.
+// "alice is OOO until Friday".
+func outOfOfficeBanner(item *Event, calendarID, defaultDomain string, day time.Time, loc *time.Location) string {
+	who := strings.TrimSuffix(calendarID, "@"+defaultDomain)
+	start, end, ok := eventSpan(item, loc)
+	if !ok {
+		return fmt.Sprintf("%s is OOO", who)
+	}
+	last := end.Add(-time.Nanosecond)
+	var until string
+	switch date := day.Format("2006-01-02"); {
+	case start.Format("2006-01-02") == date && last.Format("2006-01-02") == date && !item.AllDay:
+		until = fmt.Sprintf("from %s to %s", start.Format("15:04"), end.Format("15:04"))
+	case last.Format("2006-01-02") == date && !item.AllDay:
+		until = "until " + end.Format("15:04")
+	case last.Format("2006-01-02") == date:
+		until = "today"
+	case last.Sub(day) < 6*24*time.Hour:
+		until = "until " + last.Format("Monday")
+	default:
+		until = "until " + last.Format("Jan 2")
+	}
+	return fmt.Sprintf("%s is OOO %s", who, until)
+}
+
+// ListAndPrintWhereabouts prints the working location of a calendar's owner for
+// each working day in [from, to), noting days out of office.
+func ListAndPrintWhereabouts(ctx context.Context, s CalendarService, calendarID string, from, to time.Time, loc *time.Location, f *Formatter) error {
+	events, err := s.ListEventsRange(ctx, calendarID, from, to)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = defaultFormatter()
+	}
+	if loc == nil {
+		if calLoc, err := time.LoadLocation(events.TimeZone); err == nil && events.TimeZone != "" {
+			loc = calLoc
+		} else {
+			loc = time.Local
+		}
+	}
+
+	fmt.Fprintf(f.writer(), "Working locations for %s from %s to %s\n",
+		f.styles["header"].Sprint(calendarID),
+		f.styles["header"].Sprint(from.Format("2006-01-02")),
+		f.styles["header"].Sprint(to.AddDate(0, 0, -1).Format("2006-01-02")),
+	)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		place := workingLocationOn(events.Items, day, loc)
+		ooo := false
+		for _, item := range events.Items {
+			if item.EventType == EventTypeOutOfOffice && coversDay(item, day, loc) {
+				ooo = true
+			}
+		}
+		weekend := day.Weekday() == time.Saturday || day.Weekday() == time.Sunday
+		switch {
+		case ooo:
+			place = f.styles["warning"].Sprint("out of office")
+		case place == "" && weekend:
+			continue
+		case place == "":
+			place = f.styles["attendees"].Sprint("not set")
+		}
+		fmt.Fprintf(f.writer(), " - %s %s\n", day.Format("Mon 2006-01-02"), place)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package gcal
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Filter selects which events are shown. The zero value matches every event.
+type Filter struct {
+	Grep         string        // case-insensitive substring of summary, location or description
+	Exclude      string        // case-insensitive substring of the summary to hide
+	OnlyWith     string        // case-insensitive substring of an attendee address
+	MinDuration  time.Duration // hide timed events shorter than this
+	HideAllDay   bool
+	OnlyAccepted bool // hide events the calendar owner has not accepted
+}
+
+// IsZero reports whether the filter matches every event.
+func (f Filter) IsZero() bool {
+	return f == Filter{}
+}
+
+// Match reports whether item passes the filter.
+func (f Filter) Match(item *Event) bool {
+	if f.Grep != "" && !containsFold(item.Summary+"\n"+item.Location+"\n"+item.Description, f.Grep) {
+		return false
+	}
+	if f.Exclude != "" && containsFold(item.Summary, f.Exclude) {
+		return false
+	}
+	if f.OnlyWith != "" && !hasAttendee(item, f.OnlyWith) {
+		return false
+	}
+	if f.HideAllDay && item.AllDay {
+		return false
+	}
+	if f.MinDuration > 0 && !item.AllDay {
+		start, end, ok := EventTimes(item)
+		if ok && end.Sub(start) < f.MinDuration {
+			return false
+		}
+	}
+	if f.OnlyAccepted && !isAccepted(item) {
+		return false
+	}
+	return true
+}
+
+// Apply returns a copy of events holding only the matching items.
+func (f Filter) Apply(events *Events) *Events {
+	filtered := *events
+	filtered.Items = nil
+	for _, item := range events.Items {
+		if f.Match(item) {
+			filtered.Items = append(filtered.Items, item)
+		}
+	}
+	return &filtered
+}
+
+// Filtered wraps a CalendarService so that every listing is passed through f.
+func Filtered(s CalendarService, f Filter) CalendarService {
+	if f.IsZero() {
+		return s
+	}
+	return &filteredService{CalendarService: s, filter: f}
+}
+
+type filteredService struct {
+	CalendarService
+	filter Filter
+}
+
+func (fs *filteredService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error) {
+	events, err := fs.CalendarService.ListEvents(ctx, calendarID, theDate)
+	if err != nil {
+		return nil, err
+	}
+	return fs.filter.Apply(events), nil
+}
+
+func (fs *filteredService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	events, err := fs.CalendarService.ListEventsRange(ctx, calendarID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fs.filter.Apply(events), nil
+}
+
+func (fs *filteredService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	events, err := fs.CalendarService.ListSeries(ctx, calendarID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fs.filter.Apply(events), nil
+}
+
+func (fs *filteredService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error) {
+	events, err := fs.CalendarService.SearchEvents(ctx, calendarID, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fs.filter.Apply(events), nil
+}
+
+func hasAttendee(item *Event, who string) bool {
+	for _, a := range item.Attendees {
+		if containsFold(a.Email, who) || containsFold(a.Name, who) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccepted reports whether the calendar owner accepted the event. Events
+// without attendees are the owner's own and count as accepted.
+func isAccepted(item *Event) bool {
+	for _, a := range item.Attendees {
+		if a.Self {
+			return a.Response == ResponseAccepted
+		}
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,67 @@
+package gcal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/interval"
+)
+
+// Busy returns the merged times in which the listed events block time.
+func Busy(events *Events) []interval.Interval {
+	ivs, _ := busyIntervals(events.Items)
+	return interval.Merge(ivs)
+}
+
+// FreeSlots returns the stretches of at least minLength within window where
+// none of the listings has an event that blocks time.
+func FreeSlots(listings []*Events, window interval.Interval, minLength time.Duration) []interval.Interval {
+	var busy []interval.Interval
+	for _, events := range listings {
+		busy = append(busy, Busy(events)...)
+	}
+	var free []interval.Interval
+	for _, gap := range interval.Gaps(interval.Merge(busy), window) {
+		if gap.Duration() >= minLength {
+			free = append(free, gap)
+		}
+	}
+	return free
+}
+
+// ListAndPrintFreeSlots prints the times within window when all the calendars are free.
+// Times are shown in the location of window.Start.
+func ListAndPrintFreeSlots(ctx context.Context, s CalendarService, calendarIDs []string, window interval.Interval, minLength time.Duration, f *Formatter) error {
+	var listings []*Events
+	for _, calendarID := range calendarIDs {
+		events, err := s.ListEventsRange(ctx, calendarID, window.Start, window.End)
+		if err != nil {
+			return err
+		}
+		listings = append(listings, events)
+	}
+	if f == nil {
+		f = defaultFormatter()
+	}
+
+	fmt.Fprintf(f.writer(), "Free time for %s on %s between %s and %s\n",
+		f.styles["header"].Sprint(strings.Join(calendarIDs, ", ")),
+		f.styles["header"].Sprint(window.Start.Format("2006-01-02")),
+		window.Start.Format("15:04"),
+		window.End.Format("15:04"),
+	)
+	slots := FreeSlots(listings, window, minLength)
+	if len(slots) == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No free time found."))
+		return nil
+	}
+	for _, slot := range slots {
+		fmt.Fprintf(f.writer(), " - %s (%s)\n",
+			f.styles["time"].Sprintf("%s-%s", slot.Start.Format("15:04"), slot.End.Format("15:04")),
+			formatCountdown(slot.Duration()),
+		)
+	}
+	return nil
+}
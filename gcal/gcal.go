@@ -2,272 +2,229 @@ package gcal
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/fatih/color"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
-
-	"github.com/perbu/calvin/config"
 )
 
 const (
 	separatorCount = 8
 )
 
-// GCalService interacts with the Google Calendar API.
-type GCalService struct {
-	service *calendar.Service
-	config  *config.Config
-	loader  config.Loader
-}
-
-// NewGCalService creates and initializes a new GCalService.
-func NewGCalService(loader config.Loader) (*GCalService, error) {
-	cfg, err := loader.LoadConfig()
-	if err != nil {
-		return nil, fmt.Errorf("loading config: %w", err)
+// formatTimeInfo formats the time information for an event.
+func formatTimeInfo(item *Event, loc *time.Location, timeColor, allDayColor *color.Color) string {
+	if item.AllDay {
+		return allDayColor.Sprint("(all day)")
 	}
-
-	credBytes, err := loader.LoadCredentials()
-	if err != nil {
-		return nil, fmt.Errorf("loading credentials: %w", err)
+	start, end, ok := EventTimes(item)
+	if !ok {
+		return "" // Default return if no time information is available
+	}
+	if loc != nil {
+		start, end = start.In(loc), end.In(loc)
 	}
+	highlight := timeColor.SprintFunc()
+	return fmt.Sprintf(" [%s --> %s]", highlight(start.Format("15:04")), highlight(end.Format("15:04")))
+}
 
-	token, err := loadOrObtainToken(credBytes, loader)
+// ListAndPrintEvents lists and prints events for a given calendar and date.
+// A nil Formatter uses the built-in templates.
+func ListAndPrintEvents(ctx context.Context, s CalendarService, calendarID string, theDate time.Time, defaultDomain string, loc *time.Location, f *Formatter) error {
+	events, err := s.ListEvents(ctx, calendarID, theDate)
 	if err != nil {
-		return nil, fmt.Errorf("getting token: %w", err)
+		return err
+	}
+	if f == nil {
+		f = defaultFormatter()
 	}
 
-	client := oauthClient(credBytes, token)
-
-	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	header, err := f.Day(HeaderData{
+		Date:            theDate,
+		CalendarID:      calendarID,
+		TimeZone:        events.TimeZone,
+		WorkingLocation: workingLocationOn(events.Items, theDate, loc),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("creating calendar service: %w", err)
+		return err
 	}
+	fmt.Fprintln(f.writer(), header)
+	printAccessNote(f, events, calendarID, defaultDomain)
 
-	return &GCalService{service: srv, config: cfg, loader: loader}, nil
+	return printEvents(f, events, calendarID, defaultDomain, theDate, loc)
 }
 
-// loadOrObtainToken loads a token from storage or obtains a new one if necessary.
-func loadOrObtainToken(credBytes []byte, loader config.Loader) (*oauth2.Token, error) {
-	tokenBytes, err := loader.LoadToken()
-	if err == nil { // Token found in storage
-		var tok oauth2.Token
-		if err := json.Unmarshal(tokenBytes, &tok); err != nil {
-			return nil, fmt.Errorf("unmarshalling token: %w", err)
-		}
-		return &tok, nil
+// printAccessNote explains the untitled events of calendars that only share free/busy information.
+func printAccessNote(f *Formatter, events *Events, calendarID, defaultDomain string) {
+	if events.AccessRole == AccessFreeBusy {
+		who := strings.TrimSuffix(calendarID, "@"+defaultDomain)
+		fmt.Fprintln(f.writer(), f.styles["attendees"].Sprintf("You don't have access to %s's calendar details; showing free/busy instead", who))
 	}
-
-	// No token found, initiate OAuth2 flow
-	return getTokenFromWeb(credBytes, loader)
 }
 
-// oauthClient creates an OAuth2 client.
-func oauthClient(credBytes []byte, token *oauth2.Token) *http.Client {
-	conf, err := google.ConfigFromJSON(credBytes, calendar.CalendarReadonlyScope)
+// ListAndPrintEventsForWeekDay lists and prints events for a given calendar and date with a simplified header for week view.
+func ListAndPrintEventsForWeekDay(ctx context.Context, s CalendarService, calendarID string, theDate time.Time, defaultDomain string, loc *time.Location, f *Formatter) error {
+	events, err := s.ListEvents(ctx, calendarID, theDate)
 	if err != nil {
-		log.Fatalf("parsing credentials: %v", err) // Fatal error if credentials are invalid
+		return err
 	}
-	return conf.Client(context.Background(), token)
-}
-
-// ListEvents retrieves events for a given calendar ID and date.
-func (g *GCalService) ListEvents(calendarID string, theDate time.Time) (*calendar.Events, error) {
-	cal, err := g.service.Calendars.Get(calendarID).Do()
-	if err != nil {
-		return nil, fmt.Errorf("getting calendar info: %w", err)
+	if f == nil {
+		f = defaultFormatter()
 	}
 
-	loc, err := time.LoadLocation(cal.TimeZone)
+	// Simplified header for week view - only show the date
+	header, err := f.Header(HeaderData{
+		Date:            theDate,
+		CalendarID:      calendarID,
+		TimeZone:        events.TimeZone,
+		WorkingLocation: workingLocationOn(events.Items, theDate, loc),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("loading location: %w", err)
+		return err
 	}
+	fmt.Fprintln(f.writer(), header)
 
-	startOfDay := time.Date(theDate.Year(), theDate.Month(), theDate.Day(), 0, 0, 0, 0, loc)
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
-	events, err := g.service.Events.List(calendarID).
-		ShowDeleted(false).
-		SingleEvents(true).
-		TimeMin(startOfDay.Format(time.RFC3339)).
-		TimeMax(endOfDay.Format(time.RFC3339)).
-		OrderBy("startTime").
-		Do()
-	if err != nil {
-		return nil, fmt.Errorf("retrieving events: %w", err)
-	}
-	return events, nil
+	return printEvents(f, events, calendarID, defaultDomain, theDate, loc)
 }
 
-// formatTimeInfo formats the time information for an event.
-func formatTimeInfo(item *calendar.Event, loc *time.Location) string {
-	if item.Start == nil {
-		return "" // Handle cases where Start is nil for robustness
+// printEvents prints one line per event, or a warning if there are none.
+// Out-of-office events become a banner and working locations are left to the
+// header.
+func printEvents(f *Formatter, events *Events, calendarID, defaultDomain string, day time.Time, loc *time.Location) error {
+	var items []*Event
+	for _, item := range events.Items {
+		switch item.EventType {
+		case EventTypeWorkingLocation:
+		case EventTypeOutOfOffice:
+			fmt.Fprintln(f.writer(), f.styles["warning"].Sprint(outOfOfficeBanner(item, calendarID, defaultDomain, day, loc)))
+		default:
+			items = append(items, item)
+		}
 	}
-
-	if item.Start.Date != "" {
-		return color.New(color.FgGreen).SprintFunc()("(all day)")
+	if len(items) == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No events found."))
+		return nil
 	}
 
-	if item.Start.DateTime != "" {
-		startTime, err1 := time.Parse(time.RFC3339, item.Start.DateTime)
-		endTime, err2 := time.Parse(time.RFC3339, item.End.DateTime)
-
-		if err1 != nil || err2 != nil {
-			return fmt.Sprintf("(%s --> %s)",
-				extractTimeFromISO(item.Start.DateTime),
-				extractTimeFromISO(item.End.DateTime),
-			) // Fallback if parsing fails
-		}
-
-		highlight := color.New(color.FgGreen).SprintFunc()
-		var formatted string
-		if loc == nil {
-			formatted = fmt.Sprintf(" [%s --> %s]", highlight(startTime.Format("15:04")), highlight(endTime.Format("15:04")))
-		} else {
-			formatted = fmt.Sprintf(" [%s --> %s]", highlight(startTime.In(loc).Format("15:04")), highlight(endTime.In(loc).Format("15:04")))
+	overlapping, backToBack := conflictMarks(items)
+	for _, item := range items {
+		data := f.newEventData(item, calendarID, defaultDomain, loc)
+		data.Conflict, data.BackToBack = overlapping[item], backToBack[item]
+		line, err := f.Event(data)
+		if err != nil {
+			return err
 		}
-
-		return formatted
+		fmt.Fprintln(f.writer(), line)
 	}
-
-	return "" // Default return if no time information is available
+	return nil
 }
 
-// ListAndPrintEvents lists and prints events for a given calendar and date.
-func ListAndPrintEvents(s CalendarService, calendarID string, theDate time.Time, defaultDomain string, loc *time.Location) error {
-	events, err := s.ListEvents(calendarID, theDate)
+// ListAndPrintEventsForWeek lists and prints events for a given calendar for each day in a week.
+func ListAndPrintEventsForWeek(ctx context.Context, s CalendarService, calendarID string, weekDays []time.Time, defaultDomain string, loc *time.Location, f *Formatter) error {
+	// Get the first day's events to extract timezone information
+	firstDayEvents, err := s.ListEvents(ctx, calendarID, weekDays[0])
 	if err != nil {
 		return err
 	}
-
-	headerColor := color.New(color.FgCyan, color.Bold).SprintFunc()
-	warnColor := color.New(color.FgRed, color.Bold).SprintFunc()
-	subtle := color.New(color.FgHiBlack).SprintFunc()
-	summaryColor := color.New(color.FgYellow, color.Bold).SprintFunc()
-
-	fmt.Printf("Listing events for %s (%s) [tz: %s]...\n",
-		headerColor(theDate.Format("2006-01-02")),
-		headerColor(calendarID),
-		headerColor(events.TimeZone),
-	)
-
-	if len(events.Items) == 0 {
-		fmt.Println(warnColor("No events found."))
-		return nil
+	if f == nil {
+		f = defaultFormatter()
 	}
 
-	for _, item := range events.Items {
-		fmt.Printf(" - %s %s %s %s\n",
-			summaryColor(item.Summary),
-			formatTimeInfo(item, loc), // Call the helper function
-			subtle("["+compactAttendees(item.Attendees, calendarID, defaultDomain)+"]"),
-			extractURLs(item), // Call the helper function
-		)
-	}
-	return nil
-}
-
-// ListAndPrintEventsForWeekDay lists and prints events for a given calendar and date with a simplified header for week view.
-func ListAndPrintEventsForWeekDay(s CalendarService, calendarID string, theDate time.Time, defaultDomain string, loc *time.Location) error {
-	events, err := s.ListEvents(calendarID, theDate)
+	header, err := f.Week(WeekData{
+		From:       weekDays[0],
+		To:         weekDays[6],
+		CalendarID: calendarID,
+		TimeZone:   firstDayEvents.TimeZone,
+	})
 	if err != nil {
 		return err
 	}
+	fmt.Fprintln(f.writer(), header)
+	printAccessNote(f, firstDayEvents, calendarID, defaultDomain)
 
-	headerColor := color.New(color.FgCyan, color.Bold).SprintFunc()
-	warnColor := color.New(color.FgRed, color.Bold).SprintFunc()
-	subtle := color.New(color.FgHiBlack).SprintFunc()
-	summaryColor := color.New(color.FgYellow, color.Bold).SprintFunc()
-
-	// Simplified header for week view - only show the date
-	fmt.Printf("%s:\n", headerColor(theDate.Format("=== Monday (Jan 2) ===")))
+	// fmt.Println(strings.Repeat("-", separatorCount))
 
-	if len(events.Items) == 0 {
-		fmt.Println(warnColor("No events found."))
-		return nil
+	for _, day := range weekDays {
+		err := ListAndPrintEventsForWeekDay(ctx, s, calendarID, day, defaultDomain, loc, f)
+		if err != nil {
+			return err
+		}
+		// fmt.Println(strings.Repeat("-", separatorCount))
 	}
 
-	for _, item := range events.Items {
-		fmt.Printf(" - %s %s %s %s\n",
-			summaryColor(item.Summary),
-			formatTimeInfo(item, loc),
-			subtle("["+compactAttendees(item.Attendees, calendarID, defaultDomain)+"]"),
-			extractURLs(item),
-		)
-	}
 	return nil
 }
 
-// ListAndPrintEventsForWeek lists and prints events for a given calendar for each day in a week.
-func ListAndPrintEventsForWeek(s CalendarService, calendarID string, weekDays []time.Time, defaultDomain string, loc *time.Location) error {
-	// Get the first day's events to extract timezone information
-	firstDayEvents, err := s.ListEvents(calendarID, weekDays[0])
+// SearchAndPrintEvents searches a calendar and prints the matches grouped by
+// date. to is exclusive, the header shows the last day searched.
+func SearchAndPrintEvents(ctx context.Context, s CalendarService, calendarID, query string, from, to time.Time, defaultDomain string, loc *time.Location, f *Formatter) error {
+	events, err := s.SearchEvents(ctx, calendarID, query, from, to)
 	if err != nil {
 		return err
 	}
+	if f == nil {
+		f = defaultFormatter()
+	}
 
-	headerColor := color.New(color.FgCyan, color.Bold).SprintFunc()
-
-	fmt.Printf("Listing events for the week of %s to %s (%s) [tz: %s]\n",
-		headerColor(weekDays[0].Format("2006-01-02")),
-		headerColor(weekDays[6].Format("2006-01-02")),
-		headerColor(calendarID),
-		headerColor(firstDayEvents.TimeZone))
-
-	// fmt.Println(strings.Repeat("-", separatorCount))
+	fmt.Fprintf(f.writer(), "Searching %s for %q from %s to %s\n",
+		f.styles["header"].Sprint(calendarID),
+		query,
+		f.styles["header"].Sprint(from.Format("2006-01-02")),
+		f.styles["header"].Sprint(to.AddDate(0, 0, -1).Format("2006-01-02")),
+	)
+	if len(events.Items) == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No events found."))
+		return nil
+	}
 
-	for _, day := range weekDays {
-		err := ListAndPrintEventsForWeekDay(s, calendarID, day, defaultDomain, loc)
+	var day string
+	for _, item := range events.Items {
+		date := eventDate(item, loc)
+		if d := date.Format("2006-01-02"); d != day {
+			day = d
+			header, err := f.Header(HeaderData{Date: date, CalendarID: calendarID, TimeZone: events.TimeZone})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(f.writer(), header)
+		}
+		line, err := f.Event(f.newEventData(item, calendarID, defaultDomain, loc))
 		if err != nil {
 			return err
 		}
-		// fmt.Println(strings.Repeat("-", separatorCount))
+		fmt.Fprintln(f.writer(), line)
 	}
-
 	return nil
 }
 
-// extractTimeFromISO converts ISO time to "15:04" format.
-func extractTimeFromISO(isoDateTime string) string {
-	t, err := time.Parse(time.RFC3339, isoDateTime)
-	if err != nil {
-		return "[error parsing time]"
+// eventDate returns the date an event starts on, in loc if given. All-day
+// events keep their date.
+func eventDate(item *Event, loc *time.Location) time.Time {
+	if item.AllDay {
+		return time.Date(item.Start.Year(), item.Start.Month(), item.Start.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if loc != nil {
+		return item.Start.In(loc)
 	}
-	return t.Format("15:04")
+	return item.Start
 }
 
-func compactAttendees(attendees []*calendar.EventAttendee, self, homeDomain string) string {
-	if len(attendees) == 0 {
-		return ""
-	}
+// shortAttendees returns the attendee addresses except self, with the home domain trimmed.
+func shortAttendees(attendees []Attendee, self, homeDomain string) []string {
 	var who []string
 	for _, a := range attendees {
 		if a.Email == self {
 			continue
 		}
-		short := strings.TrimSuffix(a.Email, "@"+homeDomain)
-		who = append(who, short)
-		if len(who) >= 3 {
-			who = append(who, "...")
-			break
-		}
+		who = append(who, strings.TrimSuffix(a.Email, "@"+homeDomain))
 	}
-	return strings.Join(who, ", ")
+	return who
 }
 
-func extractURLs(item *calendar.Event) string {
-	if item.HangoutLink != "" {
-		return item.HangoutLink
+func extractURLs(item *Event) string {
+	if item.ConferenceURL != "" {
+		return item.ConferenceURL
 	}
 	if item.Location != "" {
 		return item.Location
@@ -1,39 +1,89 @@
 package gcal
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/interval"
 )
 
 // MockCalendarService is a mock implementation of CalendarService.
 type MockCalendarService struct {
-	Events *calendar.Events
-	Err    error
+	Events    *Events
+	Calendars []*Calendar
+	Busy      map[string][]interval.Interval
+	Err       error
+}
+
+func (m *MockCalendarService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error) {
+	return m.Events, m.Err
+}
+
+func (m *MockCalendarService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	return m.Events, m.Err
+}
+
+func (m *MockCalendarService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error) {
+	return m.Events, m.Err
 }
 
-func (m *MockCalendarService) ListEvents(calendarID string, theDate time.Time) (*calendar.Events, error) {
+func (m *MockCalendarService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
 	return m.Events, m.Err
 }
 
+func (m *MockCalendarService) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	return m.Calendars, m.Err
+}
+
+func (m *MockCalendarService) InsertEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	return event, m.Err
+}
+
+func (m *MockCalendarService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return m.Busy, m.Err
+}
+
+// at parses an RFC 3339 time for use in fixtures.
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// date returns midnight UTC of a YYYY-MM-DD date, the start of all-day events
+// in calendars without a known time zone.
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
 func TestListAndPrintEvents(t *testing.T) {
-	mockEvents := &calendar.Events{
-		Items: []*calendar.Event{
+	mockEvents := &Events{
+		Items: []*Event{
 			{
 				Summary: "Meeting with Bob",
-				Start: &calendar.EventDateTime{
-					DateTime: "2025-01-31T10:00:00-07:00",
-				},
-				End: &calendar.EventDateTime{
-					DateTime: "2025-01-31T11:00:00-07:00",
-				},
+				Start:   at("2025-01-31T10:00:00-07:00"),
+				End:     at("2025-01-31T11:00:00-07:00"),
 			},
 			{
 				Summary: "Lunch",
-				Start: &calendar.EventDateTime{
-					Date: "2025-01-31",
-				},
+				Start:   date("2025-01-31"), AllDay: true,
 			},
 		},
 	}
@@ -43,23 +93,19 @@ func TestListAndPrintEvents(t *testing.T) {
 		Err:    nil,
 	}
 
-	err := ListAndPrintEvents(mockService, "alice@example.com", time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local), "example.com", nil)
+	err := ListAndPrintEvents(context.Background(), mockService, "alice@example.com", time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local), "example.com", nil, nil)
 	if err != nil {
 		t.Errorf("ListAndPrintEvents returned error: %v", err)
 	}
 }
 
 func TestListAndPrintEventsForWeek(t *testing.T) {
-	mockEvents := &calendar.Events{
-		Items: []*calendar.Event{
+	mockEvents := &Events{
+		Items: []*Event{
 			{
 				Summary: "Meeting with Bob",
-				Start: &calendar.EventDateTime{
-					DateTime: "2025-01-31T10:00:00-07:00",
-				},
-				End: &calendar.EventDateTime{
-					DateTime: "2025-01-31T11:00:00-07:00",
-				},
+				Start:   at("2025-01-31T10:00:00-07:00"),
+				End:     at("2025-01-31T11:00:00-07:00"),
 			},
 		},
 	}
@@ -76,8 +122,1000 @@ func TestListAndPrintEventsForWeek(t *testing.T) {
 		weekDays[i] = monday.AddDate(0, 0, i)
 	}
 
-	err := ListAndPrintEventsForWeek(mockService, "alice@example.com", weekDays, "example.com", nil)
+	err := ListAndPrintEventsForWeek(context.Background(), mockService, "alice@example.com", weekDays, "example.com", nil, nil)
 	if err != nil {
 		t.Errorf("ListAndPrintEventsForWeek returned error: %v", err)
 	}
 }
+
+func TestFormatStatus(t *testing.T) {
+	now := time.Date(2025, 1, 31, 9, 48, 0, 0, time.UTC)
+	mockService := &MockCalendarService{
+		Events: &Events{
+			Items: []*Event{
+				{
+					Summary: "Company Update",
+					Start:   date("2025-01-31"), AllDay: true,
+					End: date("2025-02-01"),
+				},
+				{
+					Summary: "Planning",
+					Start:   at("2025-01-31T09:30:00Z"),
+					End:     at("2025-01-31T10:30:00Z"),
+				},
+				{
+					Summary:   "Declined sync",
+					Start:     at("2025-01-31T09:55:00Z"),
+					End:       at("2025-01-31T10:00:00Z"),
+					Attendees: []Attendee{{Email: "alice@example.com", Self: true, Response: "declined"}},
+				},
+				{
+					Summary: "Standup",
+					Start:   at("2025-01-31T10:00:00Z"),
+					End:     at("2025-01-31T10:15:00Z"),
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		mode   StatusMode
+		format string
+		want   string
+	}{
+		{name: "next", mode: StatusNext, want: "Standup in 12m"},
+		{name: "now", mode: StatusNow, want: "Planning (42m left)"},
+		{name: "custom format", mode: StatusNext, format: "{{.Start.Format \"15:04\"}} {{.Summary}}", want: "10:00 Standup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatStatus(context.Background(), mockService, "alice@example.com", tt.mode, now, tt.format)
+			if err != nil {
+				t.Fatalf("FormatStatus returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatStatus(ctx) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{30 * time.Second, "30s"},
+		{12 * time.Minute, "12m"},
+		{65 * time.Minute, "1h05m"},
+		{51 * time.Hour, "2d3h"},
+	}
+	for _, tt := range tests {
+		if got := formatCountdown(tt.d); got != tt.want {
+			t.Errorf("formatCountdown(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFormatterEvent(t *testing.T) {
+	item := &Event{
+		Summary: "Design review",
+		Start:   at("2025-01-31T10:00:00Z"),
+		End:     at("2025-01-31T11:30:00Z"),
+		Attendees: []Attendee{
+			{Email: "alice@example.com"},
+			{Email: "bob@example.com"},
+			{Email: "carol@partner.com"},
+		},
+		ConferenceURL: "https://meet.google.com/abc-defg-hij",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name: "default",
+			want: " - Design review  [10:00 --> 11:30] [bob, carol@partner.com] https://meet.google.com/abc-defg-hij",
+		},
+		{
+			name:     "custom",
+			template: `{{.Start | fmtTime "15:04"}} {{.Summary | upper}} ({{duration .Duration}}) {{attendees 1 .Attendees}}`,
+			want:     "10:00 DESIGN REVIEW (1h30m) bob, ...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFormatter(config.Templates{Event: tt.template}, config.Theme{})
+			if err != nil {
+				t.Fatalf("NewFormatter returned error: %v", err)
+			}
+			f.SetColorMode("never")
+			got, err := f.Event(f.newEventData(item, "alice@example.com", "example.com", time.UTC))
+			if err != nil {
+				t.Fatalf("Event returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Event() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewFormatter(config.Templates{Day: "{{"}, config.Theme{}); err == nil {
+		t.Error("NewFormatter accepted an invalid template")
+	}
+	if _, err := NewFormatter(config.Templates{}, config.Theme{Summary: "mauve"}); err == nil {
+		t.Error("NewFormatter accepted an invalid theme color")
+	}
+}
+
+func TestSetColorMode(t *testing.T) {
+	item := &Event{Summary: "Standup", Start: at("2025-01-31T10:00:00Z")}
+	event := func(f *Formatter) string {
+		t.Helper()
+		got, err := f.Event(f.newEventData(item, "alice@example.com", "example.com", time.UTC))
+		if err != nil {
+			t.Fatalf("Event returned error: %v", err)
+		}
+		return got
+	}
+	colored, _ := NewFormatter(config.Templates{Event: `{{.Summary | color "red"}} {{.Summary | theme "summary"}}`}, config.Theme{})
+	if err := colored.SetColorMode("always"); err != nil {
+		t.Fatalf("SetColorMode(always) returned error: %v", err)
+	}
+	plain, _ := NewFormatter(config.Templates{Event: `{{.Summary | color "red"}} {{.Summary | theme "summary"}}`}, config.Theme{})
+	if err := plain.SetColorMode("never"); err != nil {
+		t.Fatalf("SetColorMode(never) returned error: %v", err)
+	}
+	// each formatter keeps its own mode, whatever was set last
+	if got := event(colored); strings.Count(got, "\x1b[") < 2 {
+		t.Errorf("Event() with color always = %q, want both parts colored", got)
+	}
+	if got := event(plain); got != "Standup Standup" {
+		t.Errorf("Event() with color never = %q, want no color", got)
+	}
+	if err := plain.SetColorMode("sometimes"); err == nil {
+		t.Error("SetColorMode accepted an invalid mode")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	standup := &Event{
+		Summary:   "Daily standup",
+		Start:     at("2025-01-31T09:30:00Z"),
+		End:       at("2025-01-31T09:45:00Z"),
+		Attendees: []Attendee{{Email: "alice@example.com", Self: true, Response: "accepted"}, {Email: "bob@example.com"}},
+	}
+	focus := &Event{
+		Summary: "Focus time",
+		Start:   at("2025-01-31T10:00:00Z"),
+		End:     at("2025-01-31T12:00:00Z"),
+	}
+	review := &Event{
+		Summary:     "Review",
+		Description: "Quarterly numbers",
+		Start:       at("2025-01-31T13:00:00Z"),
+		End:         at("2025-01-31T14:00:00Z"),
+		Attendees:   []Attendee{{Email: "alice@example.com", Self: true, Response: "tentative"}, {Email: "carol@example.com"}},
+	}
+	holiday := &Event{
+		Summary: "Holiday",
+		Start:   date("2025-01-31"), AllDay: true,
+		End: date("2025-02-01"),
+	}
+	events := &Events{Items: []*Event{standup, focus, review, holiday}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"zero", Filter{}, []string{"Daily standup", "Focus time", "Review", "Holiday"}},
+		{"grep", Filter{Grep: "STANDUP"}, []string{"Daily standup"}},
+		{"grep description", Filter{Grep: "quarterly"}, []string{"Review"}},
+		{"exclude", Filter{Exclude: "focus time"}, []string{"Daily standup", "Review", "Holiday"}},
+		{"only with", Filter{OnlyWith: "bob"}, []string{"Daily standup"}},
+		{"min duration", Filter{MinDuration: 30 * time.Minute}, []string{"Focus time", "Review", "Holiday"}},
+		{"hide all day", Filter{HideAllDay: true}, []string{"Daily standup", "Focus time", "Review"}},
+		{"only accepted", Filter{OnlyAccepted: true}, []string{"Daily standup", "Focus time", "Holiday"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Filtered(&MockCalendarService{Events: events}, tt.filter)
+			got, err := s.ListEvents(context.Background(), "alice@example.com", time.Now())
+			if err != nil {
+				t.Fatalf("ListEvents returned error: %v", err)
+			}
+			var summaries []string
+			for _, item := range got.Items {
+				summaries = append(summaries, item.Summary)
+			}
+			if strings.Join(summaries, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", summaries, tt.want)
+			}
+		})
+	}
+	if len(events.Items) != 4 {
+		t.Errorf("Filter modified the original events")
+	}
+}
+
+func TestSearchAndPrintEvents(t *testing.T) {
+	mockService := &MockCalendarService{
+		Events: &Events{
+			Items: []*Event{
+				{
+					Summary: "Quarterly review",
+					Start:   at("2025-01-31T10:00:00Z"),
+					End:     at("2025-01-31T11:00:00Z"),
+				},
+				{
+					Summary: "Quarterly review",
+					Start:   at("2025-04-30T10:00:00Z"),
+					End:     at("2025-04-30T11:00:00Z"),
+				},
+			},
+		},
+	}
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := SearchAndPrintEvents(context.Background(), mockService, "alice@example.com", "quarterly review", from, from.AddDate(0, 6, 0), "example.com", nil, nil)
+	if err != nil {
+		t.Errorf("SearchAndPrintEvents returned error: %v", err)
+	}
+
+	// to is exclusive, so the header ends on the day before it
+	var out strings.Builder
+	f, _ := NewFormatter(config.Templates{}, config.Theme{})
+	f.SetOutput(&out)
+	f.SetColorMode("never")
+	err = SearchAndPrintEvents(context.Background(), mockService, "alice@example.com", "review", from, from.AddDate(0, 1, 0), "example.com", time.UTC, f)
+	if err != nil {
+		t.Fatalf("SearchAndPrintEvents returned error: %v", err)
+	}
+	header, _, _ := strings.Cut(out.String(), "\n")
+	if !strings.HasSuffix(header, "to 2025-01-31") {
+		t.Errorf("SearchAndPrintEvents header = %q, want it to end with the last day, 2025-01-31", header)
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	standup := &Event{
+		Summary: "Standup",
+		Start:   at("2025-01-31T09:00:00Z"),
+		End:     at("2025-01-31T09:30:00Z"),
+	}
+	planning := &Event{
+		Summary: "Planning",
+		Start:   at("2025-01-31T09:15:00Z"),
+		End:     at("2025-01-31T10:00:00Z"),
+	}
+	oneOnOne := &Event{
+		Summary: "1:1",
+		Start:   at("2025-01-31T10:00:00Z"),
+		End:     at("2025-01-31T10:30:00Z"),
+	}
+	declined := &Event{
+		Summary:   "Declined",
+		Start:     at("2025-01-31T09:00:00Z"),
+		End:       at("2025-01-31T11:00:00Z"),
+		Attendees: []Attendee{{Email: "alice@example.com", Self: true, Response: "declined"}},
+	}
+	allDay := &Event{
+		Summary: "Offsite",
+		Start:   date("2025-01-31"), AllDay: true,
+		End: date("2025-02-01"),
+	}
+
+	items := []*Event{oneOnOne, declined, planning, allDay, standup}
+	conflicts := FindConflicts(items)
+	if len(conflicts) != 2 {
+		t.Fatalf("FindConflicts found %d conflicts, want 2: %+v", len(conflicts), conflicts)
+	}
+	if c := conflicts[0]; c.A != items[4] || c.B != items[2] || c.BackToBack || c.Overlap.Duration() != 15*time.Minute {
+		t.Errorf("conflicts[0] = %s/%s back-to-back=%v, want Standup overlapping Planning by 15m", c.A.Summary, c.B.Summary, c.BackToBack)
+	}
+	if c := conflicts[1]; c.A != items[2] || c.B != items[0] || !c.BackToBack {
+		t.Errorf("conflicts[1] = %s/%s back-to-back=%v, want Planning back-to-back with 1:1", c.A.Summary, c.B.Summary, c.BackToBack)
+	}
+
+	err := ListAndPrintConflicts(context.Background(), &MockCalendarService{Events: &Events{Items: []*Event{standup, planning, oneOnOne}}},
+		"alice@example.com", time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC), nil, nil)
+	if err != nil {
+		t.Errorf("ListAndPrintConflicts returned error: %v", err)
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	alice := &Events{Items: []*Event{{
+		Summary: "Standup",
+		Start:   at("2025-01-31T09:00:00Z"),
+		End:     at("2025-01-31T09:30:00Z"),
+	}}}
+	bob := &Events{Items: []*Event{{
+		Summary: "Planning",
+		Start:   at("2025-01-31T09:45:00Z"),
+		End:     at("2025-01-31T11:00:00Z"),
+	}, {
+		Summary:     "Reminder",
+		Start:       at("2025-01-31T13:00:00Z"),
+		End:         at("2025-01-31T14:00:00Z"),
+		Transparent: true,
+	}}}
+	day := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	window := interval.Interval{Start: day.Add(9 * time.Hour), End: day.Add(17 * time.Hour)}
+
+	var got []string
+	for _, slot := range FreeSlots([]*Events{alice, bob}, window, 30*time.Minute) {
+		got = append(got, slot.Start.Format("15:04")+"-"+slot.End.Format("15:04"))
+	}
+	if want := "11:00-17:00"; strings.Join(got, ",") != want {
+		t.Errorf("FreeSlots = %v, want %s", got, want)
+	}
+
+	var out strings.Builder
+	f, _ := NewFormatter(config.Templates{}, config.Theme{})
+	f.SetOutput(&out)
+	if err := ListAndPrintFreeSlots(context.Background(), &MockCalendarService{Events: bob}, []string{"bob@example.com"}, window, 15*time.Minute, f); err != nil {
+		t.Fatalf("ListAndPrintFreeSlots returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "09:00-09:45") || !strings.Contains(out.String(), "11:00-17:00") {
+		t.Errorf("ListAndPrintFreeSlots printed:\n%s", out.String())
+	}
+}
+
+func TestMatchCalendar(t *testing.T) {
+	entries := []*Calendar{
+		{ID: "alice@example.com", Name: "alice@example.com", Primary: true, AccessRole: "owner"},
+		{ID: "en.norwegian#holiday@group.v.calendar.google.com", Name: "Holidays in Norway", AccessRole: "reader"},
+		{ID: "c_123@group.calendar.google.com", Name: "Storage team", Nickname: "Team", AccessRole: "writer"},
+	}
+	tests := []struct {
+		name   string
+		wantID string
+		wantOK bool
+	}{
+		{"holidays in norway", "en.norwegian#holiday@group.v.calendar.google.com", true},
+		{"team", "c_123@group.calendar.google.com", true},
+		{"storage team", "c_123@group.calendar.google.com", true},
+		{"bob", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := MatchCalendar(tt.name, entries)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("MatchCalendar(%q) = %q, %v, want %q, %v", tt.name, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+
+	if err := PrintCalendars(entries, nil); err != nil {
+		t.Errorf("PrintCalendars returned error: %v", err)
+	}
+}
+
+func TestPeopleRecorder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	loader, err := config.NewFileLoader()
+	if err != nil {
+		t.Fatalf("NewFileLoader returned error: %v", err)
+	}
+	mock := &MockCalendarService{Events: &Events{Items: []*Event{
+		{Summary: "Sync", Attendees: []Attendee{
+			{Email: "bob@example.com"},
+			{Email: "room-1@resource.example.com", Resource: true},
+		}},
+	}}}
+
+	p := NewPeopleRecorder(mock, loader, "")
+	if _, err := p.ListEventsRange(context.Background(), "alice@example.com", time.Now(), time.Now()); err != nil {
+		t.Fatalf("ListEventsRange returned error: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	mock.Events.Items[0].Attendees = []Attendee{{Email: "carol@example.com"}, {Email: "bob@example.com"}}
+	p = NewPeopleRecorder(mock, loader, "")
+	if _, err := p.SearchEvents(context.Background(), "alice@example.com", "sync", time.Now(), time.Now()); err != nil {
+		t.Fatalf("SearchEvents returned error: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	got := strings.Join(LoadPeople(loader, ""), ",")
+	if want := "bob@example.com,carol@example.com"; got != want {
+		t.Errorf("LoadPeople = %q, want %q", got, want)
+	}
+	if got := LoadPeople(loader, "work"); got != nil {
+		t.Errorf("LoadPeople(work) = %q, want the work profile to have its own cache", got)
+	}
+
+	// a full cache drops those seen longest ago, not the last in the alphabet
+	full := map[string]string{"aaron@example.com": "2020-01-01"}
+	for i := 1; i < maxPeople; i++ {
+		full[fmt.Sprintf("user%04d@example.com", i)] = "2024-06-01"
+	}
+	b, err := json.Marshal(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.SaveCache(peopleCacheName, b); err != nil {
+		t.Fatal(err)
+	}
+	mock.Events.Items[0].Attendees = []Attendee{{Email: "zoe@example.com"}}
+	p = NewPeopleRecorder(mock, loader, "")
+	if _, err := p.ListEventsRange(context.Background(), "alice@example.com", time.Now(), time.Now()); err != nil {
+		t.Fatalf("ListEventsRange returned error: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	people := LoadPeople(loader, "")
+	if len(people) != maxPeople || people[0] != "user0001@example.com" || people[len(people)-1] != "zoe@example.com" {
+		t.Errorf("LoadPeople after overflowing = %d people from %s to %s, want %d without aaron and with zoe",
+			len(people), people[0], people[len(people)-1], maxPeople)
+	}
+}
+
+func TestRoomAvailability(t *testing.T) {
+	rooms := []config.Room{
+		{Email: "oslo-1@resource.example.com", Name: "Fjord", Building: "Oslo HQ", Capacity: 8, Features: []string{"Video conferencing"}},
+		{Email: "oslo-2@resource.example.com", Name: "Troll", Building: "Oslo HQ", Capacity: 4},
+		{Email: "bergen-1@resource.example.com", Name: "Rain", Building: "Bergen", Capacity: 12, Features: []string{"Whiteboard"}},
+		{Email: "gone@resource.example.com", Name: "Gone", Building: "Oslo HQ", Capacity: 2},
+	}
+	day := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	window := interval.Interval{Start: day.Add(14 * time.Hour), End: day.Add(15 * time.Hour)}
+	mock := &MockCalendarService{Busy: map[string][]interval.Interval{
+		"oslo-1@resource.example.com":   {{Start: day.Add(14*time.Hour + 30*time.Minute), End: day.Add(16 * time.Hour)}},
+		"oslo-2@resource.example.com":   {{Start: day.Add(13 * time.Hour), End: day.Add(14 * time.Hour)}},
+		"bergen-1@resource.example.com": {},
+	}}
+
+	statuses, err := RoomAvailability(context.Background(), mock, rooms, window)
+	if err != nil {
+		t.Fatalf("RoomAvailability returned error: %v", err)
+	}
+	var got []string
+	for _, s := range statuses {
+		got = append(got, fmt.Sprintf("%s:%v:%v", s.Room.Name, s.Known, s.Free()))
+	}
+	if want := "Rain:true:true,Troll:true:true,Fjord:true:false,Gone:false:false"; strings.Join(got, ",") != want {
+		t.Errorf("RoomAvailability = %v, want %s", got, want)
+	}
+
+	filters := []struct {
+		filter RoomFilter
+		want   int
+	}{
+		{RoomFilter{}, 4},
+		{RoomFilter{Building: "oslo"}, 3},
+		{RoomFilter{MinCapacity: 6}, 2},
+		{RoomFilter{Feature: "video"}, 1},
+		{RoomFilter{Building: "oslo", Feature: "whiteboard"}, 0},
+	}
+	for _, tt := range filters {
+		n := 0
+		for _, r := range rooms {
+			if tt.filter.Match(r) {
+				n++
+			}
+		}
+		if n != tt.want {
+			t.Errorf("%+v matched %d rooms, want %d", tt.filter, n, tt.want)
+		}
+	}
+
+	var out strings.Builder
+	f, _ := NewFormatter(config.Templates{}, config.Theme{})
+	f.SetOutput(&out)
+	if err := PrintRooms(statuses, window, false, f); err != nil {
+		t.Fatalf("PrintRooms returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Rain") || strings.Contains(out.String(), "Fjord") {
+		t.Errorf("PrintRooms without all printed:\n%s", out.String())
+	}
+}
+
+func TestFeatureNames(t *testing.T) {
+	var instances interface{}
+	if err := json.Unmarshal([]byte(`[{"feature": {"name": "Whiteboard"}}, {"feature": {"name": "Video conferencing"}}]`), &instances); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(featureNames(instances), ","); got != "Whiteboard,Video conferencing" {
+		t.Errorf("featureNames = %q", got)
+	}
+	if got := featureNames(nil); got != nil {
+		t.Errorf("featureNames(nil) = %v, want nil", got)
+	}
+}
+
+func TestEventTypes(t *testing.T) {
+	allDay := func(typ, from, to string) *Event {
+		return &Event{EventType: typ, Start: date(from), End: date(to), AllDay: true}
+	}
+	home := allDay(EventTypeWorkingLocation, "2025-01-27", "2025-01-28")
+	home.WorkingLocation = "Home"
+	office := allDay(EventTypeWorkingLocation, "2025-01-28", "2025-01-29")
+	office.WorkingLocation = "Oslo HQ, floor 3"
+	ooo := allDay(EventTypeOutOfOffice, "2025-01-29", "2025-02-01")
+	ooo.Summary = "Vacation"
+	focus := &Event{
+		Summary:   "Deep work",
+		EventType: EventTypeFocusTime,
+		Start:     at("2025-01-27T09:00:00Z"),
+		End:       at("2025-01-27T11:00:00Z"),
+	}
+
+	wed := time.Date(2025, 1, 29, 0, 0, 0, 0, time.UTC)
+	if got := outOfOfficeBanner(ooo, "alice@example.com", "example.com", wed, time.UTC); got != "alice is OOO until Friday" {
+		t.Errorf("outOfOfficeBanner() = %q, want %q", got, "alice is OOO until Friday")
+	}
+
+	var out strings.Builder
+	f := defaultFormatter()
+	f.SetOutput(&out)
+	f.SetColorMode("never")
+	mon := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+	s := &MockCalendarService{Events: &Events{Items: []*Event{home, focus}}}
+	if err := ListAndPrintEvents(context.Background(), s, "alice@example.com", mon, "example.com", time.UTC, f); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[working from Home]") || !strings.Contains(out.String(), "Deep work") {
+		t.Errorf("ListAndPrintEvents output = %q, want the working location in the header and the focus time listed", out.String())
+	}
+
+	out.Reset()
+	s.Events = &Events{Items: []*Event{home, office, ooo}}
+	if err := ListAndPrintWhereabouts(context.Background(), s, "alice@example.com", mon, mon.AddDate(0, 0, 7), time.UTC, f); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Mon 2025-01-27 Home", "Tue 2025-01-28 Oslo HQ, floor 3", "Thu 2025-01-30 out of office", "Fri 2025-01-31 out of office"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("ListAndPrintWhereabouts output = %q, want it to contain %q", out.String(), want)
+		}
+	}
+	if strings.Contains(out.String(), "Sat") {
+		t.Errorf("ListAndPrintWhereabouts listed a weekend without a location: %q", out.String())
+	}
+}
+
+func TestFromGoogleEvents(t *testing.T) {
+	events := fromGoogleEvents(&calendar.Events{
+		TimeZone:   "Europe/Oslo",
+		AccessRole: "reader",
+		Items: []*calendar.Event{
+			{
+				Id:          "offsite",
+				Summary:     "Offsite",
+				EventType:   "default",
+				Visibility:  "default",
+				Start:       &calendar.EventDateTime{Date: "2025-01-31"},
+				End:         &calendar.EventDateTime{Date: "2025-02-01"},
+				HangoutLink: "https://meet.google.com/abc-defg-hij",
+				Attendees: []*calendar.EventAttendee{
+					{Email: "alice@example.com", DisplayName: "Alice", Self: true, ResponseStatus: "tentative"},
+				},
+			},
+			{Id: "gone", Status: "cancelled"},
+		},
+	})
+	if events.TimeZone != "Europe/Oslo" || events.AccessRole != "reader" || len(events.Items) != 1 {
+		t.Fatalf("fromGoogleEvents = %+v, want one event with the calendar's time zone and access role", events)
+	}
+	e := events.Items[0]
+	oslo, _ := time.LoadLocation("Europe/Oslo")
+	if !e.AllDay || !e.Start.Equal(time.Date(2025, 1, 31, 0, 0, 0, 0, oslo)) || !e.End.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, oslo)) {
+		t.Errorf("event spans %v to %v (all day %v), want Jan 31 in Oslo", e.Start, e.End, e.AllDay)
+	}
+	if e.EventType != "" || e.Visibility != "" || e.ConferenceURL != "https://meet.google.com/abc-defg-hij" {
+		t.Errorf("event type %q, visibility %q, conference %q", e.EventType, e.Visibility, e.ConferenceURL)
+	}
+	if want := (Attendee{Email: "alice@example.com", Name: "Alice", Response: ResponseTentative, Self: true}); len(e.Attendees) != 1 || e.Attendees[0] != want {
+		t.Errorf("attendees = %+v, want %+v", e.Attendees, want)
+	}
+
+	office := &calendar.Event{
+		EventType: EventTypeWorkingLocation,
+		Start:     &calendar.EventDateTime{Date: "2025-01-28"},
+		End:       &calendar.EventDateTime{Date: "2025-01-29"},
+		WorkingLocationProperties: &calendar.EventWorkingLocationProperties{
+			Type:           "officeLocation",
+			OfficeLocation: &calendar.EventWorkingLocationPropertiesOfficeLocation{BuildingId: "Oslo HQ", FloorId: "3"},
+		},
+	}
+	if got := fromGoogleEvent(office, time.UTC).WorkingLocation; got != "Oslo HQ, floor 3" {
+		t.Errorf("WorkingLocation of office = %q, want %q", got, "Oslo HQ, floor 3")
+	}
+	home := &calendar.Event{EventType: EventTypeWorkingLocation, WorkingLocationProperties: &calendar.EventWorkingLocationProperties{Type: "homeOffice"}}
+	if got := fromGoogleEvent(home, time.UTC).WorkingLocation; got != "Home" {
+		t.Errorf("WorkingLocation of home = %q, want %q", got, "Home")
+	}
+}
+
+func TestToGoogleEvent(t *testing.T) {
+	timed := toGoogleEvent(&Event{
+		Summary:   "Design review",
+		Start:     at("2025-01-31T10:00:00+01:00"),
+		End:       at("2025-01-31T11:00:00+01:00"),
+		Attendees: []Attendee{{Email: "bob@example.com"}},
+	})
+	if timed.Start.DateTime != "2025-01-31T10:00:00+01:00" || timed.End.DateTime != "2025-01-31T11:00:00+01:00" || timed.Start.Date != "" {
+		t.Errorf("timed event spans %+v to %+v", timed.Start, timed.End)
+	}
+	if len(timed.Attendees) != 1 || timed.Attendees[0].Email != "bob@example.com" {
+		t.Errorf("attendees = %+v, want bob", timed.Attendees)
+	}
+	allDay := toGoogleEvent(&Event{Summary: "Offsite", Start: date("2025-01-31"), End: date("2025-02-01"), AllDay: true})
+	if allDay.Start.Date != "2025-01-31" || allDay.End.Date != "2025-02-01" || allDay.Start.DateTime != "" {
+		t.Errorf("all-day event spans %+v to %+v", allDay.Start, allDay.End)
+	}
+}
+
+func TestDescribeRecurrence(t *testing.T) {
+	tests := []struct {
+		rules []string
+		want  string
+	}{
+		{[]string{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU"}, "every 2 weeks on Tue"},
+		{[]string{"EXDATE;TZID=Europe/Oslo:20250204T100000", "RRULE:FREQ=WEEKLY;BYDAY=MO,TH"}, "every week on Mon, Thu"},
+		{[]string{"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"}, "every weekday"},
+		{[]string{"RRULE:FREQ=MONTHLY;BYDAY=-1FR"}, "every month on the last Fri"},
+		{[]string{"RRULE:FREQ=MONTHLY;BYDAY=-2FR"}, "every month on the 2nd-to-last Fri"},
+		{[]string{"RRULE:FREQ=MONTHLY;BYMONTHDAY=15;COUNT=6"}, "every month on day 15, 6 times"},
+		{[]string{"RRULE:FREQ=YEARLY;UNTIL=20271231T000000Z"}, "every year, until 2027-12-31"},
+		{[]string{"RDATE:20250301"}, "custom"},
+	}
+	for _, tt := range tests {
+		if got := DescribeRecurrence(tt.rules); got != tt.want {
+			t.Errorf("DescribeRecurrence(%q) = %q, want %q", tt.rules, got, tt.want)
+		}
+	}
+}
+
+func TestDayNames(t *testing.T) {
+	tests := []struct {
+		byDay []string
+		want  string
+	}{
+		{[]string{"TU"}, "Tue"},
+		{[]string{"-1FR"}, "last Fri"},
+		{[]string{"-2FR"}, "2nd-to-last Fri"},
+		{[]string{"-3TH"}, "3rd-to-last Thu"},
+		{[]string{"+1MO"}, "1st Mon"},
+		{[]string{"2WE", "4WE"}, "2nd Wed, 4th Wed"},
+		{[]string{"11SU", "12SU", "13SU"}, "11th Sun, 12th Sun, 13th Sun"},
+		{[]string{"21MO", "22MO", "23MO"}, "21st Mon, 22nd Mon, 23rd Mon"},
+		{[]string{"xxMO"}, "xxMO"},
+	}
+	for _, tt := range tests {
+		if got := dayNames(tt.byDay); got != tt.want {
+			t.Errorf("dayNames(%q) = %q, want %q", tt.byDay, got, tt.want)
+		}
+	}
+}
+
+func TestRecurringSeries(t *testing.T) {
+	series := func(summary, rule, start, end string) *Event {
+		return &Event{
+			Summary:    summary,
+			Recurrence: []string{rule},
+			Start:      at(start),
+			End:        at(end),
+		}
+	}
+	items := []*Event{
+		series("Biweekly 1:1", "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "2025-01-28T10:00:00Z", "2025-01-28T10:30:00Z"),
+		series("Standup", "RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", "2025-01-27T09:00:00Z", "2025-01-27T09:15:00Z"),
+		{Summary: "One-off", Start: at("2025-01-27T12:00:00Z"), End: at("2025-01-27T13:00:00Z")},
+	}
+	got := RecurringSeries(items, time.UTC)
+	if len(got) != 2 {
+		t.Fatalf("RecurringSeries() returned %d series, want 2", len(got))
+	}
+	if got[0].Event.Summary != "Standup" || got[0].Weekly != 75*time.Minute || got[0].Schedule != "every weekday at 09:00" {
+		t.Errorf("first series = %q, %q, %v, want Standup, every weekday at 09:00, 1h15m", got[0].Event.Summary, got[0].Schedule, got[0].Weekly)
+	}
+	if got[1].Weekly != 15*time.Minute {
+		t.Errorf("biweekly series takes %v per week, want 15m", got[1].Weekly)
+	}
+
+	var out strings.Builder
+	f := defaultFormatter()
+	f.SetOutput(&out)
+	f.SetColorMode("never")
+	if err := ListAndPrintRecurring(context.Background(), &MockCalendarService{Events: &Events{Items: items}}, "alice@example.com", time.Time{}, time.Time{}, time.UTC, f); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Total: 1h30m per week") {
+		t.Errorf("ListAndPrintRecurring output = %q, want a total of 1h30m", out.String())
+	}
+}
+
+func TestHiddenEvents(t *testing.T) {
+	tests := []struct {
+		item *Event
+		want string
+	}{
+		{&Event{Summary: "Lunch", Visibility: "private"}, "Lunch"},
+		{&Event{Visibility: "private"}, "(private)"},
+		{&Event{Visibility: "confidential"}, "(private)"},
+		{&Event{}, "(busy)"},
+	}
+	for _, tt := range tests {
+		if got := EventSummary(tt.item); got != tt.want {
+			t.Errorf("EventSummary(%+v) = %q, want %q", tt.item, got, tt.want)
+		}
+	}
+
+	start := time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)
+	events := BusyEvents([]interval.Interval{{Start: start, End: start.Add(time.Hour)}}, time.UTC)
+	var out strings.Builder
+	f := defaultFormatter()
+	f.SetOutput(&out)
+	f.SetColorMode("never")
+	s := &MockCalendarService{Events: events}
+	if err := ListAndPrintEvents(context.Background(), s, "bob@example.com", start, "example.com", time.UTC, f); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"You don't have access to bob's calendar details; showing free/busy instead", "(busy)  [10:00 --> 11:00]"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("ListAndPrintEvents output = %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransport(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case calls == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case calls == 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer srv.Close()
+
+	var delays []time.Duration
+	transport := &RetryTransport{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("GET got status %d after %d calls, want 200 after 3", resp.StatusCode, calls)
+	}
+	if len(delays) != 2 || delays[0] < 500*time.Millisecond || delays[0] > time.Second || delays[1] != 5*time.Second {
+		t.Errorf("delays = %v, want one in [0.5s, 1s] and then Retry-After capped at 5s", delays)
+	}
+
+	// retries send clones and leave the caller's request alone
+	calls = 0
+	req, _ := http.NewRequest("REPORT", srv.URL, strings.NewReader("<query/>"))
+	body := req.Body
+	var sent []*http.Request
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = append(sent, r)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	if resp, err = transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(sent) != 3 || sent[1] == req || sent[2] == req || req.Body != body {
+		t.Errorf("REPORT was sent %d times, want 3, with the retries on clones of the request", len(sent))
+	}
+	transport.Base = nil
+
+	calls = 0
+	resp, err = client.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("POST was sent %d times, want it not to be retried", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Fri, 31 Jan 2025 10:00:30 GMT", 30 * time.Second, true},
+		{"Fri, 31 Jan 2025 09:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.header, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// newFakeAPI starts a stand-in for the Calendar API and returns a service using it.
+func newFakeAPI(t *testing.T, handler http.HandlerFunc) *GCalService {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	transport := NewRetryTransport(http.DefaultTransport)
+	transport.sleep = func(context.Context, time.Duration) error { return nil }
+	service, err := calendar.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &GCalService{service: service}
+}
+
+func TestErrorClassification(t *testing.T) {
+	apiError := func(w http.ResponseWriter, code int, reason string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"error": {"code": %d, "message": %q, "errors": [{"domain": "global", "reason": %q}]}}`, code, reason, reason)
+	}
+	var flaky int
+	s := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/calendars/flaky/events":
+			if flaky++; flaky < 3 {
+				apiError(w, http.StatusForbidden, "rateLimitExceeded")
+				return
+			}
+			fmt.Fprint(w, `{"items": [{"summary": "Standup"}]}`)
+		case "/calendars/missing/events":
+			apiError(w, http.StatusNotFound, "notFound")
+		case "/calendars/locked/events":
+			apiError(w, http.StatusForbidden, "forbidden")
+		case "/calendars/expired/events":
+			apiError(w, http.StatusUnauthorized, "authError")
+		case "/calendars/busy/events":
+			apiError(w, http.StatusTooManyRequests, "rateLimitExceeded")
+		case "/freeBusy":
+			fmt.Fprint(w, `{"calendars": {"missing": {"errors": [{"domain": "global", "reason": "notFound"}]}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	ctx := context.Background()
+	from := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	events, err := s.ListEventsRange(ctx, "flaky", from, from.AddDate(0, 0, 1))
+	if err != nil || len(events.Items) != 1 {
+		t.Errorf("ListEventsRange(flaky) = %v, %v, want the event after retrying", events, err)
+	}
+	tests := []struct {
+		calendarID string
+		want       error
+	}{
+		{"missing", ErrNotFound},
+		{"locked", ErrForbidden},
+		{"expired", ErrAuthExpired},
+		{"busy", ErrRateLimited},
+	}
+	for _, tt := range tests {
+		_, err := s.SearchEvents(ctx, tt.calendarID, "x", from, from.AddDate(0, 0, 1))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("SearchEvents(%s) error = %v, want %v", tt.calendarID, err, tt.want)
+		}
+	}
+	if _, err := s.ListEventsRange(ctx, "missing", from, from.AddDate(0, 0, 1)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ListEventsRange(missing) error = %v, want %v after the free/busy fallback", err, ErrNotFound)
+	}
+}
+
+// countingService counts the listings it passes on.
+type countingService struct {
+	CalendarService
+	calls int
+}
+
+func (c *countingService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	c.calls++
+	return c.CalendarService.ListEventsRange(ctx, calendarID, from, to)
+}
+
+func TestCachedService(t *testing.T) {
+	mock := &MockCalendarService{Events: &Events{Items: []*Event{{Summary: "Sync"}}}}
+	counter := &countingService{CalendarService: mock}
+	now := at("2025-01-27T09:00:00Z")
+	c := Cached(counter, time.Minute)
+	c.Now = func() time.Time { return now }
+	ctx := context.Background()
+	from, to := date("2025-01-27"), date("2025-01-28")
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		calendarID string
+		to         time.Time
+		wantCalls  int
+	}{
+		{"first read", 0, "alice@example.com", to, 1},
+		{"same read", 30 * time.Second, "alice@example.com", to, 1},
+		{"other calendar", 0, "bob@example.com", to, 2},
+		{"other range", 0, "alice@example.com", to.AddDate(0, 0, 1), 3},
+		{"expired", time.Minute, "alice@example.com", to, 4},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		events, err := c.ListEventsRange(ctx, tt.calendarID, from, tt.to)
+		if err != nil || len(events.Items) != 1 {
+			t.Fatalf("%s: ListEventsRange = %v, %v", tt.name, events, err)
+		}
+		if counter.calls != tt.wantCalls {
+			t.Errorf("%s: backend read %d times, want %d", tt.name, counter.calls, tt.wantCalls)
+		}
+	}
+
+	mock.Err = errors.New("backend down")
+	now = now.Add(time.Hour)
+	if _, err := c.ListEventsRange(ctx, "alice@example.com", from, to); err == nil {
+		t.Fatal("ListEventsRange did not return the backend error")
+	}
+	mock.Err = nil
+	if _, err := c.ListEventsRange(ctx, "alice@example.com", from, to); err != nil || counter.calls != 6 {
+		t.Errorf("failed read was cached: %d backend reads, err %v", counter.calls, err)
+	}
+}
+
+func TestAccessScopes(t *testing.T) {
+	directory := "https://www.googleapis.com/auth/admin.directory.resource.calendar.readonly"
+	tests := []struct {
+		access Access
+		want   []string
+	}{
+		{Access{}, []string{calendar.CalendarReadonlyScope}},
+		{Access{Write: true}, []string{calendar.CalendarReadonlyScope, calendar.CalendarEventsScope}},
+		{Access{Directory: true}, []string{calendar.CalendarReadonlyScope, directory}},
+		{Access{Write: true, Directory: true}, []string{calendar.CalendarReadonlyScope, calendar.CalendarEventsScope, directory}},
+	}
+	for _, tt := range tests {
+		if got := tt.access.scopes(); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%+v.scopes() = %q, want %q", tt.access, got, tt.want)
+		}
+	}
+}
+
+func TestAtClock(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		day  time.Time
+		want string
+	}{
+		{time.Date(2025, 3, 29, 0, 0, 0, 0, oslo), "2025-03-29T09:30:00+01:00"},
+		{time.Date(2025, 3, 30, 0, 0, 0, 0, oslo), "2025-03-30T09:30:00+02:00"},   // the clocks go forward
+		{time.Date(2025, 10, 26, 15, 0, 0, 0, oslo), "2025-10-26T09:30:00+01:00"}, // and back
+	}
+	for _, tt := range tests {
+		if got := AtClock(tt.day, 9*time.Hour+30*time.Minute).Format(time.RFC3339); got != tt.want {
+			t.Errorf("AtClock(%v, 9:30) = %s, want %s", tt.day, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package gcal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/interval"
+)
+
+// GCalService interacts with the Google Calendar API.
+type GCalService struct {
+	service *calendar.Service
+	config  *config.Config
+	loader  config.Loader
+}
+
+// NewGCalService creates and initializes a new GCalService. ctx bounds the
+// login flow if there is no token yet.
+func NewGCalService(ctx context.Context, loader config.Loader) (*GCalService, error) {
+	cfg, err := loader.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	client, err := httpClient(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("creating calendar service: %w", err)
+	}
+
+	return &GCalService{service: srv, config: cfg, loader: loader}, nil
+}
+
+// httpClient returns an HTTP client authorized with the stored token, obtaining
+// one first if there is none.
+func httpClient(ctx context.Context, loader config.Loader) (*http.Client, error) {
+	credBytes, err := loader.LoadCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("loading credentials: %w", err)
+	}
+
+	token, err := loadOrObtainToken(ctx, credBytes, loader)
+	if err != nil {
+		return nil, fmt.Errorf("getting token: %w", err)
+	}
+
+	return oauthClient(ctx, credBytes, token), nil
+}
+
+// loadOrObtainToken loads a token from storage or obtains a new one if necessary.
+func loadOrObtainToken(ctx context.Context, credBytes []byte, loader config.Loader) (*oauth2.Token, error) {
+	tokenBytes, err := loader.LoadToken()
+	if err == nil { // Token found in storage
+		var tok oauth2.Token
+		if err := json.Unmarshal(tokenBytes, &tok); err != nil {
+			return nil, fmt.Errorf("unmarshalling token: %w", err)
+		}
+		return &tok, nil
+	}
+
+	// No token found, initiate OAuth2 flow
+	return getTokenFromWeb(ctx, credBytes, loader, os.Stdout, calendar.CalendarReadonlyScope)
+}
+
+// oauthClient creates an OAuth2 client whose requests are retried on transient
+// failures, see RetryTransport. Requests are bound to the context of each call,
+// ctx only supplies the HTTP client used for refreshing the token.
+func oauthClient(ctx context.Context, credBytes []byte, token *oauth2.Token) *http.Client {
+	conf, err := google.ConfigFromJSON(credBytes, calendar.CalendarReadonlyScope)
+	if err != nil {
+		log.Fatalf("parsing credentials: %v", err) // Fatal error if credentials are invalid
+	}
+	base := &http.Client{Transport: NewRetryTransport(http.DefaultTransport)}
+	return conf.Client(context.WithValue(ctx, oauth2.HTTPClient, base), token)
+}
+
+// ListEvents retrieves events for a given calendar ID and date. If the caller
+// may only see free/busy information, the day is taken in the local time zone
+// and the busy times are returned as untitled events.
+func (g *GCalService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error) {
+	cal, err := g.service.Calendars.Get(calendarID).Context(ctx).Do()
+	if err != nil {
+		err = fmt.Errorf("getting calendar info: %w", classify(calendarID, err))
+		if !isAccessDenied(err) {
+			return nil, err
+		}
+		from, to := LocalDay(theDate)
+		return g.freeBusyEvents(ctx, calendarID, from, to, err)
+	}
+
+	loc, err := time.LoadLocation(cal.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("loading location: %w", err)
+	}
+
+	startOfDay := time.Date(theDate.Year(), theDate.Month(), theDate.Day(), 0, 0, 0, 0, loc)
+	endOfDay := startOfDay.Add(24 * time.Hour)
+
+	return g.ListEventsRange(ctx, calendarID, startOfDay, endOfDay)
+}
+
+// ListEventsRange retrieves all events overlapping the half-open interval [from, to).
+// Unlike ListEvents, the bounds are used as given and not snapped to day boundaries.
+// Calendars the caller may only see free/busy information for are listed as
+// untitled busy events.
+func (g *GCalService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	call := g.service.Events.List(calendarID).
+		ShowDeleted(false).
+		SingleEvents(true).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(to.Format(time.RFC3339)).
+		OrderBy("startTime")
+	events, err := collectPages(ctx, call)
+	if err != nil {
+		err = fmt.Errorf("retrieving events: %w", classify(calendarID, err))
+		if isAccessDenied(err) {
+			return g.freeBusyEvents(ctx, calendarID, from, to, err)
+		}
+		return nil, err
+	}
+	return fromGoogleEvents(events), nil
+}
+
+// SearchEvents retrieves events in [from, to) matching a free text query. The
+// query is matched by the API against summary, description, location and attendees.
+func (g *GCalService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error) {
+	call := g.service.Events.List(calendarID).
+		Q(query).
+		ShowDeleted(false).
+		SingleEvents(true).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(to.Format(time.RFC3339)).
+		OrderBy("startTime")
+	events, err := collectPages(ctx, call)
+	if err != nil {
+		return nil, fmt.Errorf("searching events: %w", classify(calendarID, err))
+	}
+	return fromGoogleEvents(events), nil
+}
+
+// ListSeries retrieves the recurring events with instances in [from, to) as
+// their series, so that Recurrence holds the rules. Single events are left out.
+func (g *GCalService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	call := g.service.Events.List(calendarID).
+		ShowDeleted(false).
+		SingleEvents(false).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(to.Format(time.RFC3339))
+	events, err := collectPages(ctx, call)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", classify(calendarID, err))
+	}
+	series := fromGoogleEvents(events)
+	items := series.Items[:0]
+	for _, item := range series.Items {
+		if len(item.Recurrence) > 0 {
+			items = append(items, item)
+		}
+	}
+	series.Items = items
+	return series, nil
+}
+
+// InsertEvent creates an event and invites its attendees. It needs a token
+// obtained with write access.
+func (g *GCalService) InsertEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	created, err := g.service.Events.Insert(calendarID, toGoogleEvent(event)).SendUpdates("all").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("inserting event: %w", classify(calendarID, err))
+	}
+	return fromGoogleEvent(created, event.Start.Location()), nil
+}
+
+// FreeBusy returns the busy times of each calendar in [from, to). Calendars the
+// API reports errors for, such as unknown ones, are left out of the result.
+func (g *GCalService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	const maxPerQuery = 50 // the API limit on calendars per query
+	busy := make(map[string][]interval.Interval)
+	for len(calendarIDs) > 0 {
+		batch := calendarIDs[:min(maxPerQuery, len(calendarIDs))]
+		calendarIDs = calendarIDs[len(batch):]
+
+		req := &calendar.FreeBusyRequest{TimeMin: from.Format(time.RFC3339), TimeMax: to.Format(time.RFC3339)}
+		for _, id := range batch {
+			req.Items = append(req.Items, &calendar.FreeBusyRequestItem{Id: id})
+		}
+		resp, err := g.service.Freebusy.Query(req).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("querying free/busy: %w", classify("", err))
+		}
+		for id, cal := range resp.Calendars {
+			if len(cal.Errors) > 0 {
+				continue
+			}
+			periods := []interval.Interval{}
+			for _, p := range cal.Busy {
+				start, err1 := time.Parse(time.RFC3339, p.Start)
+				end, err2 := time.Parse(time.RFC3339, p.End)
+				if err1 != nil || err2 != nil {
+					continue
+				}
+				periods = append(periods, interval.Interval{Start: start, End: end})
+			}
+			busy[id] = periods
+		}
+	}
+	return busy, nil
+}
+
+// collectPages runs call and merges the items of all result pages into the first page.
+func collectPages(ctx context.Context, call *calendar.EventsListCall) (*calendar.Events, error) {
+	var events *calendar.Events
+	err := call.Pages(ctx, func(page *calendar.Events) error {
+		if events == nil {
+			events = page
+			return nil
+		}
+		events.Items = append(events.Items, page.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ListCalendars retrieves the calendars the user has subscribed to or that are shared with them.
+func (g *GCalService) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	var entries []*Calendar
+	err := g.service.CalendarList.List().Pages(ctx, func(page *calendar.CalendarList) error {
+		for _, item := range page.Items {
+			entries = append(entries, &Calendar{
+				ID:         item.Id,
+				Name:       item.Summary,
+				Nickname:   item.SummaryOverride,
+				Primary:    item.Primary,
+				AccessRole: item.AccessRole,
+				TimeZone:   item.TimeZone,
+				Color:      item.BackgroundColor,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing calendars: %w", classify("", err))
+	}
+	return entries, nil
+}
+
+// freeBusyEvents lists calendarID through a free/busy query, for callers without
+// access to the events. It returns cause if the query does not cover the calendar
+// either, so that unknown calendars still fail.
+func (g *GCalService) freeBusyEvents(ctx context.Context, calendarID string, from, to time.Time, cause error) (*Events, error) {
+	busy, err := g.FreeBusy(ctx, []string{calendarID}, from, to)
+	if err != nil {
+		return nil, cause
+	}
+	periods, ok := busy[calendarID]
+	if !ok {
+		return nil, cause
+	}
+	return BusyEvents(periods, from.Location()), nil
+}
+
+// fromGoogleEvents converts a listing from the Google Calendar API. All-day
+// events are placed in the calendar's time zone, or UTC if it is unknown.
+func fromGoogleEvents(events *calendar.Events) *Events {
+	loc, err := time.LoadLocation(events.TimeZone)
+	if err != nil || events.TimeZone == "" {
+		loc = time.UTC
+	}
+	converted := &Events{TimeZone: events.TimeZone, AccessRole: events.AccessRole}
+	for _, item := range events.Items {
+		if item.Status == "cancelled" {
+			continue
+		}
+		converted.Items = append(converted.Items, fromGoogleEvent(item, loc))
+	}
+	return converted
+}
+
+// fromGoogleEvent converts an event, placing all-day events in loc.
+func fromGoogleEvent(item *calendar.Event, loc *time.Location) *Event {
+	e := &Event{
+		ID:               item.Id,
+		Summary:          item.Summary,
+		Description:      item.Description,
+		Location:         item.Location,
+		ConferenceURL:    item.HangoutLink,
+		HTMLLink:         item.HtmlLink,
+		Transparent:      item.Transparency == "transparent",
+		Visibility:       item.Visibility,
+		RecurringEventID: item.RecurringEventId,
+		Recurrence:       item.Recurrence,
+	}
+	if item.EventType != "default" {
+		e.EventType = item.EventType
+	}
+	if item.EventType == EventTypeWorkingLocation {
+		e.WorkingLocation = googleWorkingLocation(item.WorkingLocationProperties)
+	}
+	if item.Visibility == "default" || item.Visibility == "public" {
+		e.Visibility = ""
+	}
+	e.Start, e.AllDay = googleTime(item.Start, loc)
+	e.End, _ = googleTime(item.End, loc)
+	for _, a := range item.Attendees {
+		e.Attendees = append(e.Attendees, Attendee{
+			Email:     a.Email,
+			Name:      a.DisplayName,
+			Response:  a.ResponseStatus,
+			Self:      a.Self,
+			Resource:  a.Resource,
+			Organizer: a.Organizer,
+		})
+	}
+	return e
+}
+
+// toGoogleEvent converts an event for inserting. All-day events use the dates of
+// Start and End.
+func toGoogleEvent(e *Event) *calendar.Event {
+	item := &calendar.Event{
+		Summary:     e.Summary,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       &calendar.EventDateTime{DateTime: e.Start.Format(time.RFC3339)},
+		End:         &calendar.EventDateTime{DateTime: e.End.Format(time.RFC3339)},
+		Recurrence:  e.Recurrence,
+	}
+	if e.AllDay {
+		item.Start = &calendar.EventDateTime{Date: e.Start.Format("2006-01-02")}
+		item.End = &calendar.EventDateTime{Date: e.End.Format("2006-01-02")}
+	}
+	if e.Transparent {
+		item.Transparency = "transparent"
+	}
+	item.Visibility = e.Visibility
+	for _, a := range e.Attendees {
+		item.Attendees = append(item.Attendees, &calendar.EventAttendee{Email: a.Email, DisplayName: a.Name, Resource: a.Resource})
+	}
+	return item
+}
+
+// googleTime parses the start or end of an event. Malformed times give the zero time.
+func googleTime(t *calendar.EventDateTime, loc *time.Location) (parsed time.Time, allDay bool) {
+	switch {
+	case t == nil:
+		return time.Time{}, false
+	case t.DateTime != "":
+		parsed, _ = time.Parse(time.RFC3339, t.DateTime)
+		return parsed, false
+	case t.Date != "":
+		parsed, _ = time.ParseInLocation("2006-01-02", t.Date, loc)
+		return parsed, true
+	}
+	return time.Time{}, false
+}
+
+// googleWorkingLocation describes the place of a working location event.
+func googleWorkingLocation(p *calendar.EventWorkingLocationProperties) string {
+	if p == nil {
+		return ""
+	}
+	switch p.Type {
+	case "homeOffice":
+		return "Home"
+	case "officeLocation":
+		o := p.OfficeLocation
+		if o == nil {
+			return "Office"
+		}
+		name := o.Label
+		if name == "" {
+			name = o.BuildingId
+		}
+		if name == "" {
+			name = "Office"
+		}
+		if o.FloorId != "" {
+			name += ", floor " + o.FloorId
+		}
+		return name
+	case "customLocation":
+		if p.CustomLocation != nil && p.CustomLocation.Label != "" {
+			return p.CustomLocation.Label
+		}
+		return "Other"
+	}
+	return ""
+}
@@ -1,12 +1,21 @@
 package gcal
 
 import (
+	"context"
 	"time"
 
-	"google.golang.org/api/calendar/v3"
+	"github.com/perbu/calvin/interval"
 )
 
-// CalendarService defines the interface for interacting with Google Calendar.
+// CalendarService is a calendar backend, such as Google Calendar or a CalDAV
+// server. Listings are returned in the backend-neutral Events model. Requests
+// are cancelled when ctx is done.
 type CalendarService interface {
-	ListEvents(calendarID string, theDate time.Time) (*calendar.Events, error)
+	ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error)
+	ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error)
+	SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error)
+	ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error)
+	ListCalendars(ctx context.Context) ([]*Calendar, error)
+	InsertEvent(ctx context.Context, calendarID string, event *Event) (*Event, error)
+	FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error)
 }
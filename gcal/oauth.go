@@ -7,32 +7,66 @@ import (
 	"github.com/perbu/calvin/config"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
 	"google.golang.org/api/calendar/v3"
+	"io"
 	"log"
 	"net/http"
 	"time"
 )
 
-// getTokenFromWeb handles OAuth2 authentication flow.
-func getTokenFromWeb(credBytes []byte, loader config.Loader) (*oauth2.Token, error) {
-	conf, err := google.ConfigFromJSON(credBytes, calendar.CalendarReadonlyScope)
+// Access selects what a token obtained by Login allows beyond reading calendars.
+type Access struct {
+	Write     bool // create events
+	Directory bool // read meeting rooms from the Workspace directory
+}
+
+// Login runs the OAuth2 flow and stores the new token, replacing any earlier one.
+func Login(ctx context.Context, loader config.Loader, access Access, w io.Writer) error {
+	credBytes, err := loader.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("loading credentials: %w", err)
+	}
+	_, err = getTokenFromWeb(ctx, credBytes, loader, w, access.scopes()...)
+	return err
+}
+
+// scopes returns the OAuth2 scopes to request. Reading calendars is always
+// included, as the events scope does not cover calendar metadata, calendar
+// lists or free/busy queries.
+func (a Access) scopes() []string {
+	scopes := []string{calendar.CalendarReadonlyScope}
+	if a.Write {
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	if a.Directory {
+		scopes = append(scopes, admin.AdminDirectoryResourceCalendarReadonlyScope)
+	}
+	return scopes
+}
+
+// getTokenFromWeb handles OAuth2 authentication flow. It gives up when ctx is done.
+func getTokenFromWeb(ctx context.Context, credBytes []byte, loader config.Loader, w io.Writer, scopes ...string) (*oauth2.Token, error) {
+	conf, err := google.ConfigFromJSON(credBytes, scopes...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
 	}
 
 	state := randomString(16)
-	codeCh := make(chan string)
+	codeCh := make(chan string, 1)
 	srv := &http.Server{Addr: ":8066"}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		if r.URL.Query().Get("state") != state {
-			_, _ = fmt.Fprintln(w, "Invalid state")
+			_, _ = fmt.Fprintln(rw, "Invalid state")
 			return
 		}
 		code := r.URL.Query().Get("code")
-		_, _ = fmt.Fprintln(w, "Received authentication code. You can close this page now.")
+		_, _ = fmt.Fprintln(rw, "Received authentication code. You can close this page now.")
 		codeCh <- code
 	})
+	srv.Handler = mux
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -42,19 +76,27 @@ func getTokenFromWeb(credBytes []byte, loader config.Loader) (*oauth2.Token, err
 
 	authURL := conf.AuthCodeURL(state,
 		oauth2.AccessTypeOffline,
+		oauth2.ApprovalForce,
 		oauth2.SetAuthURLParam("redirect_uri", "http://localhost:8066/"),
 	)
-	fmt.Printf("Go to the following link in your browser:\n%v\n", authURL)
+	fmt.Fprintf(w, "Go to the following link in your browser:\n%v\n", authURL)
 
-	authCode := <-codeCh
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var authCode string
+	select {
+	case authCode = <-codeCh:
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("HTTP server Shutdown: %v", err)
 	}
+	if authCode == "" {
+		return nil, fmt.Errorf("waiting for authorization: %w", ctx.Err())
+	}
 
-	tok, err := conf.Exchange(context.Background(), authCode,
+	tok, err := conf.Exchange(ctx, authCode,
 		oauth2.SetAuthURLParam("redirect_uri", "http://localhost:8066/"),
 	)
 	if err != nil {
@@ -0,0 +1,136 @@
+package gcal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/perbu/calvin/config"
+)
+
+const (
+	// peopleCacheName is the cache file holding attendees seen in earlier listings.
+	peopleCacheName = "people.json"
+	maxPeople       = 2000
+)
+
+// PeopleRecorder wraps a CalendarService and remembers the attendees of every
+// event it lists, so that shell completion can offer them later.
+type PeopleRecorder struct {
+	CalendarService
+	loader  config.Loader
+	profile string
+	seen    map[string]bool
+}
+
+// NewPeopleRecorder wraps s. Call Save to merge the recorded attendees into
+// the cache of the profile.
+func NewPeopleRecorder(s CalendarService, loader config.Loader, profile string) *PeopleRecorder {
+	return &PeopleRecorder{CalendarService: s, loader: loader, profile: profile, seen: make(map[string]bool)}
+}
+
+func (p *PeopleRecorder) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*Events, error) {
+	events, err := p.CalendarService.ListEvents(ctx, calendarID, theDate)
+	p.record(events)
+	return events, err
+}
+
+func (p *PeopleRecorder) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	events, err := p.CalendarService.ListEventsRange(ctx, calendarID, from, to)
+	p.record(events)
+	return events, err
+}
+
+func (p *PeopleRecorder) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*Events, error) {
+	events, err := p.CalendarService.SearchEvents(ctx, calendarID, query, from, to)
+	p.record(events)
+	return events, err
+}
+
+func (p *PeopleRecorder) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*Events, error) {
+	events, err := p.CalendarService.ListSeries(ctx, calendarID, from, to)
+	p.record(events)
+	return events, err
+}
+
+func (p *PeopleRecorder) record(events *Events) {
+	if events == nil {
+		return
+	}
+	for _, item := range events.Items {
+		for _, a := range item.Attendees {
+			if a.Email != "" && !a.Resource {
+				p.seen[a.Email] = true
+			}
+		}
+	}
+}
+
+// Save merges the recorded attendees into the people cache, noting the day
+// they were last seen. Beyond maxPeople, those not seen for the longest are
+// dropped. It does nothing if the cache would not change.
+func (p *PeopleRecorder) Save() error {
+	known := loadLastSeen(p.loader, p.profile)
+	today := time.Now().Format("2006-01-02")
+	changed := false
+	for email := range p.seen {
+		if known[email] != today {
+			known[email] = today
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if len(known) > maxPeople {
+		emails := make([]string, 0, len(known))
+		for email := range known {
+			emails = append(emails, email)
+		}
+		sort.Slice(emails, func(i, j int) bool {
+			if known[emails[i]] != known[emails[j]] {
+				return known[emails[i]] > known[emails[j]]
+			}
+			return emails[i] < emails[j]
+		})
+		for _, email := range emails[maxPeople:] {
+			delete(known, email)
+		}
+	}
+	b, err := json.Marshal(known)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return p.loader.SaveCache(profileCacheName(peopleCacheName, p.profile), b)
+}
+
+// LoadPeople returns the cached attendee addresses of the profile in
+// alphabetical order, or nil if there are none.
+func LoadPeople(loader config.Loader, profile string) []string {
+	known := loadLastSeen(loader, profile)
+	if len(known) == 0 {
+		return nil
+	}
+	people := make([]string, 0, len(known))
+	for email := range known {
+		people = append(people, email)
+	}
+	sort.Strings(people)
+	return people
+}
+
+// loadLastSeen returns the people cache as the day each address was last seen
+// on, keyed by address. It is empty if there is no cache.
+func loadLastSeen(loader config.Loader, profile string) map[string]string {
+	known := make(map[string]string)
+	b, err := loader.LoadCache(profileCacheName(peopleCacheName, profile))
+	if err != nil {
+		return known
+	}
+	if err := json.Unmarshal(b, &known); err != nil {
+		return make(map[string]string)
+	}
+	return known
+}
@@ -0,0 +1,252 @@
+package gcal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Series is a recurring event with its schedule.
+type Series struct {
+	Event    *Event
+	Schedule string        // the recurrence rule in words, e.g. "every 2 weeks on Tue"
+	Duration time.Duration // length of one instance, zero for all-day series
+	Weekly   time.Duration // average time the series takes per week
+}
+
+var weekdayNames = map[string]string{
+	"MO": "Mon", "TU": "Tue", "WE": "Wed", "TH": "Thu", "FR": "Fri", "SA": "Sat", "SU": "Sun",
+}
+
+// rrule holds the parts of an RRULE calvin understands.
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      []string
+	byMonthDay string
+	until      string
+	count      string
+}
+
+// parseRRule reads the RRULE line of an event's recurrence. ok is false if there is none.
+func parseRRule(recurrence []string) (r rrule, ok bool) {
+	for _, line := range recurrence {
+		rule, found := strings.CutPrefix(line, "RRULE:")
+		if !found {
+			continue
+		}
+		r.interval = 1
+		for _, part := range strings.Split(rule, ";") {
+			key, value, _ := strings.Cut(part, "=")
+			switch key {
+			case "FREQ":
+				r.freq = value
+			case "INTERVAL":
+				if n, err := strconv.Atoi(value); err == nil && n > 0 {
+					r.interval = n
+				}
+			case "BYDAY":
+				r.byDay = strings.Split(value, ",")
+			case "BYMONTHDAY":
+				r.byMonthDay = value
+			case "UNTIL":
+				r.until = value
+			case "COUNT":
+				r.count = value
+			}
+		}
+		return r, true
+	}
+	return rrule{}, false
+}
+
+// DescribeRecurrence turns an event's recurrence rules into words, such as
+// "every 2 weeks on Tue" or "every month on the last Fri".
+func DescribeRecurrence(recurrence []string) string {
+	r, ok := parseRRule(recurrence)
+	if !ok {
+		return "custom"
+	}
+	var s string
+	switch r.freq {
+	case "DAILY":
+		s = every(r.interval, "day")
+		if r.interval == 1 && strings.Join(r.byDay, ",") == "MO,TU,WE,TH,FR" {
+			s = "every weekday"
+		} else if len(r.byDay) > 0 {
+			s += " on " + dayNames(r.byDay)
+		}
+	case "WEEKLY":
+		s = every(r.interval, "week")
+		if len(r.byDay) > 0 {
+			s += " on " + dayNames(r.byDay)
+		}
+	case "MONTHLY":
+		s = every(r.interval, "month")
+		switch {
+		case len(r.byDay) > 0:
+			s += " on the " + dayNames(r.byDay)
+		case r.byMonthDay != "":
+			s += " on day " + r.byMonthDay
+		}
+	case "YEARLY":
+		s = every(r.interval, "year")
+	default:
+		return strings.ToLower(r.freq)
+	}
+	switch {
+	case r.until != "":
+		if until, err := time.Parse("20060102", r.until[:min(8, len(r.until))]); err == nil {
+			s += ", until " + until.Format("2006-01-02")
+		}
+	case r.count != "":
+		s += ", " + r.count + " times"
+	}
+	return s
+}
+
+func every(n int, unit string) string {
+	if n == 1 {
+		return "every " + unit
+	}
+	return fmt.Sprintf("every %d %ss", n, unit)
+}
+
+// dayNames turns BYDAY values such as "TU", "-1FR" or "+2MO" into "Tue",
+// "last Fri" or "2nd Mon".
+func dayNames(byDay []string) string {
+	var names []string
+	for _, d := range byDay {
+		if len(d) < 2 {
+			continue
+		}
+		prefix, day := d[:len(d)-2], weekdayNames[d[len(d)-2:]]
+		if prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			switch {
+			case err != nil || n == 0:
+				day = d
+			case n == -1:
+				day = "last " + day
+			case n < 0:
+				day = ordinal(-n) + "-to-last " + day
+			default:
+				day = ordinal(n) + " " + day
+			}
+		}
+		names = append(names, day)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ordinal returns n with its English ordinal suffix, such as "1st" or "12th".
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// perWeek estimates how many instances of the rule fall in an average week.
+func (r rrule) perWeek() float64 {
+	n := float64(max(1, len(r.byDay)))
+	switch r.freq {
+	case "DAILY":
+		if len(r.byDay) == 0 {
+			n = 7
+		}
+		return n / float64(r.interval)
+	case "WEEKLY":
+		return n / float64(r.interval)
+	case "MONTHLY":
+		return n * 12 / 52 / float64(r.interval)
+	case "YEARLY":
+		return 1.0 / 52 / float64(r.interval)
+	}
+	return 0
+}
+
+// RecurringSeries describes the series among items, the most time-consuming first.
+func RecurringSeries(items []*Event, loc *time.Location) []Series {
+	var series []Series
+	for _, item := range items {
+		if len(item.Recurrence) == 0 {
+			continue
+		}
+		s := Series{Event: item, Schedule: DescribeRecurrence(item.Recurrence)}
+		if start, end, ok := EventTimes(item); ok {
+			if loc != nil {
+				start = start.In(loc)
+			}
+			s.Schedule += " at " + start.Format("15:04")
+			s.Duration = end.Sub(start)
+			if r, ok := parseRRule(item.Recurrence); ok {
+				s.Weekly = time.Duration(float64(s.Duration) * r.perWeek()).Round(time.Minute)
+			}
+		}
+		series = append(series, s)
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Weekly > series[j].Weekly })
+	return series
+}
+
+// ListAndPrintRecurring prints the recurring series with instances in [from, to)
+// and the time they take per week. Declined series are listed but not counted
+// in the total.
+func ListAndPrintRecurring(ctx context.Context, s CalendarService, calendarID string, from, to time.Time, loc *time.Location, f *Formatter) error {
+	events, err := s.ListSeries(ctx, calendarID, from, to)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = defaultFormatter()
+	}
+
+	fmt.Fprintf(f.writer(), "Recurring events for %s\n", f.styles["header"].Sprint(calendarID))
+	series := RecurringSeries(events.Items, loc)
+	if len(series) == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No recurring events found."))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(f.writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUMMARY\tSCHEDULE\tLENGTH\tPER WEEK")
+	var total time.Duration
+	for _, s := range series {
+		summary := EventSummary(s.Event)
+		if IsDeclined(s.Event) {
+			summary += " (declined)"
+		} else {
+			total += s.Weekly
+		}
+		length, weekly := "all day", "-"
+		if s.Duration > 0 {
+			length, weekly = formatHours(s.Duration), formatHours(s.Weekly)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", summary, s.Schedule, length, weekly)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(f.writer(), "Total: %s per week\n", f.styles["time"].Sprint(formatHours(total)))
+	return nil
+}
+
+// formatHours formats d as e.g. "45m" or "26h30m", without rolling over into days.
+func formatHours(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,150 @@
+package gcal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults of RetryTransport.
+const (
+	DefaultMaxRetries = 4
+	DefaultRetryDelay = 500 * time.Millisecond
+	DefaultMaxDelay   = 30 * time.Second
+)
+
+// RetryTransport retries idempotent requests that fail with a network error,
+// 429, a rate limit 403 or a 5xx response. It waits with jittered exponential
+// backoff, or as long as the Retry-After header asks, up to MaxDelay.
+type RetryTransport struct {
+	Base       http.RoundTripper // nil means http.DefaultTransport
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	sleep func(ctx context.Context, d time.Duration) error // replaced in tests
+}
+
+// NewRetryTransport wraps base with the default retry settings.
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	return &RetryTransport{Base: base, MaxRetries: DefaultMaxRetries, BaseDelay: DefaultRetryDelay, MaxDelay: DefaultMaxDelay}
+}
+
+// RoundTrip implements http.RoundTripper. Retries send a clone of req, with
+// the body from req.GetBody, so req itself is not modified. Requests with a
+// body that cannot be read again are not retried.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if !isIdempotent(req) || !rewindable {
+		return base.RoundTrip(req)
+	}
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 {
+			r = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		resp, err := base.RoundTrip(r)
+		if attempt >= t.MaxRetries || !shouldRetry(req.Context(), resp, err) {
+			return resp, err
+		}
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = min(d, t.MaxDelay)
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		sleep := t.sleep
+		if sleep == nil {
+			sleep = sleepContext
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isIdempotent reports whether repeating req is safe. REPORT and PROPFIND are
+// the read-only queries of CalDAV.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, "REPORT", "PROPFIND":
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// shouldRetry reports whether the outcome of a request is likely transient.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		return isRateLimitResponse(resp)
+	}
+	return false
+}
+
+// isRateLimitResponse reports whether a 403 response is Google's way of saying
+// 429. The body is read and replaced so that the caller can still decode it.
+func isRateLimitResponse(resp *http.Response) bool {
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return err == nil && (bytes.Contains(b, []byte(`"rateLimitExceeded"`)) || bytes.Contains(b, []byte(`"userRateLimitExceeded"`)))
+}
+
+// backoff returns the delay before retry attempt+1: BaseDelay doubled per
+// attempt, capped at MaxDelay, with the upper half randomized.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	d := t.BaseDelay << attempt
+	if d <= 0 || d > t.MaxDelay {
+		d = t.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header, which holds seconds or an HTTP date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
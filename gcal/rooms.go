@@ -0,0 +1,239 @@
+package gcal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/interval"
+)
+
+// roomCacheName is the cache file holding the rooms last read from the directory.
+const roomCacheName = "rooms.json"
+
+// RoomDirectory lists the bookable rooms of an organization.
+type RoomDirectory interface {
+	ListRooms(ctx context.Context) ([]config.Room, error)
+}
+
+// AdminDirectory reads rooms from the Workspace Admin Directory resources API.
+// The token needs directory access, see Login.
+type AdminDirectory struct {
+	service *admin.Service
+}
+
+// NewAdminDirectory connects to the Admin Directory API.
+func NewAdminDirectory(ctx context.Context, loader config.Loader) (*AdminDirectory, error) {
+	client, err := httpClient(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("creating directory service: %w", err)
+	}
+	return &AdminDirectory{service: srv}, nil
+}
+
+// ListRooms returns the resource calendars of the "room" category, with building
+// IDs replaced by the building names.
+func (d *AdminDirectory) ListRooms(ctx context.Context) ([]config.Room, error) {
+	buildings := make(map[string]string)
+	err := d.service.Resources.Buildings.List("my_customer").Pages(ctx, func(page *admin.Buildings) error {
+		for _, b := range page.Buildings {
+			buildings[b.BuildingId] = b.BuildingName
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing buildings: %w", classify("", err))
+	}
+
+	var rooms []config.Room
+	err = d.service.Resources.Calendars.List("my_customer").Pages(ctx, func(page *admin.CalendarResources) error {
+		for _, r := range page.Items {
+			if r.ResourceCategory != "" && r.ResourceCategory != "CONFERENCE_ROOM" {
+				continue
+			}
+			building := buildings[r.BuildingId]
+			if building == "" {
+				building = r.BuildingId
+			}
+			rooms = append(rooms, config.Room{
+				Email:    r.ResourceEmail,
+				Name:     r.ResourceName,
+				Building: building,
+				Floor:    r.FloorName,
+				Capacity: int(r.Capacity),
+				Features: featureNames(r.FeatureInstances),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing rooms: %w", classify("", err))
+	}
+	return rooms, nil
+}
+
+// featureNames extracts the feature names from the untyped featureInstances field.
+func featureNames(instances interface{}) []string {
+	b, err := json.Marshal(instances)
+	if err != nil {
+		return nil
+	}
+	var decoded []admin.FeatureInstance
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil
+	}
+	var names []string
+	for _, fi := range decoded {
+		if fi.Feature != nil && fi.Feature.Name != "" {
+			names = append(names, fi.Feature.Name)
+		}
+	}
+	return names
+}
+
+// SaveRoomCache stores the room list of the profile so that the directory is
+// only read once.
+func SaveRoomCache(loader config.Loader, profile string, rooms []config.Room) error {
+	b, err := json.Marshal(rooms)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return loader.SaveCache(profileCacheName(roomCacheName, profile), b)
+}
+
+// LoadRoomCache returns the cached room list of the profile, or nil if there
+// is none.
+func LoadRoomCache(loader config.Loader, profile string) []config.Room {
+	b, err := loader.LoadCache(profileCacheName(roomCacheName, profile))
+	if err != nil {
+		return nil
+	}
+	var rooms []config.Room
+	if err := json.Unmarshal(b, &rooms); err != nil {
+		return nil
+	}
+	return rooms
+}
+
+// RoomFilter selects rooms. Zero fields match every room.
+type RoomFilter struct {
+	Building    string // case-insensitive substring of the building name
+	MinCapacity int
+	Feature     string // case-insensitive substring of a feature name
+}
+
+// Match reports whether the room passes the filter.
+func (f RoomFilter) Match(r config.Room) bool {
+	if f.Building != "" && !containsFold(r.Building, f.Building) {
+		return false
+	}
+	if r.Capacity < f.MinCapacity {
+		return false
+	}
+	if f.Feature != "" {
+		for _, feature := range r.Features {
+			if containsFold(feature, f.Feature) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// RoomStatus is the availability of a room in a time window.
+type RoomStatus struct {
+	Room  config.Room
+	Known bool // false if the free/busy query returned nothing for the room
+	Busy  []interval.Interval
+}
+
+// Free reports whether the room has no bookings in the window.
+func (s RoomStatus) Free() bool {
+	return s.Known && len(s.Busy) == 0
+}
+
+// RoomAvailability queries the free/busy state of the rooms in window. Free
+// rooms come first, then by building and name.
+func RoomAvailability(ctx context.Context, s CalendarService, rooms []config.Room, window interval.Interval) ([]RoomStatus, error) {
+	ids := make([]string, 0, len(rooms))
+	for _, r := range rooms {
+		ids = append(ids, r.Email)
+	}
+	busy, err := s.FreeBusy(ctx, ids, window.Start, window.End)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]RoomStatus, 0, len(rooms))
+	for _, r := range rooms {
+		periods, ok := busy[r.Email]
+		var overlapping []interval.Interval
+		for _, p := range periods {
+			if p.Overlaps(window) {
+				overlapping = append(overlapping, p)
+			}
+		}
+		statuses = append(statuses, RoomStatus{Room: r, Known: ok, Busy: overlapping})
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Free() != b.Free() {
+			return a.Free()
+		}
+		if a.Room.Building != b.Room.Building {
+			return a.Room.Building < b.Room.Building
+		}
+		return a.Room.Name < b.Room.Name
+	})
+	return statuses, nil
+}
+
+// PrintRooms prints the rooms as a table. Busy rooms are only listed if all is set.
+func PrintRooms(statuses []RoomStatus, window interval.Interval, all bool, f *Formatter) error {
+	if f == nil {
+		f = defaultFormatter()
+	}
+	fmt.Fprintf(f.writer(), "Rooms on %s from %s to %s\n",
+		f.styles["header"].Sprint(window.Start.Format("2006-01-02")),
+		f.styles["header"].Sprint(window.Start.Format("15:04")),
+		f.styles["header"].Sprint(window.End.Format("15:04")),
+	)
+
+	tw := tabwriter.NewWriter(f.writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tBUILDING\tFLOOR\tCAPACITY\tFEATURES\tSTATUS")
+	shown := 0
+	for _, s := range statuses {
+		status := f.styles["time"].Sprint("free")
+		switch {
+		case !s.Known:
+			status = f.styles["attendees"].Sprint("unknown")
+		case !s.Free():
+			var times []string
+			for _, b := range s.Busy {
+				times = append(times, b.Start.In(window.Start.Location()).Format("15:04")+"-"+b.End.In(window.Start.Location()).Format("15:04"))
+			}
+			status = f.styles["warning"].Sprint("busy " + strings.Join(times, ", "))
+		}
+		if !s.Free() && !all {
+			continue
+		}
+		shown++
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", s.Room.Name, s.Room.Building, s.Room.Floor, s.Room.Capacity, strings.Join(s.Room.Features, ", "), status)
+	}
+	if shown == 0 {
+		fmt.Fprintln(f.writer(), f.styles["warning"].Sprint("No free rooms found."))
+		return nil
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,148 @@
+package gcal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+const (
+	// statusLookahead is how far ahead "next" looks for an upcoming event.
+	statusLookahead = 24 * time.Hour
+
+	DefaultNextFormat = "{{.Summary}} in {{.Countdown}}"
+	DefaultNowFormat  = "{{.Summary}} ({{.Countdown}} left)"
+)
+
+// StatusMode selects which event a status line describes.
+type StatusMode int
+
+const (
+	StatusNext StatusMode = iota // the next event that has not started yet
+	StatusNow                    // the event currently in progress
+)
+
+// Status is the data passed to a status line template.
+type Status struct {
+	Summary   string
+	Location  string
+	Start     time.Time
+	End       time.Time
+	Until     time.Duration // time until the event starts, zero if it has started
+	Remaining time.Duration // time until the event ends
+	Countdown string        // Until for "next", Remaining for "now", formatted compactly
+}
+
+// FormatStatus returns a single line describing the current or next event relative to now.
+// It is meant for status bars such as tmux, i3blocks, waybar or polybar. If no event
+// matches, an empty string is returned.
+func FormatStatus(ctx context.Context, s CalendarService, calendarID string, mode StatusMode, now time.Time, format string) (string, error) {
+	if format == "" {
+		format = DefaultNextFormat
+		if mode == StatusNow {
+			format = DefaultNowFormat
+		}
+	}
+	tmpl, err := template.New("status").Parse(format)
+	if err != nil {
+		return "", fmt.Errorf("parsing format: %w", err)
+	}
+
+	from, to := now, now.Add(statusLookahead)
+	if mode == StatusNow {
+		to = now.Add(time.Minute)
+	}
+	events, err := s.ListEventsRange(ctx, calendarID, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	item, start, end := pickStatusEvent(events.Items, mode, now)
+	if item == nil {
+		return "", nil
+	}
+	st := Status{
+		Summary:   EventSummary(item),
+		Location:  extractURLs(item),
+		Start:     start,
+		End:       end,
+		Remaining: end.Sub(now),
+	}
+	if start.After(now) {
+		st.Until = start.Sub(now)
+	}
+	st.Countdown = formatCountdown(st.Until)
+	if mode == StatusNow {
+		st.Countdown = formatCountdown(st.Remaining)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, st); err != nil {
+		return "", fmt.Errorf("executing format: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// pickStatusEvent finds the first timed, non-declined event matching mode.
+// All-day events and working locations are skipped since they would always be "now".
+func pickStatusEvent(items []*Event, mode StatusMode, now time.Time) (*Event, time.Time, time.Time) {
+	for _, item := range items {
+		start, end, ok := EventTimes(item)
+		if !ok || IsDeclined(item) || item.EventType == EventTypeWorkingLocation {
+			continue
+		}
+		switch mode {
+		case StatusNow:
+			if !start.After(now) && end.After(now) {
+				return item, start, end
+			}
+		case StatusNext:
+			if start.After(now) {
+				return item, start, end
+			}
+		}
+	}
+	return nil, time.Time{}, time.Time{}
+}
+
+// NextEvent returns the first timed, non-declined event in items starting
+// after now, or nil if there is none.
+func NextEvent(items []*Event, now time.Time) *Event {
+	item, _, _ := pickStatusEvent(items, StatusNext, now)
+	return item
+}
+
+// EventTimes returns the start and end of a timed event. ok is false for all-day
+// events and events with missing times.
+func EventTimes(item *Event) (start, end time.Time, ok bool) {
+	if item.AllDay || item.Start.IsZero() || item.End.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	return item.Start, item.End, true
+}
+
+// IsDeclined reports whether the calendar owner has declined the event.
+func IsDeclined(item *Event) bool {
+	for _, a := range item.Attendees {
+		if a.Self {
+			return a.Response == ResponseDeclined
+		}
+	}
+	return false
+}
+
+// formatCountdown formats a duration compactly, e.g. "45s", "12m", "1h05m" or "2d3h".
+func formatCountdown(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
@@ -0,0 +1,334 @@
+package gcal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/perbu/calvin/config"
+)
+
+// Default templates. They reproduce calvin's built-in output.
+const (
+	DefaultDayTemplate    = `Listing events for {{.Date.Format "2006-01-02" | theme "header"}} ({{.CalendarID | theme "header"}}) [tz: {{.TimeZone | theme "header"}}]{{with .WorkingLocation}} [working from {{. | theme "header"}}]{{end}}...`
+	DefaultWeekTemplate   = `Listing events for the week of {{.From.Format "2006-01-02" | theme "header"}} to {{.To.Format "2006-01-02" | theme "header"}} ({{.CalendarID | theme "header"}}) [tz: {{.TimeZone | theme "header"}}]`
+	DefaultHeaderTemplate = `{{.Date.Format "=== Monday (Jan 2) ===" | theme "header"}}:{{with .WorkingLocation}} working from {{. | theme "attendees"}}{{end}}`
+	DefaultEventTemplate  = ` - {{if .Declined}}{{.Summary | theme "declined"}}{{else if eq .EventType "focusTime"}}{{.Summary | theme "focus"}}{{else}}{{.Summary | theme "summary"}}{{end}}{{if .Recurring}} {{"↻" | theme "attendees"}}{{end}} {{.TimeInfo}} {{printf "[%s]" (attendees 3 .Attendees) | theme "attendees"}} {{.Link}}{{if .Conflict}} {{"(conflict)" | theme "warning"}}{{else if .BackToBack}} {{"(back-to-back)" | theme "attendees"}}{{end}}`
+)
+
+// defaultTheme holds the built-in style of each theme element.
+var defaultTheme = config.Theme{
+	Header:    "cyan+bold",
+	Summary:   "yellow+bold",
+	Time:      "green",
+	Attendees: "hiblack",
+	Warning:   "red+bold",
+	Declined:  "hiblack+crossedout",
+	AllDay:    "green",
+	Focus:     "faint",
+}
+
+// Formatter renders listings using text/template. The zero value is not usable,
+// create one with NewFormatter.
+type Formatter struct {
+	day    *template.Template
+	week   *template.Template
+	header *template.Template
+	event  *template.Template
+	styles map[string]*color.Color // theme element name to color
+	out    io.Writer               // where listings are printed, default os.Stdout
+	colors string                  // the color mode, see SetColorMode
+}
+
+// SetOutput sets where the listing functions print to.
+func (f *Formatter) SetOutput(w io.Writer) { f.out = w }
+
+func (f *Formatter) writer() io.Writer {
+	if f.out == nil {
+		return os.Stdout
+	}
+	return f.out
+}
+
+// HeaderData is passed to the day view header and to the per-day header of the week view.
+type HeaderData struct {
+	Date            time.Time
+	CalendarID      string
+	TimeZone        string
+	WorkingLocation string // where the calendar owner works that day, if set
+}
+
+// WeekData is passed to the week view header.
+type WeekData struct {
+	From       time.Time
+	To         time.Time
+	CalendarID string
+	TimeZone   string
+}
+
+// EventData is passed to the event line template.
+type EventData struct {
+	Summary    string    // "(private)" or "(busy)" if the details are hidden
+	Start      time.Time // zero for all-day events
+	End        time.Time // zero for all-day events
+	Duration   time.Duration
+	AllDay     bool
+	EventType  string   // "default", "focusTime", "outOfOffice" or "workingLocation"
+	Recurring  bool     // an instance of a recurring event
+	Private    bool     // marked private or confidential
+	Declined   bool     // the calendar owner declined the event
+	Conflict   bool     // overlaps another event in the same listing
+	BackToBack bool     // starts or ends exactly when another event in the listing does
+	TimeInfo   string   // the built-in colored time column
+	Attendees  []string // excluding the calendar owner, home domain trimmed
+	Link       string   // hangout link or location
+	CalendarID string
+	Event      *Event
+}
+
+// NewFormatter parses the configured templates and theme, falling back to the
+// defaults for any field left empty.
+func NewFormatter(t config.Templates, theme config.Theme) (*Formatter, error) {
+	f := Formatter{styles: make(map[string]*color.Color)}
+	for name, spec := range map[string][2]string{
+		"header":    {theme.Header, defaultTheme.Header},
+		"summary":   {theme.Summary, defaultTheme.Summary},
+		"time":      {theme.Time, defaultTheme.Time},
+		"attendees": {theme.Attendees, defaultTheme.Attendees},
+		"warning":   {theme.Warning, defaultTheme.Warning},
+		"declined":  {theme.Declined, defaultTheme.Declined},
+		"allday":    {theme.AllDay, defaultTheme.AllDay},
+		"focus":     {theme.Focus, defaultTheme.Focus},
+	} {
+		if spec[0] == "" {
+			spec[0] = spec[1]
+		}
+		c, err := f.parseColor(spec[0])
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+		f.styles[name] = c
+	}
+
+	var err error
+	if f.day, err = f.parseTemplate("day", t.Day, DefaultDayTemplate); err != nil {
+		return nil, err
+	}
+	if f.week, err = f.parseTemplate("week", t.Week, DefaultWeekTemplate); err != nil {
+		return nil, err
+	}
+	if f.header, err = f.parseTemplate("header", t.Header, DefaultHeaderTemplate); err != nil {
+		return nil, err
+	}
+	if f.event, err = f.parseTemplate("event", t.Event, DefaultEventTemplate); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (f *Formatter) parseTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Funcs(f.templateFuncs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// defaultFormatter is used when callers pass a nil *Formatter.
+func defaultFormatter() *Formatter {
+	f, err := NewFormatter(config.Templates{}, config.Theme{})
+	if err != nil {
+		panic(err) // the built-in templates always parse
+	}
+	return f
+}
+
+// templateFuncs returns the helper functions available to all templates.
+func (f *Formatter) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// {{.Start | fmtTime "15:04"}}
+		"fmtTime": func(layout string, t time.Time) string { return t.Format(layout) },
+		// {{.Start | in "America/New_York" | fmtTime "15:04"}}
+		"in": func(name string, t time.Time) (time.Time, error) {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				return t, err
+			}
+			return t.In(loc), nil
+		},
+		// {{duration .Duration}} gives e.g. "45m" or "1h30m"
+		"duration": formatCountdown,
+		// {{attendees 3 .Attendees}} joins at most n names, then "..."
+		"attendees": func(n int, names []string) string { return joinLimited(names, n) },
+		// {{.Summary | color "yellow+bold"}}
+		"color": f.colorize,
+		// {{.Summary | theme "summary"}} uses the configured theme
+		"theme": f.style,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"join":  func(sep string, s []string) string { return strings.Join(s, sep) },
+	}
+}
+
+var colorAttributes = map[string]color.Attribute{
+	"bold":       color.Bold,
+	"faint":      color.Faint,
+	"italic":     color.Italic,
+	"underline":  color.Underline,
+	"crossedout": color.CrossedOut,
+	"black":      color.FgBlack,
+	"red":        color.FgRed,
+	"green":      color.FgGreen,
+	"yellow":     color.FgYellow,
+	"blue":       color.FgBlue,
+	"magenta":    color.FgMagenta,
+	"cyan":       color.FgCyan,
+	"white":      color.FgWhite,
+	"hiblack":    color.FgHiBlack,
+	"hired":      color.FgHiRed,
+	"higreen":    color.FgHiGreen,
+	"hiyellow":   color.FgHiYellow,
+	"hiblue":     color.FgHiBlue,
+	"himagenta":  color.FgHiMagenta,
+	"hicyan":     color.FgHiCyan,
+	"hiwhite":    color.FgHiWhite,
+}
+
+// CheckColorMode returns an error if mode is not a color mode SetColorMode accepts.
+func CheckColorMode(mode string) error {
+	switch mode {
+	case "", "auto", "always", "never":
+		return nil
+	}
+	return fmt.Errorf("invalid color mode %q, want auto, always or never", mode)
+}
+
+// SetColorMode controls whether f colors its output. "auto" colors only when
+// stdout is a terminal and NO_COLOR is unset, "always" and "never" force it.
+func (f *Formatter) SetColorMode(mode string) error {
+	if err := CheckColorMode(mode); err != nil {
+		return err
+	}
+	f.colors = mode
+	for _, c := range f.styles {
+		f.applyColorMode(c)
+	}
+	return nil
+}
+
+// applyColorMode enables or disables c as the color mode of f says.
+func (f *Formatter) applyColorMode(c *color.Color) {
+	switch f.colors {
+	case "always":
+		c.EnableColor()
+	case "never":
+		c.DisableColor()
+	default:
+		// fatih/color already checks NO_COLOR, TERM=dumb and whether stdout is a tty
+		if color.NoColor {
+			c.DisableColor()
+		} else {
+			c.EnableColor()
+		}
+	}
+}
+
+// colorize applies a color spec such as "yellow+bold" to s.
+func (f *Formatter) colorize(spec, s string) (string, error) {
+	c, err := f.parseColor(spec)
+	if err != nil {
+		return "", err
+	}
+	return c.Sprint(s), nil
+}
+
+// style applies the theme element name to s.
+func (f *Formatter) style(name, s string) (string, error) {
+	c, ok := f.styles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown theme element %q", name)
+	}
+	return c.Sprint(s), nil
+}
+
+// parseColor turns a spec of "+"-separated color and attribute names into a
+// color, enabled as the color mode of f says.
+func (f *Formatter) parseColor(spec string) (*color.Color, error) {
+	var attrs []color.Attribute
+	for _, name := range strings.Split(spec, "+") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		a, ok := colorAttributes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown color %q", name)
+		}
+		attrs = append(attrs, a)
+	}
+	c := color.New(attrs...)
+	f.applyColorMode(c)
+	return c, nil
+}
+
+// joinLimited joins up to n names, appending "..." once the limit is reached.
+func joinLimited(names []string, n int) string {
+	var who []string
+	for _, name := range names {
+		who = append(who, name)
+		if len(who) >= n {
+			who = append(who, "...")
+			break
+		}
+	}
+	return strings.Join(who, ", ")
+}
+
+func (f *Formatter) Day(d HeaderData) (string, error)    { return execute(f.day, d) }
+func (f *Formatter) Week(d WeekData) (string, error)     { return execute(f.week, d) }
+func (f *Formatter) Header(d HeaderData) (string, error) { return execute(f.header, d) }
+func (f *Formatter) Event(d EventData) (string, error)   { return execute(f.event, d) }
+
+func execute(tmpl *template.Template, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing %s template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// newEventData collects the template data for a single event.
+func (f *Formatter) newEventData(item *Event, calendarID, defaultDomain string, loc *time.Location) EventData {
+	d := EventData{
+		Summary:    EventSummary(item),
+		AllDay:     item.AllDay,
+		EventType:  item.EventType,
+		Recurring:  item.RecurringEventID != "" || len(item.Recurrence) > 0,
+		Private:    IsPrivate(item),
+		Declined:   IsDeclined(item),
+		TimeInfo:   formatTimeInfo(item, loc, f.styles["time"], f.styles["allday"]),
+		Attendees:  shortAttendees(item.Attendees, calendarID, defaultDomain),
+		Link:       extractURLs(item),
+		CalendarID: calendarID,
+		Event:      item,
+	}
+	if d.EventType == "" {
+		d.EventType = "default"
+	}
+	if start, end, ok := EventTimes(item); ok {
+		if loc != nil {
+			start, end = start.In(loc), end.In(loc)
+		}
+		d.Start, d.End, d.Duration = start, end, end.Sub(start)
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package gcal
+
+import (
+	"errors"
+	"time"
+
+	"github.com/perbu/calvin/interval"
+)
+
+// AccessFreeBusy is the access role of calendars that only share free/busy
+// information. Listings of such calendars contain untitled busy blocks.
+const AccessFreeBusy = "freeBusyReader"
+
+// IsPrivate reports whether the event is marked private or confidential.
+func IsPrivate(item *Event) bool {
+	return item.Visibility == "private" || item.Visibility == "confidential"
+}
+
+// EventSummary returns the event's summary, or "(private)" or "(busy)" for
+// events whose details are hidden from the caller.
+func EventSummary(item *Event) string {
+	switch {
+	case item.Summary != "":
+		return item.Summary
+	case IsPrivate(item):
+		return "(private)"
+	default:
+		return "(busy)"
+	}
+}
+
+// isAccessDenied reports whether err is the API refusing to show a calendar,
+// which it does with 404 for calendars the caller can only see free/busy for.
+func isAccessDenied(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrForbidden)
+}
+
+// BusyEvents turns busy periods into a listing of untitled events, for
+// calendars the caller may only see free/busy information for.
+func BusyEvents(periods []interval.Interval, loc *time.Location) *Events {
+	events := &Events{AccessRole: AccessFreeBusy, TimeZone: loc.String()}
+	for _, p := range periods {
+		events.Items = append(events.Items, &Event{Start: p.Start.In(loc), End: p.End.In(loc)})
+	}
+	return events
+}
@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"github.com/perbu/calvin/config"
+)
+
+// DefaultLoginURL is the Microsoft identity platform's sign-in host.
+const DefaultLoginURL = "https://login.microsoftonline.com"
+
+// ErrNotLoggedIn is returned when there is no stored token.
+var ErrNotLoggedIn = errors.New("not logged in to Microsoft 365, run 'calvin auth login'")
+
+// oauthConfig returns the OAuth2 configuration of the app registration. With
+// write, the token also allows creating events.
+func oauthConfig(cfg config.Graph, write bool) *oauth2.Config {
+	login, tenant := cfg.LoginURL, cfg.Tenant
+	if login == "" {
+		login = DefaultLoginURL
+	}
+	if tenant == "" {
+		tenant = "common"
+	}
+	base := strings.TrimSuffix(login, "/") + "/" + tenant + "/oauth2/v2.0/"
+	scopes := []string{"offline_access", "Calendars.Read", "Calendars.Read.Shared"}
+	if write {
+		scopes = []string{"offline_access", "Calendars.ReadWrite", "Calendars.ReadWrite.Shared"}
+	}
+	return &oauth2.Config{
+		ClientID: cfg.ClientID,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       base + "authorize",
+			TokenURL:      base + "token",
+			DeviceAuthURL: base + "devicecode",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+		Scopes: scopes,
+	}
+}
+
+// Login runs the OAuth2 device code flow: it prints a code to enter on
+// Microsoft's sign-in page, waits until the user has signed in and stores the
+// token as tokenName, replacing any earlier one. It gives up when ctx is done.
+func Login(ctx context.Context, cfg config.Graph, loader config.Loader, tokenName string, write bool, w io.Writer) error {
+	if cfg.ClientID == "" {
+		return fmt.Errorf("graph.Login: no \"client_id\" under \"graph\" in the config")
+	}
+	conf := oauthConfig(cfg, write)
+	da, err := conf.DeviceAuth(ctx)
+	if err != nil {
+		return fmt.Errorf("graph.Login: requesting a device code: %w", err)
+	}
+	fmt.Fprintf(w, "To sign in, open %s and enter the code %s\n", da.VerificationURI, da.UserCode)
+	tok, err := conf.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return fmt.Errorf("graph.Login: waiting for sign-in: %w", err)
+	}
+	return saveToken(loader, tokenName, tok)
+}
+
+// loadToken reads the token stored by Login.
+func loadToken(loader config.Loader, tokenName string) (*oauth2.Token, error) {
+	b, err := loader.LoadTokenFile(tokenName)
+	if err != nil {
+		return nil, ErrNotLoggedIn
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(b, &tok); err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+	return &tok, nil
+}
+
+func saveToken(loader config.Loader, tokenName string, tok *oauth2.Token) error {
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return fmt.Errorf("json.Marshal token: %w", err)
+	}
+	if err := loader.SaveTokenFile(tokenName, b); err != nil {
+		return fmt.Errorf("unable to save token: %w", err)
+	}
+	return nil
+}
+
+// savingTokenSource stores tokens when they are refreshed. Microsoft issues a
+// new refresh token with every refresh, so the stored one would grow stale.
+type savingTokenSource struct {
+	src       oauth2.TokenSource
+	loader    config.Loader
+	tokenName string
+
+	mu   sync.Mutex
+	last string // the access token last stored
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		// a failure to store it only costs a sign-in later
+		_ = saveToken(s.loader, s.tokenName, tok)
+	}
+	return tok, nil
+}
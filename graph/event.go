@@ -0,0 +1,246 @@
+package graph
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+// dateTimeLayout is the format of Graph's dateTime fields, which carry the
+// time zone separately.
+const dateTimeLayout = "2006-01-02T15:04:05.9999999"
+
+// dateTime is a Graph dateTimeTimeZone.
+type dateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+// parse returns the time, which is in UTC unless the time zone says otherwise.
+func (d dateTime) parse() (time.Time, error) {
+	loc := time.UTC
+	if d.TimeZone != "" && d.TimeZone != "UTC" {
+		if l, err := time.LoadLocation(d.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation(dateTimeLayout, d.DateTime, loc)
+}
+
+// date returns midnight in loc on the date of d, for all-day events, which
+// Graph sends as midnight regardless of the requested time zone.
+func (d dateTime) date(loc *time.Location) (time.Time, error) {
+	day, _, _ := strings.Cut(d.DateTime, "T")
+	return time.ParseInLocation("2006-01-02", day, loc)
+}
+
+type emailAddress struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+type attendee struct {
+	EmailAddress emailAddress `json:"emailAddress"`
+	Type         string       `json:"type"` // required, optional or resource
+	Status       *struct {
+		Response string `json:"response"`
+	} `json:"status,omitempty"`
+}
+
+// event is a Graph event, with the fields calvin uses.
+type event struct {
+	ID          string   `json:"id,omitempty"`
+	Subject     string   `json:"subject"`
+	BodyPreview string   `json:"bodyPreview,omitempty"`
+	Start       dateTime `json:"start"`
+	End         dateTime `json:"end"`
+	IsAllDay    bool     `json:"isAllDay"`
+	IsCancelled bool     `json:"isCancelled,omitempty"`
+	ShowAs      string   `json:"showAs,omitempty"`      // free, tentative, busy, oof, workingElsewhere or unknown
+	Sensitivity string   `json:"sensitivity,omitempty"` // normal, personal, private or confidential
+	WebLink     string   `json:"webLink,omitempty"`
+	Location    struct {
+		DisplayName string `json:"displayName"`
+	} `json:"location"`
+	OnlineMeeting *struct {
+		JoinURL string `json:"joinUrl"`
+	} `json:"onlineMeeting,omitempty"`
+	OnlineMeetingURL string `json:"onlineMeetingUrl,omitempty"`
+	Organizer        *struct {
+		EmailAddress emailAddress `json:"emailAddress"`
+	} `json:"organizer,omitempty"`
+	Attendees      []attendee  `json:"attendees"`
+	SeriesMasterID string      `json:"seriesMasterId,omitempty"`
+	Recurrence     *recurrence `json:"recurrence,omitempty"`
+	Body           *struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	} `json:"body,omitempty"`
+}
+
+type recurrence struct {
+	Pattern struct {
+		Type       string   `json:"type"` // daily, weekly, absoluteMonthly, relativeMonthly, absoluteYearly or relativeYearly
+		Interval   int      `json:"interval"`
+		Month      int      `json:"month"`
+		DayOfMonth int      `json:"dayOfMonth"`
+		DaysOfWeek []string `json:"daysOfWeek"`
+		Index      string   `json:"index"` // first, second, third, fourth or last
+	} `json:"pattern"`
+	Range struct {
+		Type                string `json:"type"` // endDate, noEnd or numbered
+		EndDate             string `json:"endDate"`
+		NumberOfOccurrences int    `json:"numberOfOccurrences"`
+	} `json:"range"`
+}
+
+// responses maps Graph's response status to gcal's.
+var responses = map[string]string{
+	"accepted":            gcal.ResponseAccepted,
+	"organizer":           gcal.ResponseAccepted,
+	"declined":            gcal.ResponseDeclined,
+	"tentativelyAccepted": gcal.ResponseTentative,
+}
+
+// toEvent converts the event, marking self as the calendar owner's attendee.
+// Times are local, and all-day events start at local midnight.
+func (item *event) toEvent(self string) *gcal.Event {
+	e := &gcal.Event{
+		ID:               item.ID,
+		Summary:          item.Subject,
+		Description:      item.BodyPreview,
+		Location:         item.Location.DisplayName,
+		HTMLLink:         item.WebLink,
+		AllDay:           item.IsAllDay,
+		Transparent:      item.ShowAs == "free",
+		RecurringEventID: item.SeriesMasterID,
+	}
+	if item.IsAllDay {
+		e.Start, _ = item.Start.date(time.Local)
+		e.End, _ = item.End.date(time.Local)
+	} else {
+		start, _ := item.Start.parse()
+		end, _ := item.End.parse()
+		e.Start, e.End = start.In(time.Local), end.In(time.Local)
+	}
+	if item.OnlineMeeting != nil && item.OnlineMeeting.JoinURL != "" {
+		e.ConferenceURL = item.OnlineMeeting.JoinURL
+	} else {
+		e.ConferenceURL = item.OnlineMeetingURL
+	}
+	if item.ShowAs == "oof" {
+		e.EventType = gcal.EventTypeOutOfOffice
+	}
+	if item.Sensitivity == "private" || item.Sensitivity == "confidential" {
+		e.Visibility = item.Sensitivity
+	}
+	if item.Organizer != nil && item.Organizer.EmailAddress.Address != "" {
+		org := item.Organizer.EmailAddress
+		e.Attendees = append(e.Attendees, gcal.Attendee{
+			Email:     org.Address,
+			Name:      org.Name,
+			Response:  gcal.ResponseAccepted,
+			Self:      strings.EqualFold(org.Address, self),
+			Organizer: true,
+		})
+	}
+	for _, a := range item.Attendees {
+		if item.Organizer != nil && strings.EqualFold(a.EmailAddress.Address, item.Organizer.EmailAddress.Address) {
+			continue
+		}
+		response := gcal.ResponseNeedsAction
+		if a.Status != nil {
+			if r, ok := responses[a.Status.Response]; ok {
+				response = r
+			}
+		}
+		e.Attendees = append(e.Attendees, gcal.Attendee{
+			Email:    a.EmailAddress.Address,
+			Name:     a.EmailAddress.Name,
+			Response: response,
+			Self:     self != "" && strings.EqualFold(a.EmailAddress.Address, self),
+			Resource: a.Type == "resource",
+		})
+	}
+	if item.Recurrence != nil {
+		e.Recurrence = []string{item.Recurrence.rrule()}
+	}
+	return e
+}
+
+// rrule returns the recurrence as an iCalendar RRULE line.
+func (r *recurrence) rrule() string {
+	p := r.Pattern
+	parts := []string{}
+	switch p.Type {
+	case "daily":
+		parts = append(parts, "FREQ=DAILY")
+	case "weekly":
+		parts = append(parts, "FREQ=WEEKLY", "BYDAY="+byDay(p.DaysOfWeek, ""))
+	case "absoluteMonthly":
+		parts = append(parts, "FREQ=MONTHLY", "BYMONTHDAY="+strconv.Itoa(p.DayOfMonth))
+	case "relativeMonthly":
+		parts = append(parts, "FREQ=MONTHLY", "BYDAY="+byDay(p.DaysOfWeek, p.Index))
+	case "absoluteYearly":
+		parts = append(parts, "FREQ=YEARLY", "BYMONTH="+strconv.Itoa(p.Month), "BYMONTHDAY="+strconv.Itoa(p.DayOfMonth))
+	case "relativeYearly":
+		parts = append(parts, "FREQ=YEARLY", "BYMONTH="+strconv.Itoa(p.Month), "BYDAY="+byDay(p.DaysOfWeek, p.Index))
+	}
+	if p.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(p.Interval))
+	}
+	switch r.Range.Type {
+	case "numbered":
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Range.NumberOfOccurrences))
+	case "endDate":
+		if until, err := time.Parse("2006-01-02", r.Range.EndDate); err == nil {
+			parts = append(parts, "UNTIL="+until.Format("20060102"))
+		}
+	}
+	return "RRULE:" + strings.Join(parts, ";")
+}
+
+var weekIndexes = map[string]string{"first": "1", "second": "2", "third": "3", "fourth": "4", "last": "-1"}
+
+// byDay returns the days as a BYDAY value, each prefixed with the week index if given.
+func byDay(days []string, index string) string {
+	prefix := weekIndexes[index]
+	var out []string
+	for _, d := range days {
+		if len(d) >= 2 {
+			out = append(out, prefix+strings.ToUpper(d[:2]))
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// fromEvent converts an event for creating it, inviting its attendees.
+func fromEvent(e *gcal.Event) *event {
+	item := &event{
+		Subject:  e.Summary,
+		IsAllDay: e.AllDay,
+		Body: &struct {
+			ContentType string `json:"contentType"`
+			Content     string `json:"content"`
+		}{ContentType: "text", Content: e.Description},
+	}
+	if e.AllDay {
+		// all-day events must start and end at midnight in the given zone
+		item.Start = dateTime{DateTime: e.Start.Format("2006-01-02") + "T00:00:00", TimeZone: "UTC"}
+		item.End = dateTime{DateTime: e.End.Format("2006-01-02") + "T00:00:00", TimeZone: "UTC"}
+	} else {
+		item.Start = dateTime{DateTime: e.Start.UTC().Format(dateTimeLayout), TimeZone: "UTC"}
+		item.End = dateTime{DateTime: e.End.UTC().Format(dateTimeLayout), TimeZone: "UTC"}
+	}
+	item.Location.DisplayName = e.Location
+	for _, a := range e.Attendees {
+		kind := "required"
+		if a.Resource {
+			kind = "resource"
+		}
+		item.Attendees = append(item.Attendees, attendee{EmailAddress: emailAddress{Name: a.Name, Address: a.Email}, Type: kind})
+	}
+	return item
+}
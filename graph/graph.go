@@ -0,0 +1,342 @@
+// Package graph implements gcal.CalendarService for Microsoft 365 and
+// Outlook.com calendars through the Microsoft Graph API.
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// DefaultURL is the root of the Microsoft Graph API.
+const DefaultURL = "https://graph.microsoft.com/v1.0"
+
+// Client reads events through the Graph API. Calendar IDs are email addresses
+// for users' default calendars, other IDs name calendars of the signed-in user.
+type Client struct {
+	URL        string // API root, such as DefaultURL
+	HTTPClient *http.Client
+}
+
+// New creates a client from the Graph settings of the config, signed in with
+// the token stored as tokenName by Login. Refreshed tokens are stored again,
+// and requests are retried on transient failures, see gcal.RetryTransport.
+func New(ctx context.Context, cfg config.Graph, loader config.Loader, tokenName string) (*Client, error) {
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("graph.New: no \"client_id\" under \"graph\" in the config")
+	}
+	tok, err := loadToken(loader, tokenName)
+	if err != nil {
+		return nil, fmt.Errorf("graph.New: %w", err)
+	}
+	base := &http.Client{Transport: gcal.NewRetryTransport(http.DefaultTransport)}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	src := &savingTokenSource{
+		src:       oauthConfig(cfg, false).TokenSource(ctx, tok),
+		loader:    loader,
+		tokenName: tokenName,
+		last:      tok.AccessToken,
+	}
+	apiURL := cfg.URL
+	if apiURL == "" {
+		apiURL = DefaultURL
+	}
+	return &Client{
+		URL:        strings.TrimSuffix(apiURL, "/"),
+		HTTPClient: &http.Client{Transport: &oauth2.Transport{Source: src, Base: base.Transport}},
+	}, nil
+}
+
+// calendarPath returns the API path of calendarID, relative to the API root.
+func calendarPath(calendarID string) string {
+	if strings.Contains(calendarID, "@") {
+		return "/users/" + url.PathEscape(calendarID)
+	}
+	return "/me/calendars/" + url.PathEscape(calendarID)
+}
+
+// ListEvents retrieves the events of the day theDate falls on, in the local time zone.
+func (c *Client) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	from, to := gcal.LocalDay(theDate)
+	return c.ListEventsRange(ctx, calendarID, from, to)
+}
+
+// ListEventsRange retrieves the events overlapping [from, to), with recurring
+// events expanded into their instances. Calendars the caller may only see
+// free/busy information for are listed as untitled busy blocks.
+func (c *Client) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	events, err := c.calendarView(ctx, calendarID, from, to)
+	if errors.Is(err, gcal.ErrNotFound) || errors.Is(err, gcal.ErrForbidden) {
+		events, err = c.scheduleEvents(ctx, calendarID, from, to, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("retrieving events: %w", err)
+	}
+	return events, nil
+}
+
+// SearchEvents retrieves the events in [from, to) whose summary, location or
+// description contain query. Graph cannot search a calendar view, so the
+// matching is done here.
+func (c *Client) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	events, err := c.calendarView(ctx, calendarID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("searching events: %w", err)
+	}
+	return gcal.Filter{Grep: query}.Apply(events), nil
+}
+
+// ListSeries retrieves the recurring events with instances in [from, to) as
+// their series. Single events are left out.
+func (c *Client) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	instances, err := c.calendarView(ctx, calendarID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", err)
+	}
+	events := &gcal.Events{TimeZone: instances.TimeZone}
+	seen := make(map[string]bool)
+	for _, item := range instances.Items {
+		if item.RecurringEventID == "" || seen[item.RecurringEventID] {
+			continue
+		}
+		seen[item.RecurringEventID] = true
+		var master event
+		if err := c.do(ctx, http.MethodGet, calendarPath(calendarID)+"/events/"+url.PathEscape(item.RecurringEventID), nil, &master, calendarID); err != nil {
+			return nil, fmt.Errorf("retrieving recurring events: %w", err)
+		}
+		events.Items = append(events.Items, master.toEvent(gcal.Owner(calendarID)))
+	}
+	return events, nil
+}
+
+// ListCalendars retrieves the signed-in user's calendars, including those
+// shared with them. The default calendar is listed under the user's address.
+func (c *Client) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	var page struct {
+		Value []struct {
+			ID                string `json:"id"`
+			Name              string `json:"name"`
+			HexColor          string `json:"hexColor"`
+			IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+			CanEdit           bool   `json:"canEdit"`
+			Owner             struct {
+				Address string `json:"address"`
+			} `json:"owner"`
+		} `json:"value"`
+		NextLink string `json:"@odata.nextLink"`
+	}
+	var entries []*gcal.Calendar
+	next := "/me/calendars"
+	for next != "" {
+		page.Value, page.NextLink = nil, ""
+		if err := c.do(ctx, http.MethodGet, next, nil, &page, ""); err != nil {
+			return nil, fmt.Errorf("listing calendars: %w", err)
+		}
+		for _, item := range page.Value {
+			entry := &gcal.Calendar{ID: item.ID, Name: item.Name, Primary: item.IsDefaultCalendar, AccessRole: "reader", TimeZone: "Local", Color: item.HexColor}
+			if item.IsDefaultCalendar && item.Owner.Address != "" {
+				entry.ID = item.Owner.Address
+			}
+			switch {
+			case item.IsDefaultCalendar:
+				entry.AccessRole = "owner"
+			case item.CanEdit:
+				entry.AccessRole = "writer"
+			}
+			entries = append(entries, entry)
+		}
+		next = page.NextLink
+	}
+	return entries, nil
+}
+
+// InsertEvent creates an event in calendarID and invites its attendees.
+func (c *Client) InsertEvent(ctx context.Context, calendarID string, e *gcal.Event) (*gcal.Event, error) {
+	var created event
+	if err := c.do(ctx, http.MethodPost, calendarPath(calendarID)+"/events", fromEvent(e), &created, calendarID); err != nil {
+		return nil, fmt.Errorf("inserting event: %w", err)
+	}
+	return created.toEvent(gcal.Owner(calendarID)), nil
+}
+
+// FreeBusy returns the busy times of each calendar in [from, to). Calendars
+// the API reports errors for, such as unknown ones, are left out of the result.
+func (c *Client) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	const maxPerQuery = 20
+	busy := make(map[string][]interval.Interval)
+	window := interval.Interval{Start: from, End: to}
+	for len(calendarIDs) > 0 {
+		batch := calendarIDs[:min(maxPerQuery, len(calendarIDs))]
+		calendarIDs = calendarIDs[len(batch):]
+
+		req := map[string]any{
+			"schedules": batch,
+			"startTime": dateTime{DateTime: from.UTC().Format(dateTimeLayout), TimeZone: "UTC"},
+			"endTime":   dateTime{DateTime: to.UTC().Format(dateTimeLayout), TimeZone: "UTC"},
+		}
+		var resp struct {
+			Value []struct {
+				ScheduleID    string `json:"scheduleId"`
+				ScheduleItems []struct {
+					Status string   `json:"status"`
+					Start  dateTime `json:"start"`
+					End    dateTime `json:"end"`
+				} `json:"scheduleItems"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			} `json:"value"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/me/calendar/getSchedule", req, &resp, ""); err != nil {
+			return nil, fmt.Errorf("querying free/busy: %w", err)
+		}
+		for _, schedule := range resp.Value {
+			if schedule.Error != nil {
+				continue
+			}
+			var periods []interval.Interval
+			for _, item := range schedule.ScheduleItems {
+				if item.Status != "busy" && item.Status != "tentative" && item.Status != "oof" {
+					continue
+				}
+				start, err1 := item.Start.parse()
+				end, err2 := item.End.parse()
+				if err1 != nil || err2 != nil {
+					continue
+				}
+				if p, ok := (interval.Interval{Start: start, End: end}).Intersect(window); ok {
+					periods = append(periods, p)
+				}
+			}
+			busy[schedule.ScheduleID] = append([]interval.Interval{}, interval.Merge(periods)...)
+		}
+	}
+	return busy, nil
+}
+
+// scheduleEvents lists calendarID through getSchedule, for callers without
+// access to the events. It returns cause if the schedule does not cover the
+// calendar either, so that unknown calendars still fail.
+func (c *Client) scheduleEvents(ctx context.Context, calendarID string, from, to time.Time, cause error) (*gcal.Events, error) {
+	busy, err := c.FreeBusy(ctx, []string{calendarID}, from, to)
+	if err != nil {
+		return nil, cause
+	}
+	periods, ok := busy[calendarID]
+	if !ok {
+		return nil, cause
+	}
+	return gcal.BusyEvents(periods, time.Local), nil
+}
+
+// calendarView retrieves the instances of the events overlapping [from, to),
+// following the result pages. Cancelled events are left out.
+func (c *Client) calendarView(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	q := url.Values{}
+	q.Set("startDateTime", from.UTC().Format(time.RFC3339))
+	q.Set("endDateTime", to.UTC().Format(time.RFC3339))
+	q.Set("$top", "100")
+	next := calendarPath(calendarID) + "/calendarView?" + q.Encode()
+
+	events := &gcal.Events{TimeZone: "Local"}
+	for next != "" {
+		var page struct {
+			Value    []event `json:"value"`
+			NextLink string  `json:"@odata.nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, next, nil, &page, calendarID); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Value {
+			if !item.IsCancelled {
+				events.Items = append(events.Items, item.toEvent(gcal.Owner(calendarID)))
+			}
+		}
+		next = page.NextLink
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool { return events.Items[i].Start.Before(events.Items[j].Start) })
+	return events, nil
+}
+
+// do sends a request to path, which is relative to the API root unless it is
+// a full URL such as a next page link, and decodes the JSON response into out.
+// Times in the response are in UTC.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, calendarID string) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		path = c.URL + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Prefer", `outlook.timezone="UTC"`)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return &gcal.APIError{Kind: gcal.ErrAuthExpired, CalendarID: calendarID, Err: err}
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(calendarID, resp, b)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return nil
+}
+
+// statusError turns a failed response into an error, classified like the
+// errors of the Google backend where possible.
+func statusError(calendarID string, resp *http.Response, body []byte) error {
+	var graphErr struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err := fmt.Errorf("graph: %s", resp.Status)
+	if json.Unmarshal(body, &graphErr) == nil && graphErr.Error.Message != "" {
+		err = fmt.Errorf("graph: %s: %s", resp.Status, graphErr.Error.Message)
+	}
+	if kind := gcal.StatusKind(resp.StatusCode); kind != nil {
+		return &gcal.APIError{Kind: kind, CalendarID: calendarID, Err: err}
+	}
+	return err
+}
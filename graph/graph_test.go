@@ -0,0 +1,299 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/gcal"
+)
+
+// fakeGraph serves alice's calendar, which bob shares with her, and carol's,
+// which only shares free/busy information.
+func fakeGraph(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/alice@example.com/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Prefer") != `outlook.timezone="UTC"` {
+			t.Errorf("calendarView request without the UTC preference: %q", r.Header.Get("Prefer"))
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"value": [
+				{"id": "holiday", "subject": "Vacation", "isAllDay": true, "showAs": "oof",
+				 "start": {"dateTime": "2025-01-28T00:00:00.0000000", "timeZone": "UTC"},
+				 "end": {"dateTime": "2025-01-29T00:00:00.0000000", "timeZone": "UTC"}},
+				{"id": "standup-0129", "subject": "Standup", "seriesMasterId": "standup",
+				 "start": {"dateTime": "2025-01-29T08:00:00.0000000", "timeZone": "UTC"},
+				 "end": {"dateTime": "2025-01-29T08:15:00.0000000", "timeZone": "UTC"}}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"value": [
+			{"id": "sync", "subject": "Sync", "bodyPreview": "Agenda", "sensitivity": "private",
+			 "start": {"dateTime": "2025-01-27T10:00:00.0000000", "timeZone": "UTC"},
+			 "end": {"dateTime": "2025-01-27T10:30:00.0000000", "timeZone": "UTC"},
+			 "location": {"displayName": "Fjord"}, "onlineMeeting": {"joinUrl": "https://teams.example.com/join"},
+			 "organizer": {"emailAddress": {"name": "Bob", "address": "bob@example.com"}},
+			 "attendees": [
+				{"type": "required", "emailAddress": {"address": "bob@example.com"}, "status": {"response": "none"}},
+				{"type": "required", "emailAddress": {"name": "Alice", "address": "alice@example.com"}, "status": {"response": "tentativelyAccepted"}},
+				{"type": "resource", "emailAddress": {"address": "fjord@example.com"}, "status": {"response": "accepted"}}]},
+			{"id": "gone", "subject": "Cancelled", "isCancelled": true,
+			 "start": {"dateTime": "2025-01-27T12:00:00.0000000", "timeZone": "UTC"},
+			 "end": {"dateTime": "2025-01-27T13:00:00.0000000", "timeZone": "UTC"}}],
+			"@odata.nextLink": "%s/users/alice@example.com/calendarView?page=2"}`, srv.URL)
+	})
+	mux.HandleFunc("GET /users/alice@example.com/events/standup", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "standup", "subject": "Standup",
+			"start": {"dateTime": "2025-01-06T08:00:00.0000000", "timeZone": "UTC"},
+			"end": {"dateTime": "2025-01-06T08:15:00.0000000", "timeZone": "UTC"},
+			"recurrence": {"pattern": {"type": "weekly", "interval": 1, "daysOfWeek": ["monday", "wednesday"]},
+			               "range": {"type": "noEnd", "startDate": "2025-01-06"}}}`)
+	})
+	mux.HandleFunc("GET /users/carol@example.com/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error": {"code": "ErrorAccessDenied", "message": "Access is denied."}}`)
+	})
+	mux.HandleFunc("GET /users/nobody@example.com/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": {"code": "ErrorItemNotFound", "message": "The specified object was not found in the store."}}`)
+	})
+	mux.HandleFunc("GET /users/expired@example.com/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("GET /users/busy@example.com/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("POST /me/calendar/getSchedule", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Schedules []string `json:"schedules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding getSchedule request: %v", err)
+		}
+		var value []string
+		for _, id := range req.Schedules {
+			if id != "carol@example.com" {
+				value = append(value, fmt.Sprintf(`{"scheduleId": %q, "error": {"message": "not found", "responseCode": "ErrorMailRecipientNotFound"}}`, id))
+				continue
+			}
+			value = append(value, `{"scheduleId": "carol@example.com", "scheduleItems": [
+				{"status": "busy", "start": {"dateTime": "2025-01-27T09:00:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2025-01-27T10:00:00.0000000", "timeZone": "UTC"}},
+				{"status": "oof", "start": {"dateTime": "2025-01-27T09:30:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2025-01-27T11:00:00.0000000", "timeZone": "UTC"}},
+				{"status": "free", "start": {"dateTime": "2025-01-27T13:00:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2025-01-27T14:00:00.0000000", "timeZone": "UTC"}}]}`)
+		}
+		fmt.Fprintf(w, `{"value": [%s]}`, strings.Join(value, ","))
+	})
+	mux.HandleFunc("GET /me/calendars", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": [
+			{"id": "AAMk1", "name": "Calendar", "hexColor": "#0078d4", "isDefaultCalendar": true, "canEdit": true, "owner": {"address": "alice@example.com"}},
+			{"id": "AAMk2", "name": "Bob's calendar", "canEdit": false, "owner": {"address": "bob@example.com"}}]}`)
+	})
+	mux.HandleFunc("POST /users/alice@example.com/events", func(w http.ResponseWriter, r *http.Request) {
+		var created event
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Errorf("decoding new event: %v", err)
+		}
+		created.ID = "new"
+		json.NewEncoder(w).Encode(created)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := fakeGraph(t)
+	c := &Client{URL: srv.URL, HTTPClient: srv.Client()}
+	ctx := context.Background()
+	from := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	utc := func(s string) time.Time {
+		parsed, _ := time.Parse(time.RFC3339, s)
+		return parsed
+	}
+
+	events, err := c.ListEventsRange(ctx, "alice@example.com", from, to)
+	if err != nil {
+		t.Fatalf("ListEventsRange returned error: %v", err)
+	}
+	if len(events.Items) != 3 {
+		t.Fatalf("ListEventsRange returned %d events, want 3 without the cancelled one", len(events.Items))
+	}
+	sync, vacation := events.Items[0], events.Items[1]
+	if sync.Summary != "Sync" || !sync.Start.Equal(utc("2025-01-27T10:00:00Z")) || !sync.End.Equal(utc("2025-01-27T10:30:00Z")) ||
+		sync.Location != "Fjord" || sync.ConferenceURL != "https://teams.example.com/join" || !gcal.IsPrivate(sync) {
+		t.Errorf("sync = %+v", sync)
+	}
+	wantAttendees := []gcal.Attendee{
+		{Email: "bob@example.com", Name: "Bob", Response: gcal.ResponseAccepted, Organizer: true},
+		{Email: "alice@example.com", Name: "Alice", Response: gcal.ResponseTentative, Self: true},
+		{Email: "fjord@example.com", Response: gcal.ResponseAccepted, Resource: true},
+	}
+	if fmt.Sprint(sync.Attendees) != fmt.Sprint(wantAttendees) {
+		t.Errorf("sync attendees = %+v, want %+v", sync.Attendees, wantAttendees)
+	}
+	if !vacation.AllDay || vacation.EventType != gcal.EventTypeOutOfOffice || vacation.Start.Format("2006-01-02 15:04") != "2025-01-28 00:00" || vacation.Start.Location() != time.Local {
+		t.Errorf("vacation = %+v, want an all-day out of office event at local midnight", vacation)
+	}
+
+	series, err := c.ListSeries(ctx, "alice@example.com", from, to)
+	if err != nil || len(series.Items) != 1 || fmt.Sprint(series.Items[0].Recurrence) != "[RRULE:FREQ=WEEKLY;BYDAY=MO,WE]" {
+		t.Errorf("ListSeries = %v, %v, want the weekly standup", series, err)
+	}
+
+	found, err := c.SearchEvents(ctx, "alice@example.com", "agenda", from, to)
+	if err != nil || len(found.Items) != 1 || found.Items[0].ID != "sync" {
+		t.Errorf("SearchEvents = %v, %v, want the sync", found, err)
+	}
+
+	carol, err := c.ListEventsRange(ctx, "carol@example.com", from, to)
+	if err != nil {
+		t.Fatalf("ListEventsRange(carol) returned error: %v", err)
+	}
+	if carol.AccessRole != gcal.AccessFreeBusy || len(carol.Items) != 1 || carol.Items[0].End.Sub(carol.Items[0].Start) != 2*time.Hour {
+		t.Errorf("ListEventsRange(carol) = %+v, want one merged busy block", carol)
+	}
+
+	busy, err := c.FreeBusy(ctx, []string{"carol@example.com", "nobody@example.com"}, from, to)
+	if err != nil || len(busy) != 1 || len(busy["carol@example.com"]) != 1 {
+		t.Errorf("FreeBusy = %v, %v, want carol's busy block only", busy, err)
+	}
+
+	calendars, err := c.ListCalendars(ctx)
+	if err != nil || len(calendars) != 2 {
+		t.Fatalf("ListCalendars = %v, %v", calendars, err)
+	}
+	if got := calendars[0]; got.ID != "alice@example.com" || !got.Primary || got.AccessRole != "owner" || got.Color != "#0078d4" {
+		t.Errorf("default calendar = %+v", got)
+	}
+	if got := calendars[1]; got.ID != "AAMk2" || got.AccessRole != "reader" {
+		t.Errorf("shared calendar = %+v", got)
+	}
+
+	created, err := c.InsertEvent(ctx, "alice@example.com", &gcal.Event{
+		Summary: "Lunch", Start: utc("2025-01-30T11:00:00Z"), End: utc("2025-01-30T12:00:00Z"),
+		Attendees: []gcal.Attendee{{Email: "bob@example.com"}},
+	})
+	if err != nil || created.ID != "new" || created.Summary != "Lunch" || !created.Start.Equal(utc("2025-01-30T11:00:00Z")) || len(created.Attendees) != 1 {
+		t.Errorf("InsertEvent = %+v, %v", created, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := fakeGraph(t)
+	c := &Client{URL: srv.URL, HTTPClient: srv.Client()}
+	from := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		calendarID string
+		want       error
+	}{
+		{"nobody@example.com", gcal.ErrNotFound},
+		{"expired@example.com", gcal.ErrAuthExpired},
+		{"busy@example.com", gcal.ErrRateLimited},
+	}
+	for _, tt := range tests {
+		_, err := c.ListEvents(context.Background(), tt.calendarID, from)
+		var apiErr *gcal.APIError
+		if !errors.Is(err, tt.want) || !errors.As(err, &apiErr) || apiErr.CalendarID != tt.calendarID {
+			t.Errorf("ListEvents(%s) error = %v, want %v", tt.calendarID, err, tt.want)
+		}
+	}
+	_, err := c.ListEvents(context.Background(), "nobody@example.com", from)
+	if err == nil || !strings.Contains(err.Error(), "not found in the store") {
+		t.Errorf("ListEvents error = %v, want Graph's message", err)
+	}
+}
+
+func TestRRule(t *testing.T) {
+	tests := []struct {
+		recurrence string
+		want       string
+	}{
+		{`{"pattern": {"type": "daily", "interval": 2}, "range": {"type": "numbered", "numberOfOccurrences": 5}}`, "RRULE:FREQ=DAILY;INTERVAL=2;COUNT=5"},
+		{`{"pattern": {"type": "weekly", "interval": 1, "daysOfWeek": ["tuesday", "thursday"]}, "range": {"type": "endDate", "endDate": "2025-06-30"}}`, "RRULE:FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20250630"},
+		{`{"pattern": {"type": "absoluteMonthly", "interval": 1, "dayOfMonth": 15}, "range": {"type": "noEnd"}}`, "RRULE:FREQ=MONTHLY;BYMONTHDAY=15"},
+		{`{"pattern": {"type": "relativeMonthly", "interval": 1, "daysOfWeek": ["friday"], "index": "last"}, "range": {"type": "noEnd"}}`, "RRULE:FREQ=MONTHLY;BYDAY=-1FR"},
+		{`{"pattern": {"type": "absoluteYearly", "interval": 1, "month": 5, "dayOfMonth": 17}, "range": {"type": "noEnd"}}`, "RRULE:FREQ=YEARLY;BYMONTH=5;BYMONTHDAY=17"},
+		{`{"pattern": {"type": "relativeYearly", "interval": 1, "month": 11, "daysOfWeek": ["thursday"], "index": "fourth"}, "range": {"type": "noEnd"}}`, "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH"},
+	}
+	for _, tt := range tests {
+		var r recurrence
+		if err := json.Unmarshal([]byte(tt.recurrence), &r); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.rrule(); got != tt.want {
+			t.Errorf("rrule(%s) = %q, want %q", tt.recurrence, got, tt.want)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	loader, err := config.NewFileLoader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := fakeGraph(t)
+	var bearer string
+	apiURL := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer = r.Header.Get("Authorization")
+		api.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer apiURL.Close()
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/contoso.example/oauth2/v2.0/devicecode":
+			if !strings.Contains(r.Form.Get("scope"), "Calendars.ReadWrite") {
+				t.Errorf("device code requested for %q, want write access", r.Form.Get("scope"))
+			}
+			fmt.Fprint(w, `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_uri": "https://microsoft.com/devicelogin", "expires_in": 900, "interval": 1}`)
+		case r.URL.Path == "/contoso.example/oauth2/v2.0/token" && r.Form.Get("device_code") == "dev":
+			// expires at once, so that the first request refreshes it
+			fmt.Fprint(w, `{"access_token": "first", "refresh_token": "r1", "token_type": "Bearer", "expires_in": 1}`)
+		case r.URL.Path == "/contoso.example/oauth2/v2.0/token" && r.Form.Get("refresh_token") == "r1":
+			fmt.Fprint(w, `{"access_token": "second", "refresh_token": "r2", "token_type": "Bearer", "expires_in": 3600}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+		}
+	}))
+	defer login.Close()
+
+	cfg := config.Graph{ClientID: "app", Tenant: "contoso.example", URL: apiURL.URL, LoginURL: login.URL}
+	if _, err := New(context.Background(), cfg, loader, "graph-token.json"); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("New before login error = %v, want %v", err, ErrNotLoggedIn)
+	}
+	var out bytes.Buffer
+	if err := Login(context.Background(), cfg, loader, "graph-token.json", true, &out); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "https://microsoft.com/devicelogin") || !strings.Contains(out.String(), "ABCD-EFGH") {
+		t.Errorf("Login printed %q, want the address and the code", out.String())
+	}
+
+	c, err := New(context.Background(), cfg, loader, "graph-token.json")
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if _, err := c.ListCalendars(context.Background()); err != nil {
+		t.Fatalf("ListCalendars returned error: %v", err)
+	}
+	if bearer != "Bearer second" {
+		t.Errorf("request authorized with %q, want the refreshed token", bearer)
+	}
+	stored, err := loader.LoadTokenFile("graph-token.json")
+	if err != nil || !strings.Contains(string(stored), `"refresh_token":"r2"`) {
+		t.Errorf("stored token = %s, %v, want the rotated refresh token", stored, err)
+	}
+}
@@ -0,0 +1,339 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+// Events converts the VEVENTs of cal. owner is the address of the calendar's
+// owner, used to find their own attendance. All-day and floating times are
+// placed in the calendar's time zone, or loc if it names none. Cancelled
+// events are left out.
+func Events(cal *Component, owner string, loc *time.Location) (*gcal.Events, error) {
+	events := &gcal.Events{}
+	events.TimeZone, loc = CalendarZone(cal, loc)
+	zones := CalendarZones(cal)
+	for _, c := range cal.Find("VEVENT") {
+		if strings.EqualFold(c.Text("STATUS"), "CANCELLED") {
+			continue
+		}
+		e, err := Event(c, owner, loc, zones)
+		if err != nil {
+			return nil, err
+		}
+		events.Items = append(events.Items, e)
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool { return events.Items[i].Start.Before(events.Items[j].Start) })
+	return events, nil
+}
+
+// Instances is like Events, but expands recurring events into their
+// occurrences and keeps only the events overlapping [from, to). Occurrences
+// that were moved or cancelled follow their RECURRENCE-ID overrides.
+func Instances(cal *Component, owner string, loc *time.Location, from, to time.Time) (*gcal.Events, error) {
+	events := &gcal.Events{}
+	events.TimeZone, loc = CalendarZone(cal, loc)
+	zones := CalendarZones(cal)
+	var series []*gcal.Event
+	overridden := make(map[string]bool)
+	for _, c := range cal.Find("VEVENT") {
+		if strings.EqualFold(c.Text("STATUS"), "CANCELLED") {
+			if p := c.Prop("RECURRENCE-ID"); p != nil {
+				if recurrenceID, allDay, err := ParseTime(*p, loc, zones); err == nil {
+					overridden[instanceID(c.Text("UID"), recurrenceID, allDay)] = true
+				}
+			}
+			continue
+		}
+		e, err := Event(c, owner, loc, zones)
+		if err != nil {
+			return nil, err
+		}
+		if e.RecurringEventID != "" {
+			overridden[e.ID] = true
+		}
+		switch {
+		case len(e.Recurrence) > 0 && e.RecurringEventID == "":
+			series = append(series, e)
+		case overlaps(e, from, to):
+			events.Items = append(events.Items, e)
+		}
+	}
+	for _, s := range series {
+		starts, err := Recurrences(s, to)
+		if err != nil {
+			return nil, fmt.Errorf("ical.Instances: %s: %w", s.ID, err)
+		}
+		days := int(s.End.Sub(s.Start).Round(24*time.Hour) / (24 * time.Hour))
+		for _, start := range starts {
+			inst := *s
+			inst.ID, inst.RecurringEventID, inst.Recurrence = instanceID(s.ID, start, s.AllDay), s.ID, nil
+			inst.Start, inst.End = start, start.Add(s.End.Sub(s.Start))
+			if s.AllDay {
+				inst.End = start.AddDate(0, 0, days)
+			}
+			if !overridden[inst.ID] && overlaps(&inst, from, to) {
+				events.Items = append(events.Items, &inst)
+			}
+		}
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool { return events.Items[i].Start.Before(events.Items[j].Start) })
+	return events, nil
+}
+
+// CalendarZone returns the name and location of the calendar's time zone,
+// from X-WR-TIMEZONE or its first VTIMEZONE, falling back to loc.
+func CalendarZone(cal *Component, loc *time.Location) (string, *time.Location) {
+	name := cal.Text("X-WR-TIMEZONE")
+	if name == "" {
+		for _, tz := range cal.Find("VTIMEZONE") {
+			name = tz.Text("TZID")
+			break
+		}
+	}
+	if name != "" {
+		if calLoc, err := CalendarZones(cal).Location(name); err == nil {
+			return name, calLoc
+		}
+	}
+	if loc != nil {
+		return loc.String(), loc
+	}
+	return name, loc
+}
+
+// overlaps reports whether e overlaps [from, to). Events without a duration
+// overlap if they start within it.
+func overlaps(e *gcal.Event, from, to time.Time) bool {
+	if !e.End.After(e.Start) {
+		return !e.Start.Before(from) && e.Start.Before(to)
+	}
+	return e.Start.Before(to) && e.End.After(from)
+}
+
+// instanceID identifies the occurrence of a series starting at start, in the
+// form Google Calendar uses: the UID and the start in UTC, or the date of
+// all-day events.
+func instanceID(uid string, start time.Time, allDay bool) string {
+	if allDay {
+		return uid + "_" + start.Format("20060102")
+	}
+	return uid + "_" + start.UTC().Format("20060102T150405Z")
+}
+
+// Event converts a VEVENT, placing all-day and floating times in loc and
+// resolving TZIDs with zones.
+func Event(c *Component, owner string, loc *time.Location, zones *Zones) (*gcal.Event, error) {
+	uid := c.Text("UID")
+	e := &gcal.Event{
+		ID:          uid,
+		Summary:     c.Text("SUMMARY"),
+		Description: c.Text("DESCRIPTION"),
+		Location:    c.Text("LOCATION"),
+		HTMLLink:    c.Text("URL"),
+		Transparent: strings.EqualFold(c.Text("TRANSP"), "TRANSPARENT"),
+	}
+	if p := c.Prop("RECURRENCE-ID"); p != nil {
+		recurrenceID, allDay, err := ParseTime(*p, loc, zones)
+		if err != nil {
+			return nil, fmt.Errorf("ical.Event: %s: %w", uid, err)
+		}
+		e.ID = instanceID(uid, recurrenceID, allDay)
+		e.RecurringEventID = uid
+	}
+	for _, name := range []string{"CONFERENCE", "X-GOOGLE-CONFERENCE"} {
+		if url := c.Text(name); url != "" && e.ConferenceURL == "" {
+			e.ConferenceURL = url
+		}
+	}
+	switch class := strings.ToUpper(c.Text("CLASS")); class {
+	case "PRIVATE", "CONFIDENTIAL":
+		e.Visibility = strings.ToLower(class)
+	}
+
+	start := c.Prop("DTSTART")
+	if start == nil {
+		return nil, fmt.Errorf("ical.Event: %s has no DTSTART", uid)
+	}
+	var err error
+	if e.Start, e.AllDay, err = ParseTime(*start, loc, zones); err != nil {
+		return nil, fmt.Errorf("ical.Event: %s: %w", uid, err)
+	}
+	switch end, dur := c.Prop("DTEND"), c.Prop("DURATION"); {
+	case end != nil:
+		if e.End, _, err = ParseTime(*end, loc, zones); err != nil {
+			return nil, fmt.Errorf("ical.Event: %s: %w", uid, err)
+		}
+	case dur != nil:
+		d, err := ParseDuration(dur.Value)
+		if err != nil {
+			return nil, fmt.Errorf("ical.Event: %s: %w", uid, err)
+		}
+		e.End = e.Start.Add(d)
+		if e.AllDay && d%(24*time.Hour) == 0 {
+			e.End = e.Start.AddDate(0, 0, int(d/(24*time.Hour)))
+		}
+	case e.AllDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+
+	for _, name := range []string{"RRULE", "RDATE", "EXDATE"} {
+		for _, p := range c.All(name) {
+			if p, err = portableTimes(p, zones); err != nil {
+				return nil, fmt.Errorf("ical.Event: %s: %w", uid, err)
+			}
+			e.Recurrence = append(e.Recurrence, p.String())
+		}
+	}
+
+	organizer := ""
+	if p := c.Prop("ORGANIZER"); p != nil {
+		organizer = address(p.Value)
+	}
+	for _, p := range c.All("ATTENDEE") {
+		email := address(p.Value)
+		cutype := strings.ToUpper(p.Param("CUTYPE"))
+		e.Attendees = append(e.Attendees, gcal.Attendee{
+			Email:     email,
+			Name:      p.Param("CN"),
+			Response:  response(p.Param("PARTSTAT")),
+			Self:      owner != "" && strings.EqualFold(email, owner),
+			Resource:  cutype == "ROOM" || cutype == "RESOURCE",
+			Organizer: organizer != "" && strings.EqualFold(email, organizer),
+		})
+	}
+	return e, nil
+}
+
+// address strips the mailto: scheme from a CAL-ADDRESS value.
+func address(value string) string {
+	if len(value) > 7 && strings.EqualFold(value[:7], "mailto:") {
+		return value[7:]
+	}
+	return value
+}
+
+// response maps a PARTSTAT parameter to an attendee response.
+func response(partstat string) string {
+	switch strings.ToUpper(partstat) {
+	case "ACCEPTED":
+		return gcal.ResponseAccepted
+	case "DECLINED":
+		return gcal.ResponseDeclined
+	case "TENTATIVE":
+		return gcal.ResponseTentative
+	}
+	return gcal.ResponseNeedsAction
+}
+
+// ParseTime parses a DATE or DATE-TIME property. UTC times end in "Z", other
+// times are in the zone named by TZID, resolved with zones, or floating and
+// placed in loc. Dates are midnight in loc and reported as all-day.
+func ParseTime(p Property, loc *time.Location, zones *Zones) (t time.Time, allDay bool, err error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	value := p.Value
+	if i := strings.IndexByte(value, ','); i >= 0 {
+		value = value[:i] // a list, as in EXDATE; the first is enough here
+	}
+	if p.Param("VALUE") == "DATE" || len(value) == 8 {
+		t, err = time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q in %s", p.Value, p.Name)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+	} else {
+		if tzid := p.Param("TZID"); tzid != "" {
+			if loc, err = zones.Location(tzid); err != nil {
+				return time.Time{}, false, fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q in %s", p.Value, p.Name)
+	}
+	return t, false, nil
+}
+
+// portableTimes returns an RDATE or EXDATE whose TZID is not an IANA name
+// with its times in UTC, so that the recurrence can be read without the
+// calendar's VTIMEZONEs.
+func portableTimes(p Property, zones *Zones) (Property, error) {
+	tzid := p.Param("TZID")
+	if tzid == "" || p.Param("VALUE") == "DATE" {
+		return p, nil
+	}
+	if _, err := time.LoadLocation(tzid); err == nil {
+		return p, nil
+	}
+	var values []string
+	for _, v := range strings.Split(p.Value, ",") {
+		one := p
+		one.Value = v
+		t, _, err := ParseTime(one, nil, zones)
+		if err != nil {
+			return Property{}, err
+		}
+		values = append(values, t.UTC().Format("20060102T150405Z"))
+	}
+	return Property{Name: p.Name, Value: strings.Join(values, ",")}, nil
+}
+
+// ParseDuration parses an iCalendar duration such as "PT1H30M", "P1D" or "-PT15M".
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	s, ok := strings.CutPrefix(s, "P")
+	if !ok || s == "" {
+		return 0, fmt.Errorf("invalid duration %q", orig)
+	}
+	var d time.Duration
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+		n, _ := strconv.Atoi(s[:i])
+		var unit time.Duration
+		switch {
+		case !inTime && s[i] == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && s[i] == 'D':
+			unit = 24 * time.Hour
+		case inTime && s[i] == 'H':
+			unit = time.Hour
+		case inTime && s[i] == 'M':
+			unit = time.Minute
+		case inTime && s[i] == 'S':
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * d, nil
+}
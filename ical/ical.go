@@ -0,0 +1,238 @@
+// Package ical reads iCalendar (RFC 5545) data, as served by CalDAV servers and
+// .ics feeds, into calvin's event model, and writes events as iCalendar feeds.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Component is a BEGIN/END block such as VCALENDAR, VEVENT or VTIMEZONE.
+type Component struct {
+	Name       string
+	Props      []Property
+	Components []*Component
+}
+
+// Property is a content line, e.g. "DTSTART;TZID=Europe/Oslo:20250131T100000".
+type Property struct {
+	Name   string              // upper case
+	Params map[string][]string // parameter names are upper case
+	Value  string              // raw value, see Text for unescaping
+}
+
+// Parse reads iCalendar data and returns its top-level component, normally a VCALENDAR.
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, fmt.Errorf("ical.Parse: %w", err)
+	}
+	var stack []*Component
+	var root *Component
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("ical.Parse: line %d: %w", n+1, err)
+		}
+		switch p.Name {
+		case "BEGIN":
+			c := &Component{Name: strings.ToUpper(p.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else if root == nil {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("ical.Parse: line %d: unexpected END:%s", n+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ical.Parse: line %d: property %s outside a component", n+1, p.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("ical.Parse: no component found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ical.Parse: missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfold splits r into content lines, joining lines continued with a leading
+// space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// parseLine parses name, parameters and value of a content line. Parameter
+// values may be quoted to contain ':', ';' and ','.
+func parseLine(line string) (Property, error) {
+	p := Property{}
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, fmt.Errorf("malformed content line %q", line)
+	}
+	p.Name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return p, fmt.Errorf("malformed parameter in %s", p.Name)
+		}
+		name := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+		var values []string
+		for {
+			var value string
+			if strings.HasPrefix(line, `"`) {
+				end := strings.IndexByte(line[1:], '"')
+				if end < 0 {
+					return p, fmt.Errorf("unterminated quote in %s", p.Name)
+				}
+				value, line = line[1:end+1], line[end+2:]
+			} else {
+				end := strings.IndexAny(line, ",;:")
+				if end < 0 {
+					return p, fmt.Errorf("missing value in %s", p.Name)
+				}
+				value, line = line[:end], line[end:]
+			}
+			values = append(values, value)
+			if !strings.HasPrefix(line, ",") {
+				break
+			}
+			line = line[1:]
+		}
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		p.Params[name] = append(p.Params[name], values...)
+		if line == "" {
+			return p, fmt.Errorf("missing value in %s", p.Name)
+		}
+		i = 0
+	}
+	p.Value = line[i+1:]
+	return p, nil
+}
+
+// Param returns the first value of the named parameter, or "".
+func (p Property) Param(name string) string {
+	if v := p.Params[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Text returns the value with TEXT escapes such as "\n" and "\," resolved.
+func (p Property) Text() string {
+	if !strings.Contains(p.Value, `\`) {
+		return p.Value
+	}
+	var b strings.Builder
+	for i := 0; i < len(p.Value); i++ {
+		c := p.Value[i]
+		if c != '\\' || i+1 == len(p.Value) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch p.Value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(p.Value[i])
+		}
+	}
+	return b.String()
+}
+
+// String formats the property as a content line, without folding.
+func (p Property) String() string {
+	var b strings.Builder
+	b.WriteString(p.Name)
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(";" + name + "=")
+		for i, v := range p.Params[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if strings.ContainsAny(v, ":;,") {
+				v = `"` + v + `"`
+			}
+			b.WriteString(v)
+		}
+	}
+	b.WriteString(":" + p.Value)
+	return b.String()
+}
+
+// Prop returns the first property with the given name, or nil.
+func (c *Component) Prop(name string) *Property {
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			return &c.Props[i]
+		}
+	}
+	return nil
+}
+
+// Text returns the unescaped value of the named property, or "".
+func (c *Component) Text(name string) string {
+	if p := c.Prop(name); p != nil {
+		return p.Text()
+	}
+	return ""
+}
+
+// All returns the properties with the given name.
+func (c *Component) All(name string) []Property {
+	var props []Property
+	for _, p := range c.Props {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Find returns the direct subcomponents with the given name.
+func (c *Component) Find(name string) []*Component {
+	var found []*Component
+	for _, sub := range c.Components {
+		if sub.Name == name {
+			found = append(found, sub)
+		}
+	}
+	return found
+}
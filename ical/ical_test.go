@@ -0,0 +1,336 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+const standup = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-TIMEZONE:Europe/Oslo\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1\r\n" +
+	"SUMMARY:Standup\\, daily\r\n" +
+	"DESCRIPTION:First line\\nsecond line that is folded over\r\n" +
+	"  two lines\r\n" +
+	"DTSTART;TZID=Europe/Oslo:20250131T100000\r\n" +
+	"DURATION:PT15M\r\n" +
+	"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR\r\n" +
+	"EXDATE;TZID=Europe/Oslo:20250203T100000\r\n" +
+	"ORGANIZER;CN=Bob:mailto:bob@example.com\r\n" +
+	"ATTENDEE;CN=\"Doe, Alice\";PARTSTAT=DECLINED:mailto:alice@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n" +
+	"ATTENDEE;CUTYPE=ROOM:mailto:fjord@resource.example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday\r\n" +
+	"SUMMARY:Holiday\r\n" +
+	"CLASS:PRIVATE\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"DTSTART;VALUE=DATE:20250130\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:gone\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART:20250131T080000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	cal, err := Parse(strings.NewReader(standup))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if cal.Name != "VCALENDAR" || len(cal.Find("VEVENT")) != 3 {
+		t.Fatalf("Parse = %s with %d events, want VCALENDAR with 3", cal.Name, len(cal.Find("VEVENT")))
+	}
+	ev := cal.Find("VEVENT")[0]
+	if got, want := ev.Text("DESCRIPTION"), "First line\nsecond line that is folded over two lines"; got != want {
+		t.Errorf("DESCRIPTION = %q, want %q", got, want)
+	}
+	if got := ev.All("ATTENDEE")[0].Param("CN"); got != "Doe, Alice" {
+		t.Errorf("CN = %q, want the quoted value", got)
+	}
+	if got := ev.Prop("EXDATE").String(); got != "EXDATE;TZID=Europe/Oslo:20250203T100000" {
+		t.Errorf("EXDATE.String() = %q", got)
+	}
+
+	for _, bad := range []string{"", "BEGIN:VCALENDAR\n", "SUMMARY:x\n", "BEGIN:VEVENT\nEND:VCALENDAR\n", "BEGIN:VEVENT\nDTSTART;TZID\n"} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) accepted malformed data", bad)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	cal, err := Parse(strings.NewReader(standup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := Events(cal, "alice@example.com", time.UTC)
+	if err != nil {
+		t.Fatalf("Events returned error: %v", err)
+	}
+	if events.TimeZone != "Europe/Oslo" || len(events.Items) != 2 {
+		t.Fatalf("Events = %q with %d items, want Europe/Oslo with 2", events.TimeZone, len(events.Items))
+	}
+
+	holiday, meeting := events.Items[0], events.Items[1]
+	oslo, _ := time.LoadLocation("Europe/Oslo")
+	if !holiday.AllDay || !holiday.Start.Equal(time.Date(2025, 1, 30, 0, 0, 0, 0, oslo)) || !holiday.End.Equal(time.Date(2025, 1, 31, 0, 0, 0, 0, oslo)) {
+		t.Errorf("holiday spans %v to %v (all day %v), want Jan 30 in Oslo", holiday.Start, holiday.End, holiday.AllDay)
+	}
+	if !holiday.Transparent || !gcal.IsPrivate(holiday) {
+		t.Errorf("holiday: transparent %v, visibility %q, want transparent and private", holiday.Transparent, holiday.Visibility)
+	}
+
+	if meeting.Summary != "Standup, daily" || !meeting.Start.Equal(time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)) || meeting.End.Sub(meeting.Start) != 15*time.Minute {
+		t.Errorf("meeting = %q %v-%v, want Standup, daily at 09:00 UTC for 15m", meeting.Summary, meeting.Start, meeting.End)
+	}
+	if got := gcal.DescribeRecurrence(meeting.Recurrence); got != "every weekday" {
+		t.Errorf("DescribeRecurrence = %q, want every weekday", got)
+	}
+	if !gcal.IsDeclined(meeting) {
+		t.Error("meeting is not declined by the owner")
+	}
+	want := []gcal.Attendee{
+		{Email: "alice@example.com", Name: "Doe, Alice", Response: gcal.ResponseDeclined, Self: true},
+		{Email: "bob@example.com", Response: gcal.ResponseAccepted, Organizer: true},
+		{Email: "fjord@resource.example.com", Response: gcal.ResponseNeedsAction, Resource: true},
+	}
+	if len(meeting.Attendees) != len(want) {
+		t.Fatalf("got %d attendees, want %d", len(meeting.Attendees), len(want))
+	}
+	for i, a := range meeting.Attendees {
+		if a != want[i] {
+			t.Errorf("attendee %d = %+v, want %+v", i, a, want[i])
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT15M", 15 * time.Minute},
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"P2W", 14 * 24 * time.Hour},
+		{"-PT5M", -5 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "P", "1H", "PT1D", "PH"} {
+		if _, err := ParseDuration(bad); err == nil {
+			t.Errorf("ParseDuration(%q) accepted an invalid duration", bad)
+		}
+	}
+}
+
+func TestRecurrences(t *testing.T) {
+	oslo, _ := time.LoadLocation("Europe/Oslo")
+	tests := []struct {
+		name  string
+		start time.Time
+		lines []string
+		want  string
+	}{
+		{"weekly", time.Date(2025, 1, 27, 10, 0, 0, 0, oslo), []string{"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4"}, "Mon 01-27,Wed 01-29,Mon 02-03,Wed 02-05"},
+		{"biweekly until", time.Date(2025, 1, 28, 10, 0, 0, 0, oslo), []string{"RRULE:FREQ=WEEKLY;INTERVAL=2;UNTIL=20250311T090000Z"}, "Tue 01-28,Tue 02-11,Tue 02-25,Tue 03-11"},
+		{"weekdays with exdate", time.Date(2025, 1, 30, 9, 0, 0, 0, oslo), []string{"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=4", "EXDATE;TZID=Europe/Oslo:20250203T090000"}, "Thu 01-30,Fri 01-31,Tue 02-04"},
+		{"last friday", time.Date(2025, 1, 31, 15, 0, 0, 0, oslo), []string{"RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3"}, "Fri 01-31,Fri 02-28,Fri 03-28"},
+		{"day 31 skips short months", time.Date(2025, 1, 31, 8, 0, 0, 0, oslo), []string{"RRULE:FREQ=MONTHLY;COUNT=3"}, "Fri 01-31,Mon 03-31,Sat 05-31"},
+		{"last weekday", time.Date(2025, 1, 31, 8, 0, 0, 0, oslo), []string{"RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=3"}, "Fri 01-31,Fri 02-28,Mon 03-31"},
+		{"yearly with rdate", time.Date(2024, 5, 17, 0, 0, 0, 0, oslo), []string{"RRULE:FREQ=YEARLY", "RDATE;VALUE=DATE:20250101"}, "Fri 05-17,Wed 01-01,Sat 05-17"},
+		{"single", time.Date(2025, 1, 31, 8, 0, 0, 0, oslo), nil, "Fri 01-31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, err := Recurrences(&gcal.Event{Start: tt.start, Recurrence: tt.lines}, time.Date(2025, 6, 1, 0, 0, 0, 0, oslo))
+			if err != nil {
+				t.Fatalf("Recurrences returned error: %v", err)
+			}
+			var got []string
+			for _, s := range starts {
+				if s.Hour() != tt.start.Hour() {
+					t.Errorf("occurrence %v is not at %02d:00 local time", s, tt.start.Hour())
+				}
+				got = append(got, s.Format("Mon 01-02"))
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("Recurrences = %s, want %s", strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+
+	if _, err := Recurrences(&gcal.Event{Recurrence: []string{"RRULE:FREQ=HOURLY"}}, time.Now()); err == nil {
+		t.Error("Recurrences accepted an unsupported frequency")
+	}
+}
+
+func TestInstances(t *testing.T) {
+	const data = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:sync\r\nSUMMARY:Sync\r\nDTSTART;TZID=Europe/Oslo:20250324T100000\r\nDTEND;TZID=Europe/Oslo:20250324T103000\r\n" +
+		"RRULE:FREQ=WEEKLY\r\nEXDATE;TZID=Europe/Oslo:20250407T100000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:sync\r\nRECURRENCE-ID;TZID=Europe/Oslo:20250331T100000\r\nSUMMARY:Sync (moved)\r\n" +
+		"DTSTART;TZID=Europe/Oslo:20250401T140000\r\nDTEND;TZID=Europe/Oslo:20250401T143000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:sync\r\nRECURRENCE-ID:20250414T080000Z\r\nSTATUS:CANCELLED\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:easter\r\nSUMMARY:Easter\r\nDTSTART;VALUE=DATE:20250418\r\nDTEND;VALUE=DATE:20250422\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:old\r\nSUMMARY:Old\r\nDTSTART:20240101T100000Z\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	cal, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oslo, _ := time.LoadLocation("Europe/Oslo")
+	from := time.Date(2025, 3, 24, 0, 0, 0, 0, oslo)
+	events, err := Instances(cal, "", oslo, from, from.AddDate(0, 0, 28))
+	if err != nil {
+		t.Fatalf("Instances returned error: %v", err)
+	}
+	var got []string
+	for _, e := range events.Items {
+		got = append(got, e.Start.In(oslo).Format("01-02 15:04 ")+e.Summary)
+	}
+	// the weekly sync keeps 10:00 across the switch to summer time on March 30
+	want := "03-24 10:00 Sync,04-01 14:00 Sync (moved),04-18 00:00 Easter"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Instances = %s, want %s", strings.Join(got, ","), want)
+	}
+	if first := events.Items[0]; first.ID != "sync_20250324T090000Z" || first.RecurringEventID != "sync" || first.Recurrence != nil {
+		t.Errorf("first instance = %q of %q with recurrence %v", first.ID, first.RecurringEventID, first.Recurrence)
+	}
+	if moved := events.Items[1]; moved.ID != "sync_20250331T080000Z" {
+		t.Errorf("moved instance ID = %q, want the original start in UTC", moved.ID)
+	}
+}
+
+func TestZones(t *testing.T) {
+	// as exported by Outlook, with a Windows zone name
+	const data = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:16010101T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nRRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\nEND:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nRRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\nEND:DAYLIGHT\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:India Standard Time\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:16010101T000000\r\nTZOFFSETFROM:+0530\r\nTZOFFSETTO:+0530\r\nEND:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\nUID:sync\r\nSUMMARY:Sync\r\nDTSTART;TZID=W. Europe Standard Time:20250324T100000\r\n" +
+		"DTEND;TZID=W. Europe Standard Time:20250324T103000\r\nRRULE:FREQ=WEEKLY;COUNT=4\r\n" +
+		"EXDATE;TZID=W. Europe Standard Time:20250407T100000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\nDTSTART;TZID=India Standard Time:20250326T093000\r\n" +
+		"DTEND;TZID=India Standard Time:20250326T094500\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	cal, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	from := time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)
+	events, err := Instances(cal, "", time.UTC, from, from.AddDate(0, 0, 28))
+	if err != nil {
+		t.Fatalf("Instances returned error: %v", err)
+	}
+	var got []string
+	for _, e := range events.Items {
+		got = append(got, e.Start.UTC().Format("01-02 15:04 ")+e.Summary)
+	}
+	// the sync keeps 10:00 in Berlin across the switch to summer time on March 30
+	want := "03-24 09:00 Sync,03-26 04:00 Standup,03-31 08:00 Sync,04-14 08:00 Sync"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Instances = %s, want %s", strings.Join(got, ","), want)
+	}
+
+	zones := CalendarZones(cal)
+	loc, err := zones.Location("W. Europe Standard Time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []time.Time{time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC), time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC), time.Date(2030, 10, 27, 0, 30, 0, 0, time.UTC), time.Date(2030, 10, 27, 1, 30, 0, 0, time.UTC)} {
+		_, gotOffset := day.In(loc).Zone()
+		_, wantOffset := day.In(berlin).Zone()
+		if gotOffset != wantOffset {
+			t.Errorf("offset at %v = %d, want %d as in Europe/Berlin", day, gotOffset, wantOffset)
+		}
+	}
+
+	unknown := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART;TZID=Mars Standard Time:20250324T100000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	cal, err = Parse(strings.NewReader(unknown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Events(cal, "", time.UTC); err == nil || !strings.Contains(err.Error(), "Mars Standard Time") {
+		t.Errorf("Events with an unknown TZID returned %v, want an error", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	long := strings.Repeat("Blåbærsyltetøy, ", 10)
+	items := []*gcal.Event{
+		{ID: "sync", Summary: "Sync; weekly", Description: long + "\nnext line", Location: "Fjord",
+			ConferenceURL: "https://meet.example.com/sync", Start: time.Date(2025, 1, 27, 10, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 27, 10, 30, 0, 0, time.UTC),
+			Attendees: []gcal.Attendee{
+				{Email: "bob@example.com", Name: "Doe, Bob", Response: gcal.ResponseAccepted, Organizer: true},
+				{Email: "alice@example.com", Response: gcal.ResponseDeclined},
+				{Email: "fjord@example.com", Resource: true},
+			}},
+		{ID: "vacation", Summary: "Vacation", AllDay: true, Transparent: true, EventType: gcal.EventTypeOutOfOffice,
+			Start: time.Date(2025, 1, 28, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC)},
+		{Start: time.Date(2025, 1, 29, 9, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 29, 10, 0, 0, 0, time.UTC), Visibility: "private"},
+	}
+	var b strings.Builder
+	if err := Calendar("Team", items, time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)).Encode(&b); err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	data := b.String()
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("folding split a character: %q", line)
+		}
+	}
+	if !strings.Contains(data, "X-MICROSOFT-CDO-BUSYSTATUS:OOF\r\n") || !strings.Contains(data, "CLASS:PRIVATE\r\n") {
+		t.Errorf("Encode lost the out of office or private marks:\n%s", data)
+	}
+
+	cal, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse of the encoded calendar returned error: %v", err)
+	}
+	if name := cal.Text("X-WR-CALNAME"); name != "Team" {
+		t.Errorf("calendar name = %q, want Team", name)
+	}
+	events, err := Events(cal, "alice@example.com", time.UTC)
+	if err != nil {
+		t.Fatalf("Events returned error: %v", err)
+	}
+	if len(events.Items) != 3 {
+		t.Fatalf("decoded %d events, want 3", len(events.Items))
+	}
+	sync, vacation, busy := events.Items[0], events.Items[1], events.Items[2]
+	if sync.Summary != items[0].Summary || sync.Description != items[0].Description || sync.ConferenceURL != items[0].ConferenceURL ||
+		!sync.Start.Equal(items[0].Start) || !sync.End.Equal(items[0].End) || !gcal.IsDeclined(sync) {
+		t.Errorf("sync did not survive a round trip: %+v", sync)
+	}
+	if a := sync.Attendees; len(a) != 3 || a[0].Name != "Doe, Bob" || !a[0].Organizer || !a[2].Resource {
+		t.Errorf("sync attendees = %+v", a)
+	}
+	if !vacation.AllDay || !vacation.Transparent || vacation.Start.Format("2006-01-02") != "2025-01-28" || vacation.End.Format("2006-01-02") != "2025-01-30" {
+		t.Errorf("vacation did not survive a round trip: %+v", vacation)
+	}
+	if busy.ID == "" || busy.Summary != "(private)" {
+		t.Errorf("busy block = %+v, want a UID and a placeholder summary", busy)
+	}
+}
@@ -0,0 +1,370 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+// Rule is a recurrence rule, the value of an RRULE property. BYSECOND,
+// BYMINUTE, BYHOUR, BYYEARDAY and BYWEEKNO are not supported.
+type Rule struct {
+	Freq       string // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval   int
+	Count      int       // the number of occurrences, 0 for no limit
+	Until      time.Time // the last possible start, zero for no limit
+	ByDay      []WeekdayNum
+	ByMonthDay []int // negative days count from the end of the month
+	ByMonth    []time.Month
+	BySetPos   []int
+}
+
+// WeekdayNum is an entry of BYDAY, e.g. "-1FR" for the last Friday. N is 0
+// for every such weekday of the period.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRule parses the value of an RRULE property. A floating UNTIL is placed in loc.
+func ParseRule(value string, loc *time.Location) (Rule, error) {
+	r := Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		name, val, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(val)
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(val)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("interval %d", r.Interval)
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(val)
+		case "UNTIL":
+			r.Until, _, err = ParseTime(Property{Name: "UNTIL", Value: val}, loc, nil)
+		case "BYDAY":
+			for _, s := range strings.Split(val, ",") {
+				s = strings.ToUpper(s)
+				day, ok := weekdays[s[max(0, len(s)-2):]]
+				if !ok {
+					return Rule{}, fmt.Errorf("invalid BYDAY %q in RRULE", s)
+				}
+				n := 0
+				if num := s[:len(s)-2]; num != "" {
+					if n, err = strconv.Atoi(num); err != nil {
+						break
+					}
+				}
+				r.ByDay = append(r.ByDay, WeekdayNum{N: n, Day: day})
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseInts(val)
+		case "BYMONTH":
+			var months []int
+			months, err = parseInts(val)
+			for _, m := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			r.BySetPos, err = parseInts(val)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid %s in RRULE %q", name, value)
+		}
+	}
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return Rule{}, fmt.Errorf("unsupported FREQ %q in RRULE", r.Freq)
+	}
+	return r, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// Starts returns the starts of the occurrences of a series beginning at
+// dtstart, in order, up to but not including before. dtstart is always the
+// first occurrence. Occurrences keep the wall clock time of dtstart in its
+// time zone, across daylight saving changes.
+func (r Rule) Starts(dtstart, before time.Time) []time.Time {
+	if !dtstart.Before(before) {
+		return nil
+	}
+	out := []time.Time{dtstart}
+	for period := 0; ; period++ {
+		first, candidates := r.period(dtstart, period)
+		if !first.Before(before) || (!r.Until.IsZero() && first.After(r.Until)) {
+			return out
+		}
+		for _, t := range candidates {
+			switch {
+			case !t.After(dtstart):
+				continue
+			case !t.Before(before), !r.Until.IsZero() && t.After(r.Until), r.Count > 0 && len(out) >= r.Count:
+				return out
+			}
+			out = append(out, t)
+		}
+	}
+}
+
+// period returns the first day of the period-th period of the rule and the
+// occurrences within it, in order.
+func (r Rule) period(dtstart time.Time, period int) (time.Time, []time.Time) {
+	loc := dtstart.Location()
+	y, m, d := dtstart.Date()
+	at := func(y int, m time.Month, d int) (time.Time, bool) {
+		t := time.Date(y, m, d, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+		return t, t.Day() == d // false for days the month does not have
+	}
+	n := period * r.Interval
+	var first time.Time
+	var days []time.Time
+	switch r.Freq {
+	case "DAILY":
+		first = time.Date(y, m, d+n, 0, 0, 0, 0, loc)
+		if t, _ := at(y, m, d+n); r.matches(t) {
+			days = append(days, t)
+		}
+	case "WEEKLY":
+		monday := d - (int(dtstart.Weekday())+6)%7
+		first = time.Date(y, m, monday+7*n, 0, 0, 0, 0, loc)
+		for i := 0; i < 7; i++ {
+			t, _ := at(y, m, monday+7*n+i)
+			if r.inByDay(t.Weekday(), dtstart.Weekday()) && r.inByMonth(t.Month()) {
+				days = append(days, t)
+			}
+		}
+	case "MONTHLY":
+		first = time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+		if r.inByMonth(first.Month()) {
+			days = r.monthDays(first.Year(), first.Month(), d, at)
+		}
+	case "YEARLY":
+		first = time.Date(y+n, 1, 1, 0, 0, 0, 0, loc)
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{m}
+		}
+		for _, month := range months {
+			days = append(days, r.monthDays(y+n, month, d, at)...)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return first, r.setPos(days)
+}
+
+// monthDays returns the occurrences in a month: the BYMONTHDAY days, the
+// BYDAY weekdays, or the day of the month of DTSTART.
+func (r Rule) monthDays(y int, m time.Month, dtDay int, at func(int, time.Month, int) (time.Time, bool)) []time.Time {
+	last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	var days []time.Time
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + 1 + d
+			}
+			if t, ok := at(y, m, d); ok && d >= 1 && r.inByDay(t.Weekday(), t.Weekday()) {
+				days = append(days, t)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, wd := range r.ByDay {
+			var matching []time.Time
+			for d := 1; d <= last; d++ {
+				if t, _ := at(y, m, d); t.Weekday() == wd.Day {
+					matching = append(matching, t)
+				}
+			}
+			switch {
+			case wd.N == 0:
+				days = append(days, matching...)
+			case wd.N > 0 && wd.N <= len(matching):
+				days = append(days, matching[wd.N-1])
+			case wd.N < 0 && -wd.N <= len(matching):
+				days = append(days, matching[len(matching)+wd.N])
+			}
+		}
+	default:
+		if t, ok := at(y, m, dtDay); ok {
+			days = append(days, t)
+		}
+	}
+	return days
+}
+
+// matches reports whether a day is selected by the BY rules of a daily rule.
+func (r Rule) matches(t time.Time) bool {
+	if !r.inByDay(t.Weekday(), t.Weekday()) || !r.inByMonth(t.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, d := range r.ByMonthDay {
+		if d == t.Day() || last+1+d == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// inByDay reports whether day is in BYDAY, or equals def if there is none.
+func (r Rule) inByDay(day, def time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return day == def
+	}
+	for _, wd := range r.ByDay {
+		if wd.Day == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) inByMonth(m time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, bm := range r.ByMonth {
+		if bm == m {
+			return true
+		}
+	}
+	return false
+}
+
+// setPos picks the BYSETPOS entries of the occurrences in a period.
+func (r Rule) setPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 {
+		return days
+	}
+	var out []time.Time
+	for _, pos := range r.BySetPos {
+		switch {
+		case pos > 0 && pos <= len(days):
+			out = append(out, days[pos-1])
+		case pos < 0 && -pos <= len(days):
+			out = append(out, days[len(days)+pos])
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// Recurrences returns the starts of the occurrences of series before before,
+// in order: those of its RRULEs and RDATEs, without its EXDATEs. An event
+// without recurrence occurs once.
+func Recurrences(series *gcal.Event, before time.Time) ([]time.Time, error) {
+	loc := series.Start.Location()
+	starts := []time.Time{series.Start}
+	var excluded []Property
+	for _, line := range series.Recurrence {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "RRULE":
+			r, err := ParseRule(p.Value, loc)
+			if err != nil {
+				return nil, err
+			}
+			starts = append(starts, r.Starts(series.Start, before)...)
+		case "RDATE":
+			if strings.EqualFold(p.Param("VALUE"), "PERIOD") {
+				return nil, fmt.Errorf("RDATE periods are not supported")
+			}
+			times, err := parseTimes(p, loc)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range times {
+				if series.AllDay {
+					t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+				}
+				if t.Before(before) {
+					starts = append(starts, t)
+				}
+			}
+		case "EXDATE":
+			excluded = append(excluded, p)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	var out []time.Time
+	for i, t := range starts {
+		if i > 0 && t.Equal(starts[i-1]) {
+			continue
+		}
+		if isExcluded(t, excluded, loc) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// isExcluded reports whether an EXDATE removes the occurrence at t. A date
+// without a time removes the occurrences on that day.
+func isExcluded(t time.Time, exdates []Property, loc *time.Location) bool {
+	for _, p := range exdates {
+		times, err := parseTimes(p, loc)
+		if err != nil {
+			continue
+		}
+		dateOnly := p.Param("VALUE") == "DATE" || len(strings.Split(p.Value, ",")[0]) == 8
+		for _, x := range times {
+			if t.Equal(x) {
+				return true
+			}
+			if dateOnly {
+				ty, tm, td := t.In(loc).Date()
+				xy, xm, xd := x.Date()
+				if ty == xy && tm == xm && td == xd {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseTimes parses a property holding a comma separated list of dates or times.
+func parseTimes(p Property, loc *time.Location) ([]time.Time, error) {
+	var times []time.Time
+	for _, v := range strings.Split(p.Value, ",") {
+		one := p
+		one.Value = v
+		t, _, err := ParseTime(one, loc, nil)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
@@ -0,0 +1,154 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+// maxLineLength is the length in octets content lines are folded at.
+const maxLineLength = 75
+
+// Encode writes the component as iCalendar data, with CRLF line endings and
+// long lines folded.
+func (c *Component) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+	writeFolded(w, "BEGIN:"+c.Name)
+	for _, p := range c.Props {
+		writeFolded(w, p.String())
+	}
+	for _, sub := range c.Components {
+		sub.encode(w)
+	}
+	writeFolded(w, "END:"+c.Name)
+}
+
+// writeFolded writes a content line, continuing it on lines starting with a
+// space where it gets too long, without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		w.WriteString(line[:i] + "\r\n ")
+		line = line[i:]
+		limit = maxLineLength - 1 // the leading space counts
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// Add appends a property. Empty values are left out.
+func (c *Component) Add(name, value string, params ...string) {
+	if value == "" {
+		return
+	}
+	p := Property{Name: name, Value: value}
+	for i := 0; i+1 < len(params); i += 2 {
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		p.Params[params[i]] = append(p.Params[params[i]], params[i+1])
+	}
+	c.Props = append(c.Props, p)
+}
+
+// AddText appends a TEXT property, escaping the value. Empty values are left out.
+func (c *Component) AddText(name, value string, params ...string) {
+	c.Add(name, escapeText(value), params...)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// Calendar returns a VCALENDAR named name holding the events. stamp becomes
+// the DTSTAMP of every event; it should only change when the events do, so
+// that an unchanged calendar encodes to the same bytes.
+func Calendar(name string, items []*gcal.Event, stamp time.Time) *Component {
+	cal := &Component{Name: "VCALENDAR"}
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", "-//calvin//calvin//EN")
+	cal.Add("CALSCALE", "GREGORIAN")
+	cal.AddText("X-WR-CALNAME", name)
+	for _, item := range items {
+		cal.Components = append(cal.Components, VEvent(item, stamp))
+	}
+	return cal
+}
+
+// VEvent converts an event. Recurring events are expected as instances, so
+// the recurrence rules of series are not carried over.
+func VEvent(e *gcal.Event, stamp time.Time) *Component {
+	c := &Component{Name: "VEVENT"}
+	uid := e.ID
+	if uid == "" { // busy blocks of free/busy listings
+		uid = instanceID("busy", e.Start, e.AllDay)
+	}
+	c.AddText("UID", uid)
+	c.Add("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+	if e.AllDay {
+		c.Add("DTSTART", e.Start.Format("20060102"), "VALUE", "DATE")
+		c.Add("DTEND", e.End.Format("20060102"), "VALUE", "DATE")
+	} else {
+		c.Add("DTSTART", e.Start.UTC().Format("20060102T150405Z"))
+		c.Add("DTEND", e.End.UTC().Format("20060102T150405Z"))
+	}
+	c.AddText("SUMMARY", gcal.EventSummary(e))
+	c.AddText("DESCRIPTION", e.Description)
+	c.AddText("LOCATION", e.Location)
+	c.Add("URL", e.HTMLLink)
+	c.Add("CONFERENCE", e.ConferenceURL, "VALUE", "URI")
+	if e.Transparent {
+		c.Add("TRANSP", "TRANSPARENT")
+	} else {
+		c.Add("TRANSP", "OPAQUE")
+	}
+	if gcal.IsPrivate(e) {
+		c.Add("CLASS", strings.ToUpper(e.Visibility))
+	}
+	if e.EventType == gcal.EventTypeOutOfOffice {
+		// shown as out of office by Outlook
+		c.Add("X-MICROSOFT-CDO-BUSYSTATUS", "OOF")
+	}
+	for _, a := range e.Attendees {
+		var params []string
+		if a.Name != "" {
+			params = append(params, "CN", strings.ReplaceAll(a.Name, `"`, "'"))
+		}
+		if a.Organizer {
+			c.Add("ORGANIZER", "mailto:"+a.Email, params...)
+		}
+		if a.Resource {
+			params = append(params, "CUTYPE", "RESOURCE")
+		}
+		params = append(params, "PARTSTAT", partstat(a.Response))
+		c.Add("ATTENDEE", "mailto:"+a.Email, params...)
+	}
+	return c
+}
+
+// partstat maps an attendee response to a PARTSTAT parameter.
+func partstat(response string) string {
+	switch response {
+	case gcal.ResponseAccepted:
+		return "ACCEPTED"
+	case gcal.ResponseDeclined:
+		return "DECLINED"
+	case gcal.ResponseTentative:
+		return "TENTATIVE"
+	}
+	return "NEEDS-ACTION"
+}
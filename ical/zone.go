@@ -0,0 +1,198 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Zones resolves the TZIDs used in a calendar. IANA names are loaded from the
+// system's zone database; other names, such as the Windows zone names used by
+// Outlook and Exchange, are taken from the calendar's VTIMEZONEs. A nil
+// *Zones only knows IANA names.
+type Zones struct {
+	locs map[string]*time.Location
+	errs map[string]error // VTIMEZONEs that could not be converted
+}
+
+// CalendarZones reads the VTIMEZONEs of cal.
+func CalendarZones(cal *Component) *Zones {
+	z := &Zones{locs: make(map[string]*time.Location), errs: make(map[string]error)}
+	for _, tz := range cal.Find("VTIMEZONE") {
+		tzid := tz.Text("TZID")
+		if loc, err := vtimezone(tz); err != nil {
+			z.errs[tzid] = err
+		} else {
+			z.locs[tzid] = loc
+		}
+	}
+	return z
+}
+
+// Location returns the location tzid names. Unknown names are an error, as
+// guessing would shift the events by the difference.
+func (z *Zones) Location(tzid string) (*time.Location, error) {
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return loc, nil
+	}
+	if z != nil {
+		if loc, ok := z.locs[tzid]; ok {
+			return loc, nil
+		}
+		if err, ok := z.errs[tzid]; ok {
+			return nil, fmt.Errorf("time zone %q: %w", tzid, err)
+		}
+	}
+	return nil, fmt.Errorf("unknown time zone %q", tzid)
+}
+
+// vtimezone converts a VTIMEZONE using its latest STANDARD and DAYLIGHT
+// observances, so times before the last change of rules may be off.
+func vtimezone(tz *Component) (*time.Location, error) {
+	tzid := tz.Text("TZID")
+	std, dst := latestObservance(tz, "STANDARD"), latestObservance(tz, "DAYLIGHT")
+	if std == nil {
+		std, dst = dst, nil
+	}
+	if std == nil {
+		return nil, fmt.Errorf("no STANDARD or DAYLIGHT observance")
+	}
+	stdOffset, err := parseOffset(std.Text("TZOFFSETTO"))
+	if err != nil {
+		return nil, err
+	}
+	if dst == nil || std.Prop("RRULE") == nil || dst.Prop("RRULE") == nil {
+		return time.FixedZone(tzid, stdOffset), nil
+	}
+	dstOffset, err := parseOffset(dst.Text("TZOFFSETTO"))
+	if err != nil {
+		return nil, err
+	}
+	toStd, err := posixRule(std)
+	if err != nil {
+		return nil, err
+	}
+	toDst, err := posixRule(dst)
+	if err != nil {
+		return nil, err
+	}
+	stdName, dstName := zoneName(std, stdOffset), zoneName(dst, dstOffset)
+	rule := stdName + posixOffset(stdOffset) + dstName + posixOffset(dstOffset) + "," + toDst + "," + toStd
+	return time.LoadLocationFromTZData(tzid, tzif(stdName, stdOffset, rule))
+}
+
+// latestObservance returns the observance of the kind that started last.
+func latestObservance(tz *Component, kind string) *Component {
+	var latest *Component
+	for _, c := range tz.Find(kind) {
+		if latest == nil || c.Text("DTSTART") > latest.Text("DTSTART") {
+			latest = c
+		}
+	}
+	return latest
+}
+
+// parseOffset parses a UTC offset such as "+0100" or "-033000" into seconds.
+func parseOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || s[0] != '+' && s[0] != '-' {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	var parts [3]int
+	for i := 0; 1+2*i < len(s); i++ {
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", s)
+		}
+		parts[i] = n
+	}
+	offset := parts[0]*3600 + parts[1]*60 + parts[2]
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// posixOffset formats a UTC offset for a POSIX TZ rule, which counts hours
+// west of UTC.
+func posixOffset(offset int) string {
+	sign := "-"
+	if offset <= 0 {
+		sign, offset = "", -offset
+	}
+	s := sign + strconv.Itoa(offset/3600)
+	if rest := offset % 3600; rest != 0 {
+		s += fmt.Sprintf(":%02d", rest/60)
+		if rest%60 != 0 {
+			s += fmt.Sprintf(":%02d", rest%60)
+		}
+	}
+	return s
+}
+
+var abbreviation = regexp.MustCompile(`^[A-Za-z]{3,}$`)
+
+// zoneName returns the TZNAME of an observance for a POSIX TZ rule, or the
+// offset if it has none that fits.
+func zoneName(c *Component, offset int) string {
+	if name := c.Text("TZNAME"); abbreviation.MatchString(name) {
+		return name
+	}
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("<%s%02d%02d>", sign, offset/3600, offset%3600/60)
+}
+
+// posixRule converts the yearly RRULE and DTSTART of an observance into the
+// "Mm.w.d/time" form of POSIX TZ rules. The time is the local time before the
+// change, as in DTSTART.
+func posixRule(c *Component) (string, error) {
+	r, err := ParseRule(c.Text("RRULE"), time.UTC)
+	if err != nil {
+		return "", err
+	}
+	start := c.Text("DTSTART")
+	t, err := time.Parse("20060102T150405", start)
+	if err != nil {
+		return "", fmt.Errorf("invalid DTSTART %q in %s", start, c.Name)
+	}
+	if r.Freq != "YEARLY" || len(r.ByMonth) != 1 || len(r.ByDay) != 1 {
+		return "", fmt.Errorf("unsupported RRULE %q in %s", c.Text("RRULE"), c.Name)
+	}
+	week := r.ByDay[0].N
+	switch {
+	case week == -1:
+		week = 5
+	case week == 0 && len(r.ByMonthDay) == 7 && (r.ByMonthDay[0]-1)%7 == 0:
+		// the weekday within the days 8-14 and so on, as in older US rules
+		week = (r.ByMonthDay[0]-1)/7 + 1
+	case week < 1 || week > 4:
+		return "", fmt.Errorf("unsupported RRULE %q in %s", c.Text("RRULE"), c.Name)
+	}
+	return fmt.Sprintf("M%d.%d.%d/%d:%02d:%02d", r.ByMonth[0], week, r.ByDay[0].Day, t.Hour(), t.Minute(), t.Second()), nil
+}
+
+// tzif encodes a zone without transitions whose times all follow the POSIX
+// TZ rule, in the format time.LoadLocationFromTZData reads.
+func tzif(name string, offset int, rule string) []byte {
+	abbr := strings.Trim(name, "<>") + "\x00"
+	var b bytes.Buffer
+	for range 2 { // the version 1 block, then the version 2 block
+		b.WriteString("TZif2")
+		b.Write(make([]byte, 15))
+		// isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt
+		for _, n := range []uint32{0, 0, 0, 0, 1, uint32(len(abbr))} {
+			binary.Write(&b, binary.BigEndian, n)
+		}
+		binary.Write(&b, binary.BigEndian, int32(offset))
+		b.Write([]byte{0, 0}) // not DST, abbreviation at 0
+		b.WriteString(abbr)
+	}
+	b.WriteString("\n" + rule + "\n")
+	return b.Bytes()
+}
@@ -0,0 +1,246 @@
+// Package icsfeed implements gcal.CalendarService for iCalendar files and
+// feeds, such as exported calendars, public holiday calendars or travel
+// itineraries.
+package icsfeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/ical"
+	"github.com/perbu/calvin/interval"
+)
+
+// ErrReadOnly is returned when creating events in a feed.
+var ErrReadOnly = errors.New(".ics sources are read-only")
+
+// reloadAfter is how long a parsed source is reused, so that a command reads
+// it once while long-running modes still see changes.
+const reloadAfter = time.Minute
+
+// Source reads events from one .ics file or feed. The source is a single
+// calendar, so every calendar ID reads the same events; the ID is only used to
+// find the owner's own attendance.
+type Source struct {
+	URL        string // file://, http:// or https:// URL
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	cal    *ical.Component
+	loaded time.Time
+}
+
+// New creates a source for a file:// or http(s):// URL. webcal:// URLs, as
+// used by subscription links, are fetched over https, and anything else is
+// taken to be a file path. HTTP requests are retried on transient failures,
+// see gcal.RetryTransport.
+func New(source string) (*Source, error) {
+	if source == "" {
+		return nil, fmt.Errorf("icsfeed.New: empty source")
+	}
+	u, err := url.Parse(source)
+	switch {
+	case err != nil || len(u.Scheme) <= 1: // a path, possibly with a drive letter
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return nil, fmt.Errorf("icsfeed.New: %w", err)
+		}
+		path := filepath.ToSlash(abs)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		source = (&url.URL{Scheme: "file", Path: path}).String()
+	case u.Scheme == "webcal":
+		source = "https" + strings.TrimPrefix(source, "webcal")
+	case u.Scheme != "file" && u.Scheme != "http" && u.Scheme != "https":
+		return nil, fmt.Errorf("icsfeed.New: unsupported source %q, want a file or an http(s) URL", source)
+	}
+	return &Source{
+		URL:        source,
+		HTTPClient: &http.Client{Transport: gcal.NewRetryTransport(http.DefaultTransport)},
+	}, nil
+}
+
+// ListEvents retrieves the events of the day theDate falls on, in the local time zone.
+func (s *Source) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	from, to := gcal.LocalDay(theDate)
+	return s.ListEventsRange(ctx, calendarID, from, to)
+}
+
+// ListEventsRange retrieves the events overlapping [from, to), with recurring
+// events expanded into their instances.
+func (s *Source) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	cal, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving events: %w", err)
+	}
+	events, err := ical.Instances(cal, gcal.Owner(calendarID), time.Local, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving events: %w", err)
+	}
+	return events, nil
+}
+
+// SearchEvents retrieves the events in [from, to) whose summary, location or
+// description contain query.
+func (s *Source) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	events, err := s.ListEventsRange(ctx, calendarID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return gcal.Filter{Grep: query}.Apply(events), nil
+}
+
+// ListSeries retrieves the recurring events with instances in [from, to) as
+// their series.
+func (s *Source) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	cal, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", err)
+	}
+	instances, err := ical.Instances(cal, gcal.Owner(calendarID), time.Local, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", err)
+	}
+	occurs := make(map[string]bool)
+	for _, item := range instances.Items {
+		occurs[item.RecurringEventID] = true
+	}
+	events, err := ical.Events(cal, gcal.Owner(calendarID), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving recurring events: %w", err)
+	}
+	items := events.Items[:0]
+	for _, item := range events.Items {
+		if len(item.Recurrence) > 0 && item.RecurringEventID == "" && occurs[item.ID] {
+			items = append(items, item)
+		}
+	}
+	events.Items = items
+	return events, nil
+}
+
+// ListCalendars returns the source as the only calendar.
+func (s *Source) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	cal, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing calendars: %w", err)
+	}
+	name := cal.Text("X-WR-CALNAME")
+	if name == "" {
+		name = s.URL
+	}
+	tz, _ := ical.CalendarZone(cal, time.Local)
+	return []*gcal.Calendar{{ID: s.URL, Name: name, Primary: true, AccessRole: "reader", TimeZone: tz}}, nil
+}
+
+// InsertEvent is not supported.
+func (s *Source) InsertEvent(ctx context.Context, calendarID string, event *gcal.Event) (*gcal.Event, error) {
+	return nil, fmt.Errorf("creating events: %w", ErrReadOnly)
+}
+
+// FreeBusy returns the busy times of the source in [from, to), for each of the
+// calendar IDs, see gcal.BusyFromEvents.
+func (s *Source) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return gcal.BusyFromEvents(ctx, s.ListEventsRange, calendarIDs, from, to)
+}
+
+// load returns the parsed source, reading it again if it was last read more
+// than reloadAfter ago. Failed reads are not kept.
+func (s *Source) load(ctx context.Context) (*ical.Component, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cal != nil && time.Since(s.loaded) < reloadAfter {
+		return s.cal, nil
+	}
+	cal, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cal, s.loaded = cal, time.Now()
+	return cal, nil
+}
+
+// read reads and parses the source.
+func (s *Source) read(ctx context.Context) (*ical.Component, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(s.URL, "file:") {
+		path, err := filePath(s.URL)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	} else {
+		body, err := s.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r = body
+	}
+	defer r.Close()
+	cal, err := ical.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.URL, err)
+	}
+	return cal, nil
+}
+
+// filePath returns the local path a file URL names, with escapes such as %20
+// decoded.
+func filePath(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("icsfeed: %w", err)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("icsfeed: %s: files on other hosts are not supported", fileURL)
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // file:///C:/...
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// fetch requests the source over HTTP and returns the response body. Errors
+// are classified like those of the other backends, but name the URL rather
+// than a calendar, as there is no user to blame.
+func (s *Source) fetch(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	err = fmt.Errorf("icsfeed: %s: %s", s.URL, resp.Status)
+	if kind := gcal.StatusKind(resp.StatusCode); kind != nil {
+		return nil, &gcal.APIError{Kind: kind, Err: err}
+	}
+	return nil, err
+}
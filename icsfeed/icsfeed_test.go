@@ -0,0 +1,129 @@
+package icsfeed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+// team is a calendar with a weekly 1:1 that alice accepted and a public holiday.
+const team = "BEGIN:VCALENDAR\r\nX-WR-CALNAME:Team\r\nX-WR-TIMEZONE:UTC\r\n" +
+	"BEGIN:VEVENT\r\nUID:1on1\r\nSUMMARY:1:1 with Bob\r\nDTSTART:20250127T100000Z\r\nDTEND:20250127T103000Z\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE\r\nEXDATE:20250129T100000Z\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:holiday\r\nSUMMARY:Constitution Day\r\nDTSTART;VALUE=DATE:20250517\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "My Team.ics")
+	if err := os.WriteFile(path, []byte(team), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	escaped := (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/team.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(team))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	from := time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 14)
+	for _, source := range []string{path, "file://" + path, escaped, srv.URL + "/team.ics"} {
+		s, err := New(source)
+		if err != nil {
+			t.Fatalf("New(%q) returned error: %v", source, err)
+		}
+		events, err := s.ListEventsRange(ctx, "alice@example.com", from, to)
+		if err != nil {
+			t.Fatalf("%s: ListEventsRange returned error: %v", source, err)
+		}
+		var got []string
+		for _, item := range events.Items {
+			got = append(got, item.Start.Format("Mon 01-02"))
+		}
+		if want := "Mon 01-27,Mon 02-03,Wed 02-05"; strings.Join(got, ",") != want {
+			t.Errorf("%s: ListEventsRange = %s, want %s", source, strings.Join(got, ","), want)
+		}
+		if !events.Items[0].Attendees[0].Self || gcal.IsDeclined(events.Items[0]) {
+			t.Errorf("%s: alice's attendance is not recognized: %+v", source, events.Items[0].Attendees)
+		}
+	}
+
+	// a week view reads each day, and free reads each user
+	feed, _ := New(srv.URL + "/team.ics")
+	requests.Store(0)
+	for day := 0; day < 7; day++ {
+		if _, err := feed.ListEvents(ctx, "alice@example.com", from.AddDate(0, 0, day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := feed.FreeBusy(ctx, []string{"alice@example.com", "bob@example.com"}, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("feed downloaded %d times, want once", n)
+	}
+
+	s, _ := New(path)
+	series, err := s.ListSeries(ctx, "alice@example.com", from, to)
+	if err != nil || len(series.Items) != 1 || series.Items[0].ID != "1on1" {
+		t.Errorf("ListSeries = %v, %v, want the 1:1 series", series, err)
+	}
+	busy, err := s.FreeBusy(ctx, []string{"alice@example.com"}, from, from.AddDate(0, 0, 1))
+	if err != nil || len(busy["alice@example.com"]) != 1 || busy["alice@example.com"][0].Duration() != 30*time.Minute {
+		t.Errorf("FreeBusy = %v, %v, want the 1:1", busy, err)
+	}
+	calendars, err := s.ListCalendars(ctx)
+	if err != nil || len(calendars) != 1 || calendars[0].Name != "Team" {
+		t.Errorf("ListCalendars = %v, %v, want Team", calendars, err)
+	}
+	if _, err := s.InsertEvent(ctx, "alice@example.com", &gcal.Event{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("InsertEvent error = %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		source string
+		want   error
+	}{
+		{srv.URL + "/gone.ics", gcal.ErrNotFound},
+		{filepath.Join(t.TempDir(), "missing.ics"), os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		s, err := New(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ListEvents(ctx, "alice@example.com", time.Now()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ListEvents error = %v, want %v", tt.source, err, tt.want)
+		}
+	}
+	if _, err := New("ftp://example.com/team.ics"); err == nil {
+		t.Error("New accepted an ftp URL")
+	}
+	if s, err := New("webcal://example.com/team.ics"); err != nil || s.URL != "https://example.com/team.ics" {
+		t.Errorf("New(webcal) = %v, %v, want an https URL", s, err)
+	}
+}
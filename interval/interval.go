@@ -0,0 +1,175 @@
+// Package interval implements operations on half-open time intervals, such as
+// merging, finding gaps and detecting overlaps.
+package interval
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval is the half-open time interval [Start, End).
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns the length of the interval, or zero if it is empty.
+func (i Interval) Duration() time.Duration {
+	if !i.End.After(i.Start) {
+		return 0
+	}
+	return i.End.Sub(i.Start)
+}
+
+// Empty reports whether the interval contains no time.
+func (i Interval) Empty() bool {
+	return !i.End.After(i.Start)
+}
+
+// Overlaps reports whether the intervals share any time. Intervals that only
+// touch, where one ends when the other starts, do not overlap.
+func (i Interval) Overlaps(o Interval) bool {
+	return i.Start.Before(o.End) && o.Start.Before(i.End) && !i.Empty() && !o.Empty()
+}
+
+// Intersect returns the time shared by both intervals. ok is false if they do not overlap.
+func (i Interval) Intersect(o Interval) (Interval, bool) {
+	if !i.Overlaps(o) {
+		return Interval{}, false
+	}
+	r := i
+	if o.Start.After(r.Start) {
+		r.Start = o.Start
+	}
+	if o.End.Before(r.End) {
+		r.End = o.End
+	}
+	return r, true
+}
+
+// Merge returns the union of the intervals as a sorted list of disjoint intervals.
+// Overlapping and touching intervals are joined and empty ones dropped. The input
+// is not modified.
+func Merge(ivs []Interval) []Interval {
+	sorted := make([]Interval, 0, len(ivs))
+	for _, iv := range ivs {
+		if !iv.Empty() {
+			sorted = append(sorted, iv)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].Start.Before(sorted[b].Start) })
+
+	var merged []Interval
+	for _, iv := range sorted {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// Total returns the sum of the durations. For the covered time of intervals
+// that may overlap, use Total(Merge(ivs)).
+func Total(ivs []Interval) time.Duration {
+	var d time.Duration
+	for _, iv := range ivs {
+		d += iv.Duration()
+	}
+	return d
+}
+
+// Covered returns how much of within is covered by the merged intervals.
+func Covered(merged []Interval, within Interval) time.Duration {
+	var d time.Duration
+	for _, iv := range merged {
+		if x, ok := iv.Intersect(within); ok {
+			d += x.Duration()
+		}
+	}
+	return d
+}
+
+// Gaps returns the parts of within not covered by the merged intervals.
+func Gaps(merged []Interval, within Interval) []Interval {
+	var free []Interval
+	cursor := within.Start
+	for _, iv := range merged {
+		if !iv.End.After(cursor) {
+			continue
+		}
+		if !iv.Start.Before(within.End) {
+			break
+		}
+		if iv.Start.After(cursor) {
+			free = append(free, Interval{Start: cursor, End: iv.Start})
+		}
+		cursor = iv.End
+	}
+	if cursor.Before(within.End) {
+		free = append(free, Interval{Start: cursor, End: within.End})
+	}
+	return free
+}
+
+// Pair refers to two intervals by their index in the slice passed to
+// OverlappingPairs or TouchingPairs. A starts no later than B.
+type Pair struct {
+	A, B    int
+	Overlap Interval // the shared time, empty for touching pairs
+}
+
+// OverlappingPairs returns every pair of intervals that overlap, ordered by the
+// start of A and then B.
+func OverlappingPairs(ivs []Interval) []Pair {
+	order := sortedIndexes(ivs)
+	var pairs []Pair
+	for x, a := range order {
+		for _, b := range order[x+1:] {
+			if !ivs[b].Start.Before(ivs[a].End) {
+				break // b and every later interval start after a ends
+			}
+			if overlap, ok := ivs[a].Intersect(ivs[b]); ok {
+				pairs = append(pairs, Pair{A: a, B: b, Overlap: overlap})
+			}
+		}
+	}
+	return pairs
+}
+
+// TouchingPairs returns every pair of non-empty intervals where B starts exactly
+// when A ends, i.e. back-to-back intervals without a gap.
+func TouchingPairs(ivs []Interval) []Pair {
+	order := sortedIndexes(ivs)
+	var pairs []Pair
+	for _, a := range order {
+		if ivs[a].Empty() {
+			continue
+		}
+		for _, b := range order {
+			if a != b && !ivs[b].Empty() && ivs[b].Start.Equal(ivs[a].End) {
+				pairs = append(pairs, Pair{A: a, B: b})
+			}
+		}
+	}
+	return pairs
+}
+
+// sortedIndexes returns the indexes of ivs ordered by start, then end.
+func sortedIndexes(ivs []Interval) []int {
+	order := make([]int, len(ivs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ia, ib := ivs[order[a]], ivs[order[b]]
+		if !ia.Start.Equal(ib.Start) {
+			return ia.Start.Before(ib.Start)
+		}
+		return ia.End.Before(ib.End)
+	})
+	return order
+}
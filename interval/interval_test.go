@@ -0,0 +1,164 @@
+package interval
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// at returns 2025-01-27 at the given hour and minute in UTC.
+func at(h, m int) time.Time {
+	return time.Date(2025, 1, 27, h, m, 0, 0, time.UTC)
+}
+
+func iv(h1, m1, h2, m2 int) Interval {
+	return Interval{Start: at(h1, m1), End: at(h2, m2)}
+}
+
+func TestOverlapsAndIntersect(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Interval
+		want Interval
+		ok   bool
+	}{
+		{"disjoint", iv(9, 0, 10, 0), iv(11, 0, 12, 0), Interval{}, false},
+		{"touching", iv(9, 0, 10, 0), iv(10, 0, 11, 0), Interval{}, false},
+		{"partial", iv(9, 0, 10, 0), iv(9, 30, 11, 0), iv(9, 30, 10, 0), true},
+		{"contained", iv(9, 0, 12, 0), iv(10, 0, 11, 0), iv(10, 0, 11, 0), true},
+		{"identical", iv(9, 0, 10, 0), iv(9, 0, 10, 0), iv(9, 0, 10, 0), true},
+		{"empty inside", iv(9, 0, 10, 0), iv(9, 30, 9, 30), Interval{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Overlaps(tt.b); got != tt.ok {
+				t.Errorf("Overlaps() = %v, want %v", got, tt.ok)
+			}
+			if got := tt.b.Overlaps(tt.a); got != tt.ok {
+				t.Errorf("Overlaps() is not symmetric")
+			}
+			got, ok := tt.a.Intersect(tt.b)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Intersect() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	if d := iv(9, 0, 10, 30).Duration(); d != 90*time.Minute {
+		t.Errorf("Duration() = %v, want 1h30m", d)
+	}
+	if d := iv(10, 0, 9, 0).Duration(); d != 0 {
+		t.Errorf("Duration() of a reversed interval = %v, want 0", d)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []Interval
+		want []Interval
+	}{
+		{"nil", nil, nil},
+		{"single", []Interval{iv(9, 0, 10, 0)}, []Interval{iv(9, 0, 10, 0)}},
+		{"unsorted disjoint", []Interval{iv(11, 0, 12, 0), iv(9, 0, 10, 0)}, []Interval{iv(9, 0, 10, 0), iv(11, 0, 12, 0)}},
+		{"overlapping", []Interval{iv(9, 0, 10, 0), iv(9, 30, 11, 0)}, []Interval{iv(9, 0, 11, 0)}},
+		{"touching", []Interval{iv(9, 0, 10, 0), iv(10, 0, 11, 0)}, []Interval{iv(9, 0, 11, 0)}},
+		{"contained", []Interval{iv(9, 0, 12, 0), iv(10, 0, 11, 0)}, []Interval{iv(9, 0, 12, 0)}},
+		{"drops empty", []Interval{iv(9, 0, 9, 0), iv(10, 0, 11, 0)}, []Interval{iv(10, 0, 11, 0)}},
+		{"chain", []Interval{iv(9, 0, 10, 0), iv(13, 0, 14, 0), iv(9, 45, 13, 0)}, []Interval{iv(9, 0, 14, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]Interval(nil), tt.in...)
+			got := Merge(in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(in, tt.in) {
+				t.Errorf("Merge() modified its input")
+			}
+		})
+	}
+}
+
+func TestTotalAndCovered(t *testing.T) {
+	ivs := []Interval{iv(9, 0, 10, 0), iv(9, 30, 11, 0), iv(16, 0, 18, 0)}
+	if got := Total(ivs); got != 4*time.Hour+30*time.Minute {
+		t.Errorf("Total() = %v, want 4h30m", got)
+	}
+	merged := Merge(ivs)
+	if got := Total(merged); got != 4*time.Hour {
+		t.Errorf("Total(Merge()) = %v, want 4h", got)
+	}
+	if got := Covered(merged, iv(10, 0, 17, 0)); got != 2*time.Hour {
+		t.Errorf("Covered() = %v, want 2h", got)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		merged []Interval
+		within Interval
+		want   []Interval
+	}{
+		{"nothing busy", nil, iv(9, 0, 17, 0), []Interval{iv(9, 0, 17, 0)}},
+		{"all busy", []Interval{iv(8, 0, 18, 0)}, iv(9, 0, 17, 0), nil},
+		{
+			"busy around edges",
+			[]Interval{iv(8, 0, 9, 30), iv(10, 0, 12, 0), iv(16, 0, 18, 0)},
+			iv(9, 0, 17, 0),
+			[]Interval{iv(9, 30, 10, 0), iv(12, 0, 16, 0)},
+		},
+		{"busy outside", []Interval{iv(7, 0, 8, 0), iv(18, 0, 19, 0)}, iv(9, 0, 17, 0), []Interval{iv(9, 0, 17, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Gaps(tt.merged, tt.within); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Gaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlappingPairs(t *testing.T) {
+	ivs := []Interval{
+		iv(13, 0, 14, 0), // 0: overlaps 3
+		iv(9, 0, 10, 0),  // 1: overlaps 2
+		iv(9, 30, 11, 0), // 2: overlaps 1, touches 4
+		iv(13, 30, 15, 0),
+		iv(11, 0, 12, 0), // 4: touches 2 only
+	}
+	want := []Pair{
+		{A: 1, B: 2, Overlap: iv(9, 30, 10, 0)},
+		{A: 0, B: 3, Overlap: iv(13, 30, 14, 0)},
+	}
+	if got := OverlappingPairs(ivs); !reflect.DeepEqual(got, want) {
+		t.Errorf("OverlappingPairs() = %v, want %v", got, want)
+	}
+	if got := OverlappingPairs(nil); got != nil {
+		t.Errorf("OverlappingPairs(nil) = %v, want nil", got)
+	}
+
+	// three intervals covering the same time give three pairs
+	same := []Interval{iv(9, 0, 10, 0), iv(9, 0, 10, 0), iv(9, 0, 10, 0)}
+	if got := OverlappingPairs(same); len(got) != 3 {
+		t.Errorf("OverlappingPairs() found %d pairs, want 3", len(got))
+	}
+}
+
+func TestTouchingPairs(t *testing.T) {
+	ivs := []Interval{
+		iv(10, 0, 11, 0), // 0
+		iv(9, 0, 10, 0),  // 1: touches 0
+		iv(11, 0, 11, 0), // 2: empty, ignored
+		iv(11, 0, 12, 0), // 3: touches 0
+		iv(12, 5, 13, 0), // 4: five minute gap
+	}
+	want := []Pair{{A: 1, B: 0}, {A: 0, B: 3}}
+	if got := TouchingPairs(ivs); !reflect.DeepEqual(got, want) {
+		t.Errorf("TouchingPairs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/perbu/calvin/config"
+	"github.com/perbu/calvin/dateparse"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+	"regexp"
+	"time"
+)
+
+type roomsOptions struct {
+	filter  gcal.RoomFilter
+	all     bool
+	refresh bool
+}
+
+func addRoomsFlags(fs *flag.FlagSet, o *options) {
+	fs.IntVar(&o.rooms.filter.MinCapacity, "min-capacity", 0, "Only rooms with at least this many seats")
+	fs.StringVar(&o.rooms.filter.Feature, "feature", "", "Only rooms with a feature matching this text, e.g. video")
+	fs.BoolVar(&o.rooms.all, "all", false, "Also list rooms that are busy")
+	fs.BoolVar(&o.rooms.refresh, "refresh", false, "Read the rooms from the directory again instead of the cache")
+}
+
+// runRooms lists the rooms that are free in a time window.
+func runRooms(e *env, args []string) error {
+	building, window, err := parseRoomArgs(args, time.Now())
+	if err != nil {
+		return err
+	}
+	filter := e.opts.rooms.filter
+	filter.Building = building
+
+	rooms, err := e.rooms(func(l config.Loader) (gcal.RoomDirectory, error) {
+		return gcal.NewAdminDirectory(e.ctx, l)
+	})
+	if err != nil {
+		return err
+	}
+	var matching []config.Room
+	for _, r := range rooms {
+		if filter.Match(r) {
+			matching = append(matching, r)
+		}
+	}
+	if len(matching) == 0 {
+		return fmt.Errorf("no rooms match")
+	}
+
+	gcalService, err := e.service()
+	if err != nil {
+		return err
+	}
+	statuses, err := gcal.RoomAvailability(e.ctx, gcalService, matching, window)
+	if err != nil {
+		return fmt.Errorf("gcal.RoomAvailability: %w", err)
+	}
+	formatter, err := e.formatter()
+	if err != nil {
+		return err
+	}
+	return gcal.PrintRooms(statuses, window, e.opts.rooms.all, formatter)
+}
+
+// rooms returns the rooms from the config, the cache or the directory, in that
+// order. The directory is only connected to when needed. Rooms read from it are cached.
+func (e *env) rooms(newDirectory func(config.Loader) (gcal.RoomDirectory, error)) ([]config.Room, error) {
+	if len(e.config.Rooms) > 0 {
+		return e.config.Rooms, nil
+	}
+	if !e.opts.rooms.refresh {
+		if rooms := gcal.LoadRoomCache(e.loader, e.opts.profile); len(rooms) > 0 {
+			return rooms, nil
+		}
+	}
+	dir, err := newDirectory(e.loader)
+	if err != nil {
+		return nil, fmt.Errorf("gcal.NewAdminDirectory: %w", err)
+	}
+	rooms, err := dir.ListRooms(e.ctx)
+	if errors.Is(err, gcal.ErrForbidden) {
+		return nil, hintf("reading rooms needs directory access, run 'calvin auth login --rooms' or list them under \"rooms\" in the config: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gcal.SaveRoomCache(e.loader, e.opts.profile, rooms); err != nil {
+		fmt.Fprintf(e.stderr, "Warning: could not cache rooms: %v\n", err)
+	}
+	return rooms, nil
+}
+
+var timeRange = regexp.MustCompile(`^(\d{1,2}:\d{2})-(\d{1,2}:\d{2})$`)
+
+// parseRoomArgs parses "[building] [date] [HH:MM-HH:MM]". Without a time range
+// the window is the hour starting at the current time of day.
+func parseRoomArgs(args []string, now time.Time) (string, interval.Interval, error) {
+	var startClock, endClock time.Duration
+	hasRange := false
+	if n := len(args); n > 0 {
+		if m := timeRange.FindStringSubmatch(args[n-1]); m != nil {
+			var err1, err2 error
+			startClock, err1 = clockOffset(m[1])
+			endClock, err2 = clockOffset(m[2])
+			if err1 != nil || err2 != nil || endClock <= startClock {
+				return "", interval.Interval{}, usagef("invalid time range %q", args[n-1])
+			}
+			hasRange = true
+			args = args[:n-1]
+		}
+	}
+
+	var building string
+	if len(args) > 0 && !dateparse.IsDateWord(args[0]) {
+		building, args = args[0], args[1:]
+	}
+	parser := dateparse.New()
+	parser.NowDate = func() time.Time { return now }
+	parseResult, err := parser.Parse(append([]string{"rooms"}, args...))
+	if err != nil {
+		return "", interval.Interval{}, usagef("%v", err)
+	}
+	if parseResult.IsWeek {
+		return "", interval.Interval{}, usagef("rooms looks at a single day, not a week")
+	}
+
+	d := parseResult.Date
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, now.Location())
+	if !hasRange {
+		startClock = time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+		endClock = startClock + time.Hour
+	}
+	return building, interval.Interval{Start: gcal.AtClock(day, startClock), End: gcal.AtClock(day, endClock)}, nil
+}
+
+// clockOffset parses a "15:04" clock time into an offset from midnight.
+func clockOffset(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// completeRooms offers the known buildings, then date keywords.
+func completeRooms(e *env, args []string) []string {
+	if len(args) > 0 {
+		return dateparse.Keywords()
+	}
+	rooms := e.config.Rooms
+	if len(rooms) == 0 {
+		rooms = gcal.LoadRoomCache(e.loader, e.opts.profile)
+	}
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, r := range rooms {
+		if r.Building != "" && !seen[r.Building] {
+			seen[r.Building] = true
+			candidates = append(candidates, r.Building)
+		}
+	}
+	return append(candidates, dateparse.Keywords()...)
+}
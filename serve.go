@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/server"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type serveOptions struct {
+	listen  string
+	cache   time.Duration
+	feedURL string
+}
+
+func addServeFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.serve.listen, "listen", "127.0.0.1:8080", "Address to listen on")
+	fs.DurationVar(&o.serve.cache, "cache", time.Minute, "How long to reuse calendar responses")
+	fs.StringVar(&o.serve.feedURL, "feed-url", "", "Print the URL of a `feed`, such as team?types=outOfOffice, and exit")
+}
+
+// runServe serves calendar data as JSON and iCalendar feeds over HTTP until
+// interrupted. Clients must send the token in CALVIN_SERVE_TOKEN, if it is
+// set, or use a feed URL from --feed-url.
+func runServe(e *env, args []string) error {
+	if len(args) > 0 {
+		return usagef("unexpected argument %q", args[0])
+	}
+	token := os.Getenv(server.TokenEnv)
+	if e.opts.serve.feedURL != "" {
+		return e.printFeedURL(token)
+	}
+	workStart, workEnd, err := e.config.WorkHours.Offsets()
+	if err != nil {
+		return err
+	}
+	backend, err := e.backend()
+	if err != nil {
+		return err
+	}
+	s := &server.Server{
+		Service:   gcal.Cached(backend, e.opts.serve.cache),
+		Resolve:   e.resolveCalendarIDs,
+		Token:     token,
+		WorkStart: workStart,
+		WorkEnd:   workEnd,
+	}
+	return e.listenAndServe(s.Handler())
+}
+
+// printFeedURL prints the URL of the --feed-url feed, signed with token.
+func (e *env) printFeedURL(token string) error {
+	user, query, _ := strings.Cut(e.opts.serve.feedURL, "?")
+	filters, err := url.ParseQuery(query)
+	if err != nil {
+		return usagef("invalid feed query %q: %v", query, err)
+	}
+	if _, err := e.resolveCalendarIDs(user); err != nil {
+		return err
+	}
+	s := &server.Server{Token: token}
+	fmt.Fprintf(e.stdout, "http://%s%s\n", e.opts.serve.listen, s.FeedURL(user, filters))
+	return nil
+}
+
+// listenAndServe serves handler on the --listen address until e.ctx is done.
+func (e *env) listenAndServe(handler http.Handler) error {
+	ln, err := net.Listen("tcp", e.opts.serve.listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	fmt.Fprintf(e.stdout, "Serving on http://%s. Press Ctrl-C to stop.\n", ln.Addr())
+
+	select {
+	case err := <-done:
+		return err
+	case <-e.ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/ical"
+)
+
+// Feeds cover the events from feedPastDays before today to feedFutureDays after.
+const (
+	feedPastDays   = 30
+	feedFutureDays = 180
+)
+
+// handleFeed serves /feeds/{user}.ics, the user's events as an iCalendar feed
+// for calendar apps to subscribe to. An alias for a group gives a merged feed
+// with the member's name before each summary. The feed can be narrowed with
+// types, a comma separated list of event types such as outOfOffice or
+// "default" for ordinary events, and grep and exclude, which work as the flags.
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	user, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok || user == "" {
+		http.NotFound(w, r)
+		return
+	}
+	calendarIDs, err := s.Resolve(user)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	q := r.URL.Query()
+	filter := gcal.Filter{Grep: q.Get("grep"), Exclude: q.Get("exclude")}
+	var types map[string]bool
+	if v := q.Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	today := gcal.StartOfDay(s.now(), time.Local)
+	from, to := today.AddDate(0, 0, -feedPastDays), today.AddDate(0, 0, feedFutureDays)
+	var items []*gcal.Event
+	for _, calendarID := range calendarIDs {
+		events, err := s.Service.ListEventsRange(r.Context(), calendarID, from, to)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		for _, item := range filter.Apply(events).Items {
+			if types != nil && !types[eventType(item)] {
+				continue
+			}
+			if len(calendarIDs) > 1 {
+				item = memberEvent(item, calendarID)
+			}
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Start.Before(items[j].Start) })
+
+	var body bytes.Buffer
+	if err := ical.Calendar(user, items, today).Encode(&body); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(body.Bytes())
+}
+
+// eventType returns the type of the event, "default" for ordinary events as
+// in the Google Calendar API.
+func eventType(item *gcal.Event) string {
+	if item.EventType == "" {
+		return "default"
+	}
+	return item.EventType
+}
+
+// memberEvent returns a copy of a group member's event for a merged feed. The
+// UID is made unique, as members often share meetings.
+func memberEvent(item *gcal.Event, calendarID string) *gcal.Event {
+	member := *item
+	id := item.ID
+	if id == "" {
+		id = "busy-" + strconv.FormatInt(item.Start.Unix(), 10)
+	}
+	name, _, _ := strings.Cut(calendarID, "@")
+	member.ID = id + "/" + calendarID
+	member.Summary = name + ": " + gcal.EventSummary(item)
+	return &member
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedURL returns the path and query of user's feed with the given filters.
+// When a token is set, the query carries a key that authorizes this feed
+// only, for calendar apps that cannot send a bearer token.
+func (s *Server) FeedURL(user string, filters url.Values) string {
+	path := "/feeds/" + user + ".ics"
+	q := url.Values{}
+	for k, v := range filters {
+		q[k] = v
+	}
+	if s.Token != "" {
+		q.Set("key", s.feedKey(path, filters))
+	}
+	if len(q) == 0 {
+		return path
+	}
+	return (&url.URL{Path: path, RawQuery: q.Encode()}).String()
+}
+
+// feedKey signs the path and filters of a feed with the token.
+func (s *Server) feedKey(path string, filters url.Values) string {
+	q := url.Values{}
+	for k, v := range filters {
+		if k != "key" {
+			q[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(s.Token))
+	mac.Write([]byte(path + "?" + q.Encode()))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// validFeedKey reports whether r is for a feed and carries its key.
+func (s *Server) validFeedKey(r *http.Request) bool {
+	key := r.URL.Query().Get("key")
+	if !strings.HasPrefix(r.URL.Path, "/feeds/") || key == "" {
+		return false
+	}
+	return hmac.Equal([]byte(key), []byte(s.feedKey(r.URL.Path, r.URL.Query())))
+}
@@ -0,0 +1,347 @@
+// Package server serves calendar data as JSON and iCalendar feeds over HTTP,
+// so that dashboards, scripts and calendar apps can read calendars without
+// implementing calendar access.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// TokenEnv names the environment variable holding the bearer token clients must send.
+const TokenEnv = "CALVIN_SERVE_TOKEN"
+
+// nextLookahead is how far ahead /next looks for the next event.
+const nextLookahead = 7 * 24 * time.Hour
+
+// Server answers requests from a calendar service. Queries are aligned to
+// days, so that a service wrapped with gcal.Cached can answer repeated
+// requests from its cache.
+type Server struct {
+	Service gcal.CalendarService
+	// Resolve turns a username or alias from a request into calendar IDs.
+	Resolve func(user string) ([]string, error)
+	// Token, if set, must be sent as "Authorization: Bearer <token>".
+	Token string
+	// WorkStart and WorkEnd bound the working day searched by /free, as
+	// offsets from midnight.
+	WorkStart, WorkEnd time.Duration
+	Now                func() time.Time // replaced in tests
+}
+
+// Handler returns the HTTP handler serving the API:
+//
+//	GET /events?user=alice&from=2025-01-27&to=2025-01-28
+//	GET /free?users=alice,bob&date=2025-01-27&min=30m
+//	GET /next?user=alice
+//	GET /feeds/alice.ics?types=outOfOffice
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /free", s.handleFree)
+	mux.HandleFunc("GET /next", s.handleNext)
+	mux.HandleFunc("GET /feeds/{file}", s.handleFeed)
+	return s.authorize(mux)
+}
+
+// authorize rejects requests without the bearer token, if one is set. Feeds
+// may carry their key instead, see FeedURL.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.validFeedKey(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="calvin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Event is an event as served by the API.
+type Event struct {
+	ID               string     `json:"id"`
+	Summary          string     `json:"summary"`
+	Description      string     `json:"description,omitempty"`
+	Location         string     `json:"location,omitempty"`
+	ConferenceURL    string     `json:"conference_url,omitempty"`
+	HTMLLink         string     `json:"html_link,omitempty"`
+	Start            time.Time  `json:"start"`
+	End              time.Time  `json:"end"`
+	AllDay           bool       `json:"all_day"`
+	EventType        string     `json:"event_type,omitempty"`
+	Transparent      bool       `json:"transparent,omitempty"`
+	Visibility       string     `json:"visibility,omitempty"`
+	RecurringEventID string     `json:"recurring_event_id,omitempty"`
+	Attendees        []Attendee `json:"attendees,omitempty"`
+}
+
+// Attendee is a guest of an event as served by the API.
+type Attendee struct {
+	Email     string `json:"email"`
+	Name      string `json:"name,omitempty"`
+	Response  string `json:"response"`
+	Self      bool   `json:"self,omitempty"`
+	Resource  bool   `json:"resource,omitempty"`
+	Organizer bool   `json:"organizer,omitempty"`
+}
+
+func toEvent(item *gcal.Event) Event {
+	e := Event{
+		ID:               item.ID,
+		Summary:          gcal.EventSummary(item),
+		Description:      item.Description,
+		Location:         item.Location,
+		ConferenceURL:    item.ConferenceURL,
+		HTMLLink:         item.HTMLLink,
+		Start:            item.Start,
+		End:              item.End,
+		AllDay:           item.AllDay,
+		EventType:        item.EventType,
+		Transparent:      item.Transparent,
+		Visibility:       item.Visibility,
+		RecurringEventID: item.RecurringEventID,
+	}
+	for _, a := range item.Attendees {
+		e.Attendees = append(e.Attendees, Attendee(a))
+	}
+	return e
+}
+
+// EventsResponse is the answer to /events.
+type EventsResponse struct {
+	User       string    `json:"user"`
+	CalendarID string    `json:"calendar_id"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	TimeZone   string    `json:"time_zone,omitempty"`
+	AccessRole string    `json:"access_role,omitempty"`
+	Events     []Event   `json:"events"`
+}
+
+// handleEvents lists a calendar's events in [from, to). from defaults to
+// today and to to the day after from.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	user, calendarID, err := s.singleCalendar(q.Get("user"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from := gcal.StartOfDay(s.now(), time.Local)
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTime(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid from: %w", err))
+			return
+		}
+	}
+	to := from.AddDate(0, 0, 1)
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTime(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid to: %w", err))
+			return
+		}
+	}
+	if !to.After(from) {
+		writeError(w, http.StatusBadRequest, errors.New("to must be after from"))
+		return
+	}
+	events, err := s.Service.ListEventsRange(r.Context(), calendarID, from, to)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resp := EventsResponse{User: user, CalendarID: calendarID, From: from, To: to, TimeZone: events.TimeZone, AccessRole: events.AccessRole, Events: []Event{}}
+	for _, item := range events.Items {
+		resp.Events = append(resp.Events, toEvent(item))
+	}
+	writeJSON(w, resp)
+}
+
+// Slot is a stretch of free time.
+type Slot struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Minutes int       `json:"minutes"`
+}
+
+// FreeResponse is the answer to /free.
+type FreeResponse struct {
+	Users       []string  `json:"users"`
+	CalendarIDs []string  `json:"calendar_ids"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Slots       []Slot    `json:"slots"`
+}
+
+// handleFree finds the times within the working day of date, default today,
+// when all the users are free for at least min, default 30 minutes.
+func (s *Server) handleFree(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("users") == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing users"))
+		return
+	}
+	users := strings.Split(q.Get("users"), ",")
+	var calendarIDs []string
+	for i, user := range users {
+		users[i] = strings.TrimSpace(user)
+		ids, err := s.Resolve(users[i])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		calendarIDs = append(calendarIDs, ids...)
+	}
+	day := gcal.StartOfDay(s.now(), time.Local)
+	if v := q.Get("date"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid date, want YYYY-MM-DD: %w", err))
+			return
+		}
+		day = d
+	}
+	minLength := 30 * time.Minute
+	if v := q.Get("min"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid min, want a duration such as 30m"))
+			return
+		}
+		minLength = d
+	}
+
+	window := interval.Interval{Start: gcal.AtClock(day, s.WorkStart), End: gcal.AtClock(day, s.WorkEnd)}
+	var listings []*gcal.Events
+	for _, calendarID := range calendarIDs {
+		// whole days, so that the listings can be reused
+		events, err := s.Service.ListEventsRange(r.Context(), calendarID, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		listings = append(listings, events)
+	}
+	resp := FreeResponse{Users: users, CalendarIDs: calendarIDs, From: window.Start, To: window.End, Slots: []Slot{}}
+	for _, slot := range gcal.FreeSlots(listings, window, minLength) {
+		resp.Slots = append(resp.Slots, Slot{Start: slot.Start, End: slot.End, Minutes: int(slot.Duration().Minutes())})
+	}
+	writeJSON(w, resp)
+}
+
+// NextResponse is the answer to /next. Event is null if there is no event in
+// the coming week.
+type NextResponse struct {
+	User            string `json:"user"`
+	CalendarID      string `json:"calendar_id"`
+	Event           *Event `json:"event"`
+	StartsInSeconds int64  `json:"starts_in_seconds,omitempty"`
+}
+
+// handleNext returns the user's next timed event that they have not declined.
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request) {
+	user, calendarID, err := s.singleCalendar(r.URL.Query().Get("user"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := s.now()
+	from := gcal.StartOfDay(now, time.Local)
+	events, err := s.Service.ListEventsRange(r.Context(), calendarID, from, from.Add(nextLookahead))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resp := NextResponse{User: user, CalendarID: calendarID}
+	if item := gcal.NextEvent(events.Items, now); item != nil {
+		e := toEvent(item)
+		resp.Event = &e
+		resp.StartsInSeconds = int64(item.Start.Sub(now).Seconds())
+	}
+	writeJSON(w, resp)
+}
+
+// singleCalendar resolves user, which must name a single calendar.
+func (s *Server) singleCalendar(user string) (string, string, error) {
+	if user == "" {
+		return "", "", errors.New("missing user")
+	}
+	ids, err := s.Resolve(user)
+	if err != nil {
+		return "", "", err
+	}
+	if len(ids) != 1 {
+		return "", "", fmt.Errorf("%q is a group of %d calendars, pick a single user", user, len(ids))
+	}
+	return user, ids[0], nil
+}
+
+// parseTime accepts an RFC 3339 time or a date, which means local midnight.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want YYYY-MM-DD or an RFC 3339 time, got %q", s)
+	}
+	return t, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("serve: writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// writeServiceError reports a failed calendar request with the status that
+// matches its kind: calendars that do not exist or cannot be read are the
+// client's problem, anything else is the upstream server's.
+func writeServiceError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, gcal.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, gcal.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, gcal.ErrRateLimited):
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "60")
+	default:
+		log.Printf("serve: %v", err)
+	}
+	writeError(w, status, err)
+}
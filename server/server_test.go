@@ -0,0 +1,369 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// mockService serves fixed listings per calendar and counts the requests.
+type mockService struct {
+	mu       sync.Mutex
+	listings map[string]*gcal.Events
+	calls    int
+}
+
+func (m *mockService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	return m.ListEventsRange(ctx, calendarID, theDate, theDate.AddDate(0, 0, 1))
+}
+
+func (m *mockService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	events, ok := m.listings[calendarID]
+	if !ok {
+		return nil, &gcal.APIError{Kind: gcal.ErrNotFound, CalendarID: calendarID, Err: fmt.Errorf("googleapi: Error 404: Not Found")}
+	}
+	in := &gcal.Events{TimeZone: events.TimeZone}
+	for _, item := range events.Items {
+		if item.Start.Before(to) && item.End.After(from) {
+			in.Items = append(in.Items, item)
+		}
+	}
+	return in, nil
+}
+
+func (m *mockService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	return m.ListEventsRange(ctx, calendarID, from, to)
+}
+
+func (m *mockService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	return &gcal.Events{}, nil
+}
+
+func (m *mockService) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	return nil, nil
+}
+
+func (m *mockService) InsertEvent(ctx context.Context, calendarID string, event *gcal.Event) (*gcal.Event, error) {
+	return event, nil
+}
+
+func (m *mockService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return nil, nil
+}
+
+// local returns a time on Monday 2025-01-27 in the local time zone.
+func local(clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", "2025-01-27 "+clock, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func newTestServer(token string) (*Server, *mockService) {
+	mock := &mockService{listings: map[string]*gcal.Events{
+		"alice@example.com": {TimeZone: "Local", Items: []*gcal.Event{
+			{ID: "standup", Summary: "Standup", Start: local("09:00"), End: local("09:15")},
+			{ID: "sync", Summary: "Sync", Start: local("10:00"), End: local("11:00"), ConferenceURL: "https://meet.example.com/sync",
+				Attendees: []gcal.Attendee{{Email: "alice@example.com", Response: gcal.ResponseAccepted, Self: true}}},
+			{ID: "skipped", Summary: "Skipped", Start: local("11:00"), End: local("11:30"),
+				Attendees: []gcal.Attendee{{Email: "alice@example.com", Response: gcal.ResponseDeclined, Self: true}}},
+			{ID: "review", Summary: "Review", Start: local("14:00"), End: local("15:00")},
+		}},
+		"bob@example.com": {TimeZone: "Local", Items: []*gcal.Event{
+			{ID: "lunch", Summary: "Lunch", Start: local("12:00"), End: local("13:00")},
+		}},
+	}}
+	s := &Server{
+		Service: mock,
+		Resolve: func(user string) ([]string, error) {
+			switch user {
+			case "team":
+				return []string{"alice@example.com", "bob@example.com"}, nil
+			case "bad":
+				return nil, fmt.Errorf("alias %q is empty", user)
+			}
+			return []string{user + "@example.com"}, nil
+		},
+		Token:     token,
+		WorkStart: 9 * time.Hour,
+		WorkEnd:   17 * time.Hour,
+		Now:       func() time.Time { return local("09:45") },
+	}
+	return s, mock
+}
+
+func TestHandler(t *testing.T) {
+	s, _ := newTestServer("")
+	h := s.Handler()
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       string // JSON of the interesting part of the response
+		pick       func(body []byte) any
+	}{
+		{"/events?user=alice", http.StatusOK, `["standup","sync","skipped","review"]`, eventIDs},
+		{"/events?user=alice&from=2025-01-27T09:30:00Z&to=2025-01-27T10:30:00Z", http.StatusOK, "", nil},
+		{"/events?user=bob&from=2025-01-28", http.StatusOK, `[]`, eventIDs},
+		{"/events?user=nobody", http.StatusNotFound, "", nil},
+		{"/events?user=team", http.StatusBadRequest, "", nil},
+		{"/events", http.StatusBadRequest, "", nil},
+		{"/events?user=alice&from=monday", http.StatusBadRequest, "", nil},
+		{"/events?user=alice&from=2025-01-28&to=2025-01-27", http.StatusBadRequest, "", nil},
+		{"/free?users=team", http.StatusOK, `["09:15-10:00","11:00-12:00","13:00-14:00","15:00-17:00"]`, slots},
+		{"/free?users=alice,bob&min=90m", http.StatusOK, `["15:00-17:00"]`, slots},
+		{"/free?users=bad", http.StatusBadRequest, "", nil},
+		{"/free?users=alice&min=soon", http.StatusBadRequest, "", nil},
+		{"/free", http.StatusBadRequest, "", nil},
+		{"/next?user=alice", http.StatusOK, `{"id":"sync","in":900,"url":"https://meet.example.com/sync"}`, next},
+		{"/next?user=bob", http.StatusOK, `{"id":"lunch","in":8100,"url":""}`, next},
+		{"/next?user=nobody", http.StatusNotFound, "", nil},
+		{"/bogus", http.StatusNotFound, "", nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d: %s", tt.target, rec.Code, tt.wantStatus, rec.Body.String())
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			if !strings.Contains(rec.Body.String(), `"error"`) && tt.target != "/bogus" {
+				t.Errorf("GET %s body = %s, want an error message", tt.target, rec.Body.String())
+			}
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s Content-Type = %q", tt.target, ct)
+		}
+		if tt.pick == nil {
+			continue
+		}
+		got, err := json.Marshal(tt.pick(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("GET %s = %s, want %s", tt.target, got, tt.want)
+		}
+	}
+}
+
+func eventIDs(body []byte) any {
+	var resp EventsResponse
+	json.Unmarshal(body, &resp)
+	ids := []string{}
+	for _, e := range resp.Events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func slots(body []byte) any {
+	var resp FreeResponse
+	json.Unmarshal(body, &resp)
+	var got []string
+	for _, s := range resp.Slots {
+		got = append(got, s.Start.Format("15:04")+"-"+s.End.Format("15:04"))
+	}
+	return got
+}
+
+func next(body []byte) any {
+	var resp NextResponse
+	json.Unmarshal(body, &resp)
+	if resp.Event == nil {
+		return nil
+	}
+	return struct {
+		ID  string `json:"id"`
+		In  int64  `json:"in"`
+		URL string `json:"url"`
+	}{resp.Event.ID, resp.StartsInSeconds, resp.Event.ConferenceURL}
+}
+
+func TestHandlerToken(t *testing.T) {
+	s, _ := newTestServer("s3cret")
+	h := s.Handler()
+
+	tests := []struct {
+		authorization string
+		wantStatus    int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/next?user=alice", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("Authorization %q = %d, want %d", tt.authorization, rec.Code, tt.wantStatus)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: 401 without WWW-Authenticate", tt.authorization)
+		}
+	}
+}
+
+func TestHandlerCache(t *testing.T) {
+	s, mock := newTestServer("")
+	s.Service = gcal.Cached(mock, time.Minute)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	for _, target := range []string{"/next?user=alice", "/next?user=alice", "/free?users=alice", "/events?user=alice"} {
+		resp, err := srv.Client().Get(srv.URL + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %s", target, resp.Status)
+		}
+	}
+	// /next looks a week ahead, /free and /events share today's listing
+	if mock.calls != 2 {
+		t.Errorf("calendar read %d times, want 2", mock.calls)
+	}
+}
+
+func TestHandlerFeed(t *testing.T) {
+	s, mock := newTestServer("")
+	mock.listings["carol@example.com"] = &gcal.Events{TimeZone: "Local", Items: []*gcal.Event{
+		{ID: "away", Summary: "Vacation", Start: local("00:00"), End: local("00:00").AddDate(0, 0, 3), AllDay: true, EventType: gcal.EventTypeOutOfOffice},
+		{ID: "focus", Summary: "Focus", Start: local("13:00"), End: local("15:00"), EventType: gcal.EventTypeFocusTime},
+		{ID: "planning", Summary: "Planning, Q1", Start: local("15:00"), End: local("16:00")},
+	}}
+	h := s.Handler()
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       []string // summaries in the feed
+	}{
+		{"/feeds/alice.ics", http.StatusOK, []string{"Standup", "Sync", "Skipped", "Review"}},
+		{"/feeds/alice.ics?grep=sync", http.StatusOK, []string{"Sync"}},
+		{"/feeds/alice.ics?exclude=s", http.StatusOK, []string{"Review"}},
+		{"/feeds/carol.ics?types=outOfOffice", http.StatusOK, []string{"Vacation"}},
+		{"/feeds/carol.ics?types=default,focusTime", http.StatusOK, []string{"Focus", `Planning\, Q1`}},
+		{"/feeds/team.ics?exclude=s", http.StatusOK, []string{"bob: Lunch", "alice: Review"}},
+		{"/feeds/nobody.ics", http.StatusNotFound, nil},
+		{"/feeds/bad.ics", http.StatusNotFound, nil},
+		{"/feeds/alice", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d: %s", tt.target, rec.Code, tt.wantStatus, rec.Body.String())
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/calendar; charset=utf-8" {
+			t.Errorf("GET %s Content-Type = %q", tt.target, ct)
+		}
+		var got []string
+		for _, line := range strings.Split(rec.Body.String(), "\r\n") {
+			if summary, ok := strings.CutPrefix(line, "SUMMARY:"); ok {
+				got = append(got, summary)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("GET %s summaries = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerFeedETag(t *testing.T) {
+	s, _ := newTestServer("")
+	h := s.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feeds/team.ics", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET = %d with ETag %q", rec.Code, etag)
+	}
+	body := rec.Body.String()
+	if strings.Count(body, "UID:") != 5 || !strings.Contains(body, "UID:sync/alice@example.com") {
+		t.Errorf("merged feed UIDs:\n%s", body)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", W/` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/feeds/team.ics", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("If-None-Match %s = %d, want %d", tt.ifNoneMatch, rec.Code, tt.wantStatus)
+		}
+		if rec.Code == http.StatusOK && rec.Body.String() != body {
+			t.Errorf("If-None-Match %s: feed changed", tt.ifNoneMatch)
+		}
+	}
+}
+
+func TestFeedURL(t *testing.T) {
+	s, _ := newTestServer("s3cret")
+	h := s.Handler()
+
+	if got := (&Server{}).FeedURL("alice", nil); got != "/feeds/alice.ics" {
+		t.Errorf("FeedURL without token = %q", got)
+	}
+	feed := s.FeedURL("team", url.Values{"types": {"outOfOffice"}})
+	if !strings.HasPrefix(feed, "/feeds/team.ics?") || !strings.Contains(feed, "key=") {
+		t.Fatalf("FeedURL = %q, want a key", feed)
+	}
+	key := strings.SplitN(feed, "key=", 2)[1]
+	key, _, _ = strings.Cut(key, "&")
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{feed, http.StatusOK},
+		{"/feeds/team.ics?types=outOfOffice", http.StatusUnauthorized},
+		{"/feeds/team.ics?types=outOfOffice&key=0123", http.StatusUnauthorized},
+		{"/feeds/team.ics?key=" + key, http.StatusUnauthorized},
+		{"/feeds/alice.ics?types=outOfOffice&key=" + key, http.StatusUnauthorized},
+		{"/events?user=team&types=outOfOffice&key=" + key, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d", tt.target, rec.Code, tt.wantStatus)
+		}
+	}
+}
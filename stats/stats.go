@@ -0,0 +1,234 @@
+// Package stats computes meeting load reports from calendar events.
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+const (
+	defaultTopAttendees = 5
+	defaultFocusBlocks  = 5
+)
+
+// Options controls how a report is computed.
+type Options struct {
+	CalendarID   string
+	From         time.Time
+	To           time.Time
+	Location     *time.Location // used for day buckets and work hours
+	WorkStart    time.Duration  // offset from midnight
+	WorkEnd      time.Duration  // offset from midnight
+	TopAttendees int
+	FocusBlocks  int
+}
+
+// Report summarizes the meeting load of a calendar over a range of days.
+// Meeting hours count overlapping meetings once.
+type Report struct {
+	CalendarID      string         `json:"calendar_id"`
+	From            time.Time      `json:"from"`
+	To              time.Time      `json:"to"`
+	Meetings        int            `json:"meetings"`
+	MeetingHours    float64        `json:"meeting_hours"`
+	WorkHours       float64        `json:"work_hours"`
+	WorkdayPercent  float64        `json:"workday_percent"`
+	HoursPerDay     []DayHours     `json:"hours_per_day"`
+	HoursPerWeekday []WeekdayHours `json:"hours_per_weekday"`
+	FocusBlocks     []Block        `json:"focus_blocks"`
+	CoAttendees     []CoAttendee   `json:"co_attendees"`
+	Recurring       Split          `json:"recurring"`
+	OneOff          Split          `json:"one_off"`
+}
+
+type DayHours struct {
+	Date  string  `json:"date"`
+	Hours float64 `json:"hours"`
+}
+
+type WeekdayHours struct {
+	Weekday string  `json:"weekday"`
+	Hours   float64 `json:"hours"`
+}
+
+// Block is an uninterrupted stretch of working time without meetings.
+type Block struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Hours float64   `json:"hours"`
+}
+
+type CoAttendee struct {
+	Email    string  `json:"email"`
+	Meetings int     `json:"meetings"`
+	Hours    float64 `json:"hours"`
+}
+
+type Split struct {
+	Meetings int     `json:"meetings"`
+	Hours    float64 `json:"hours"`
+}
+
+// Compute builds a report from events. Meetings are timed events the calendar
+// owner has not declined and that block time, i.e. are not marked as free.
+func Compute(events *gcal.Events, opts Options) Report {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.TopAttendees == 0 {
+		opts.TopAttendees = defaultTopAttendees
+	}
+	if opts.FocusBlocks == 0 {
+		opts.FocusBlocks = defaultFocusBlocks
+	}
+	r := Report{CalendarID: opts.CalendarID, From: opts.From, To: opts.To}
+
+	var busy []interval.Interval
+	var recurring, oneOff time.Duration
+	attendees := make(map[string]*CoAttendee)
+	attendeeHours := make(map[string]time.Duration)
+	for _, item := range events.Items {
+		start, end, ok := gcal.EventTimes(item)
+		if !ok || gcal.IsDeclined(item) || item.Transparent || !gcal.IsMeeting(item) {
+			continue
+		}
+		if start.Before(opts.From) {
+			start = opts.From
+		}
+		if end.After(opts.To) {
+			end = opts.To
+		}
+		if !end.After(start) {
+			continue
+		}
+		d := end.Sub(start)
+		r.Meetings++
+		busy = append(busy, interval.Interval{Start: start, End: end})
+		if item.RecurringEventID != "" {
+			r.Recurring.Meetings++
+			recurring += d
+		} else {
+			r.OneOff.Meetings++
+			oneOff += d
+		}
+		for _, a := range item.Attendees {
+			if a.Self || a.Resource || a.Email == opts.CalendarID || a.Response == gcal.ResponseDeclined {
+				continue
+			}
+			if attendees[a.Email] == nil {
+				attendees[a.Email] = &CoAttendee{Email: a.Email}
+			}
+			attendees[a.Email].Meetings++
+			attendeeHours[a.Email] += d
+		}
+	}
+	busy = interval.Merge(busy)
+	r.MeetingHours = hours(interval.Total(busy))
+	r.Recurring.Hours = hours(recurring)
+	r.OneOff.Hours = hours(oneOff)
+
+	perWeekday := make(map[time.Weekday]time.Duration)
+	var work, meetingsInWork time.Duration
+	var free []interval.Interval
+	for day := gcal.StartOfDay(opts.From, opts.Location); day.Before(opts.To); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		d := interval.Covered(busy, interval.Interval{Start: day, End: next})
+		r.HoursPerDay = append(r.HoursPerDay, DayHours{Date: day.Format("2006-01-02"), Hours: hours(d)})
+		perWeekday[day.Weekday()] += d
+
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+		workday := interval.Interval{Start: gcal.AtClock(day, opts.WorkStart), End: gcal.AtClock(day, opts.WorkEnd)}
+		work += workday.Duration()
+		meetingsInWork += interval.Covered(busy, workday)
+		free = append(free, interval.Gaps(busy, workday)...)
+	}
+	for _, wd := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		r.HoursPerWeekday = append(r.HoursPerWeekday, WeekdayHours{Weekday: wd.String(), Hours: hours(perWeekday[wd])})
+	}
+	r.WorkHours = hours(work)
+	if work > 0 {
+		r.WorkdayPercent = round(100 * float64(meetingsInWork) / float64(work))
+	}
+
+	sort.SliceStable(free, func(i, j int) bool { return free[i].Duration() > free[j].Duration() })
+	for _, f := range free[:min(len(free), opts.FocusBlocks)] {
+		r.FocusBlocks = append(r.FocusBlocks, Block{Start: f.Start, End: f.End, Hours: hours(f.Duration())})
+	}
+
+	for email, a := range attendees {
+		a.Hours = hours(attendeeHours[email])
+		r.CoAttendees = append(r.CoAttendees, *a)
+	}
+	sort.Slice(r.CoAttendees, func(i, j int) bool {
+		if r.CoAttendees[i].Meetings != r.CoAttendees[j].Meetings {
+			return r.CoAttendees[i].Meetings > r.CoAttendees[j].Meetings
+		}
+		return r.CoAttendees[i].Email < r.CoAttendees[j].Email
+	})
+	r.CoAttendees = r.CoAttendees[:min(len(r.CoAttendees), opts.TopAttendees)]
+	return r
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a human readable form. Attendee addresses in
+// homeDomain are shortened to the username.
+func (r Report) WriteText(w io.Writer, homeDomain string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Meeting statistics for %s, %s to %s\n",
+		r.CalendarID, r.From.Format("2006-01-02"), r.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	fmt.Fprintf(&b, "Meetings:      %d (%.1fh), %d recurring (%.1fh), %d one-off (%.1fh)\n",
+		r.Meetings, r.MeetingHours, r.Recurring.Meetings, r.Recurring.Hours, r.OneOff.Meetings, r.OneOff.Hours)
+	fmt.Fprintf(&b, "Workday:       %.1f%% of %.1fh working time in meetings\n", r.WorkdayPercent, r.WorkHours)
+
+	b.WriteString("Per weekday:  ")
+	for _, wd := range r.HoursPerWeekday {
+		fmt.Fprintf(&b, " %s %.1fh", wd.Weekday[:3], wd.Hours)
+	}
+	b.WriteString("\nPer day:\n")
+	for _, d := range r.HoursPerDay {
+		date, _ := time.Parse("2006-01-02", d.Date)
+		fmt.Fprintf(&b, "  %s %s %5.1fh %s\n", d.Date, date.Weekday().String()[:3], d.Hours, strings.Repeat("#", int(d.Hours*2+0.5)))
+	}
+
+	b.WriteString("Longest focus blocks:\n")
+	if len(r.FocusBlocks) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, f := range r.FocusBlocks {
+		fmt.Fprintf(&b, "  %s %s-%s (%.1fh)\n", f.Start.Format("2006-01-02 Mon"), f.Start.Format("15:04"), f.End.Format("15:04"), f.Hours)
+	}
+
+	b.WriteString("Top co-attendees:\n")
+	if len(r.CoAttendees) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, a := range r.CoAttendees {
+		fmt.Fprintf(&b, "  %-30s %3d meetings %6.1fh\n", strings.TrimSuffix(a.Email, "@"+homeDomain), a.Meetings, a.Hours)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func hours(d time.Duration) float64 {
+	return round(d.Hours())
+}
+
+// round rounds to two decimals to keep the JSON output readable.
+func round(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
@@ -0,0 +1,93 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/gcal"
+)
+
+func timed(summary, start, end string, attendees ...string) *gcal.Event {
+	item := &gcal.Event{Summary: summary}
+	item.Start, _ = time.Parse(time.RFC3339, start)
+	item.End, _ = time.Parse(time.RFC3339, end)
+	for _, a := range attendees {
+		item.Attendees = append(item.Attendees, gcal.Attendee{Email: a})
+	}
+	return item
+}
+
+func TestCompute(t *testing.T) {
+	standup1 := timed("Standup", "2025-01-27T09:00:00Z", "2025-01-27T09:30:00Z", "alice@example.com", "bob@example.com")
+	standup1.RecurringEventID = "standup"
+	standup2 := timed("Standup", "2025-01-28T09:00:00Z", "2025-01-28T09:30:00Z", "alice@example.com", "bob@example.com")
+	standup2.RecurringEventID = "standup"
+	overlapping := timed("Overlap", "2025-01-27T09:15:00Z", "2025-01-27T10:00:00Z", "alice@example.com", "carol@example.com")
+	declined := timed("Declined", "2025-01-27T13:00:00Z", "2025-01-27T14:00:00Z")
+	declined.Attendees = []gcal.Attendee{{Email: "alice@example.com", Self: true, Response: gcal.ResponseDeclined}}
+	free := timed("Reminder", "2025-01-27T15:00:00Z", "2025-01-27T16:00:00Z")
+	free.Transparent = true
+	allDay := &gcal.Event{Summary: "Holiday", Start: time.Date(2025, 1, 29, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC), AllDay: true}
+
+	events := &gcal.Events{Items: []*gcal.Event{standup1, overlapping, declined, free, standup2, allDay}}
+	r := Compute(events, Options{
+		CalendarID: "alice@example.com",
+		From:       time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC),
+		To:         time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC),
+		Location:   time.UTC,
+		WorkStart:  9 * time.Hour,
+		WorkEnd:    17 * time.Hour,
+	})
+
+	if r.Meetings != 3 {
+		t.Errorf("Meetings = %d, want 3", r.Meetings)
+	}
+	// 09:00-10:00 on Monday (the overlap counts once) and 09:00-09:30 on Tuesday
+	if r.MeetingHours != 1.5 {
+		t.Errorf("MeetingHours = %v, want 1.5", r.MeetingHours)
+	}
+	if r.WorkHours != 40 {
+		t.Errorf("WorkHours = %v, want 40", r.WorkHours)
+	}
+	if r.WorkdayPercent != 3.75 {
+		t.Errorf("WorkdayPercent = %v, want 3.75", r.WorkdayPercent)
+	}
+	if len(r.HoursPerDay) != 7 || r.HoursPerDay[0].Hours != 1 || r.HoursPerDay[1].Hours != 0.5 {
+		t.Errorf("HoursPerDay = %+v", r.HoursPerDay)
+	}
+	if r.HoursPerWeekday[0].Weekday != "Monday" || r.HoursPerWeekday[0].Hours != 1 {
+		t.Errorf("HoursPerWeekday[0] = %+v, want Monday 1h", r.HoursPerWeekday[0])
+	}
+	if r.Recurring != (Split{Meetings: 2, Hours: 1}) || r.OneOff != (Split{Meetings: 1, Hours: 0.75}) {
+		t.Errorf("Recurring = %+v, OneOff = %+v", r.Recurring, r.OneOff)
+	}
+	if len(r.CoAttendees) != 2 || r.CoAttendees[0].Email != "bob@example.com" || r.CoAttendees[0].Meetings != 2 {
+		t.Errorf("CoAttendees = %+v, want bob first with 2 meetings", r.CoAttendees)
+	}
+	// Wednesday to Friday are free all day.
+	if len(r.FocusBlocks) != 5 || r.FocusBlocks[0].Hours != 8 {
+		t.Errorf("FocusBlocks = %+v, want 5 blocks starting with a full day", r.FocusBlocks)
+	}
+
+	var text bytes.Buffer
+	if err := r.WriteText(&text, "example.com"); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+	if !bytes.Contains(text.Bytes(), []byte("bob ")) {
+		t.Errorf("WriteText did not shorten attendees:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := r.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON returned error: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON produced invalid JSON: %v", err)
+	}
+	if decoded.MeetingHours != r.MeetingHours {
+		t.Errorf("decoded MeetingHours = %v, want %v", decoded.MeetingHours, r.MeetingHours)
+	}
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// NotifySend shows a desktop notification through notify-send, which talks to the
+// freedesktop notification service over D-Bus.
+type NotifySend struct{}
+
+func (NotifySend) Notify(ctx context.Context, r Reminder) error {
+	title := fmt.Sprintf("%s in %s", r.Summary, r.In.Round(time.Minute))
+	body := r.Start.Format("15:04") + " - " + r.End.Format("15:04")
+	if r.Location != "" {
+		body += "\n" + r.Location
+	}
+	if err := exec.CommandContext(ctx, "notify-send", "--app-name=calvin", title, body).Run(); err != nil {
+		return fmt.Errorf("notify-send: %w", err)
+	}
+	return nil
+}
+
+// Bell rings the terminal bell and prints the reminder to W.
+type Bell struct {
+	W io.Writer
+}
+
+func (b Bell) Notify(_ context.Context, r Reminder) error {
+	_, err := fmt.Fprintf(b.W, "\a%s %s in %s [%s]\n",
+		r.Start.Format("15:04"), r.Summary, r.In.Round(time.Minute), r.Location)
+	return err
+}
+
+// Hook runs a user supplied shell command. The reminder is passed in the
+// environment as CALVIN_SUMMARY, CALVIN_LOCATION, CALVIN_START, CALVIN_END
+// and CALVIN_MINUTES. Its output goes to Stdout and Stderr, or nowhere if
+// they are nil.
+type Hook struct {
+	Command string
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+func (h Hook) Notify(ctx context.Context, r Reminder) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(),
+		"CALVIN_SUMMARY="+r.Summary,
+		"CALVIN_LOCATION="+r.Location,
+		"CALVIN_START="+r.Start.Format(time.RFC3339),
+		"CALVIN_END="+r.End.Format(time.RFC3339),
+		"CALVIN_MINUTES="+strconv.Itoa(int(r.In.Round(time.Minute).Minutes())),
+	)
+	cmd.Stdout = h.Stdout
+	cmd.Stderr = h.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q: %w", h.Command, err)
+	}
+	return nil
+}
+
+// Multi delivers a reminder through several notifiers, joining their errors.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, r Reminder) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
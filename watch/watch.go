@@ -0,0 +1,168 @@
+// Package watch implements a long-running reminder daemon that polls a calendar
+// and emits notifications shortly before events start.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/perbu/calvin/clock"
+	"github.com/perbu/calvin/gcal"
+)
+
+const (
+	DefaultLead         = 5 * time.Minute
+	DefaultPollInterval = 5 * time.Minute
+	minBackoff          = 5 * time.Second
+	maxBackoff          = 10 * time.Minute
+	// forgetAfter is how long past its start an event is remembered as notified.
+	forgetAfter = time.Hour
+)
+
+// Reminder describes an upcoming event that a Notifier should announce.
+type Reminder struct {
+	ID       string
+	Summary  string
+	Location string
+	Start    time.Time
+	End      time.Time
+	In       time.Duration // time left until Start when the reminder fired
+}
+
+// Notifier delivers a reminder to the user.
+type Notifier interface {
+	Notify(ctx context.Context, r Reminder) error
+}
+
+// Watcher polls a calendar and notifies Lead before each timed event starts.
+type Watcher struct {
+	Service      gcal.CalendarService
+	CalendarID   string
+	Notifier     Notifier
+	Lead         time.Duration
+	PollInterval time.Duration
+	Clock        clock.Clock
+
+	pending  []Reminder           // sorted by reminder time
+	notified map[string]time.Time // event start, keyed by event ID and start time
+}
+
+// New creates a Watcher with default lead time, poll interval and a real clock.
+func New(s gcal.CalendarService, calendarID string, n Notifier) *Watcher {
+	return &Watcher{
+		Service:      s,
+		CalendarID:   calendarID,
+		Notifier:     n,
+		Lead:         DefaultLead,
+		PollInterval: DefaultPollInterval,
+		Clock:        clock.Real,
+	}
+}
+
+// Run polls and notifies until ctx is cancelled. API errors are logged and retried
+// with exponential backoff; already scheduled reminders keep firing meanwhile.
+// Run returns nil on cancellation.
+func (w *Watcher) Run(ctx context.Context) error {
+	if w.notified == nil {
+		w.notified = make(map[string]time.Time)
+	}
+	backoff := time.Duration(0)
+	nextPoll := w.Clock.Now()
+	for {
+		now := w.Clock.Now()
+		if !now.Before(nextPoll) {
+			if err := w.poll(ctx, now); err != nil {
+				backoff = nextBackoff(backoff)
+				log.Printf("watch: %v (retrying in %s)", err, backoff)
+				nextPoll = now.Add(backoff)
+			} else {
+				backoff = 0
+				nextPoll = now.Add(w.PollInterval)
+			}
+		}
+		w.fire(ctx, now)
+
+		wake := nextPoll
+		if len(w.pending) > 0 && w.remindAt(w.pending[0]).Before(wake) {
+			wake = w.remindAt(w.pending[0])
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.Clock.After(wake.Sub(now)):
+		}
+	}
+}
+
+// poll fetches events far enough ahead to cover every reminder due before the next poll.
+func (w *Watcher) poll(ctx context.Context, now time.Time) error {
+	events, err := w.Service.ListEventsRange(ctx, w.CalendarID, now, now.Add(w.Lead+2*w.PollInterval))
+	if err != nil {
+		return fmt.Errorf("listing events: %w", err)
+	}
+	w.pending = w.pending[:0]
+	for _, item := range events.Items {
+		start, end, ok := gcal.EventTimes(item)
+		if !ok || gcal.IsDeclined(item) || !start.After(now) ||
+			item.EventType == gcal.EventTypeWorkingLocation || item.EventType == gcal.EventTypeOutOfOffice {
+			continue
+		}
+		r := Reminder{ID: item.ID, Summary: gcal.EventSummary(item), Location: item.Location, Start: start, End: end}
+		if item.ConferenceURL != "" {
+			r.Location = item.ConferenceURL
+		}
+		if _, done := w.notified[reminderKey(r)]; !done {
+			w.pending = append(w.pending, r)
+		}
+	}
+	sort.Slice(w.pending, func(i, j int) bool { return w.pending[i].Start.Before(w.pending[j].Start) })
+	for key, start := range w.notified {
+		if now.Sub(start) > forgetAfter {
+			delete(w.notified, key)
+		}
+	}
+	return nil
+}
+
+// fire notifies every pending reminder that is due and whose event has not started.
+func (w *Watcher) fire(ctx context.Context, now time.Time) {
+	kept := w.pending[:0]
+	for _, r := range w.pending {
+		switch {
+		case !r.Start.After(now):
+			// too late, the event already started
+		case !w.remindAt(r).After(now):
+			r.In = r.Start.Sub(now)
+			if err := w.Notifier.Notify(ctx, r); err != nil {
+				log.Printf("watch: notifying %q: %v", r.Summary, err)
+			}
+			w.notified[reminderKey(r)] = r.Start
+		default:
+			kept = append(kept, r)
+		}
+	}
+	w.pending = kept
+}
+
+func (w *Watcher) remindAt(r Reminder) time.Time {
+	return r.Start.Add(-w.Lead)
+}
+
+func reminderKey(r Reminder) string {
+	return fmt.Sprintf("%d %s", r.Start.Unix(), r.ID)
+}
+
+// nextBackoff doubles the previous backoff, bounded by minBackoff and maxBackoff.
+func nextBackoff(prev time.Duration) time.Duration {
+	next := 2 * prev
+	if next < minBackoff {
+		next = minBackoff
+	}
+	if next > maxBackoff {
+		next = maxBackoff
+	}
+	return next
+}
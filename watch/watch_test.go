@@ -0,0 +1,161 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perbu/calvin/clock/clocktest"
+	"github.com/perbu/calvin/gcal"
+	"github.com/perbu/calvin/interval"
+)
+
+// fakeService fails the first failures calls to ListEventsRange.
+type fakeService struct {
+	mu       sync.Mutex
+	events   *gcal.Events
+	failures int
+	calls    int
+}
+
+func (f *fakeService) ListEvents(ctx context.Context, calendarID string, theDate time.Time) (*gcal.Events, error) {
+	return f.events, nil
+}
+
+func (f *fakeService) ListEventsRange(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, errors.New("googleapi: Error 503: Backend Error")
+	}
+	return f.events, nil
+}
+
+func (f *fakeService) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) (*gcal.Events, error) {
+	return f.events, nil
+}
+
+func (f *fakeService) ListSeries(ctx context.Context, calendarID string, from, to time.Time) (*gcal.Events, error) {
+	return f.events, nil
+}
+
+func (f *fakeService) ListCalendars(ctx context.Context) ([]*gcal.Calendar, error) {
+	return nil, nil
+}
+
+func (f *fakeService) InsertEvent(ctx context.Context, calendarID string, event *gcal.Event) (*gcal.Event, error) {
+	return event, nil
+}
+
+func (f *fakeService) FreeBusy(ctx context.Context, calendarIDs []string, from, to time.Time) (map[string][]interval.Interval, error) {
+	return nil, nil
+}
+
+type recordingNotifier chan Reminder
+
+func (n recordingNotifier) Notify(_ context.Context, r Reminder) error {
+	n <- r
+	return nil
+}
+
+func startWatcher(t *testing.T, s *fakeService, clock *clocktest.Fake) (recordingNotifier, func()) {
+	t.Helper()
+	notes := make(recordingNotifier, 10)
+	w := New(s, "alice@example.com", notes)
+	w.Clock = clock
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	return notes, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run returned error: %v", err)
+		}
+	}
+}
+
+func TestWatcherNotifiesBeforeStart(t *testing.T) {
+	now := time.Date(2025, 1, 31, 9, 50, 0, 0, time.UTC)
+	s := &fakeService{events: &gcal.Events{Items: []*gcal.Event{
+		{
+			ID:      "standup",
+			Summary: "Standup",
+			Start:   time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC),
+			End:     time.Date(2025, 1, 31, 10, 15, 0, 0, time.UTC),
+		},
+	}}}
+	clock := clocktest.New(now)
+	notes, stop := startWatcher(t, s, clock)
+	defer stop()
+
+	// The watcher should sleep until five minutes before the event.
+	if d := <-clock.Waits; d != 5*time.Minute {
+		t.Fatalf("first wait = %v, want 5m", d)
+	}
+	select {
+	case r := <-notes:
+		t.Fatalf("notified too early: %+v", r)
+	default:
+	}
+	clock.Advance(5 * time.Minute)
+
+	r := <-notes
+	if r.Summary != "Standup" || r.In != 5*time.Minute {
+		t.Errorf("got reminder %+v, want Standup in 5m", r)
+	}
+
+	// A later poll must not notify the same event again.
+	<-clock.Waits
+	clock.Advance(DefaultPollInterval)
+	<-clock.Waits
+	select {
+	case r := <-notes:
+		t.Errorf("notified twice: %+v", r)
+	default:
+	}
+}
+
+func TestWatcherBacksOffOnErrors(t *testing.T) {
+	s := &fakeService{events: &gcal.Events{}, failures: 3}
+	clock := clocktest.New(time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC))
+	_, stop := startWatcher(t, s, clock)
+	defer stop()
+
+	for _, want := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, DefaultPollInterval} {
+		d := <-clock.Waits
+		if d != want {
+			t.Errorf("wait = %v, want %v", d, want)
+		}
+		clock.Advance(d)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	d := time.Duration(0)
+	for i := 0; i < 20; i++ {
+		d = nextBackoff(d)
+	}
+	if d != maxBackoff {
+		t.Errorf("nextBackoff did not cap at %v, got %v", maxBackoff, d)
+	}
+}
+
+func TestHook(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	var stdout, stderr strings.Builder
+	h := Hook{Command: `echo "$CALVIN_SUMMARY in $CALVIN_MINUTES"; echo oops >&2`, Stdout: &stdout, Stderr: &stderr}
+	r := Reminder{Summary: "Standup", Start: time.Now(), In: 5 * time.Minute}
+	if err := h.Notify(context.Background(), r); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+	if stdout.String() != "Standup in 5\n" || stderr.String() != "oops\n" {
+		t.Errorf("hook wrote %q and %q, want the reminder and oops", stdout.String(), stderr.String())
+	}
+}